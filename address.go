@@ -6,12 +6,31 @@ const (
 	AddrProcessorPort        = uint16(0x0001)
 	AddrBasicVariableStorage = uint16(0x002d)
 	AddrBasicArrayStorage    = uint16(0x002f)
+	AddrStatus               = uint16(0x0090)
 	AddrStopKey              = uint16(0x0091)
+	AddrVerifyFlag           = uint16(0x0093)
+	AddrEndAddress           = uint16(0x00ae)
+	AddrFilenameLen          = uint16(0x00b7)
+	AddrSecondaryAddress     = uint16(0x00b9)
+	AddrDeviceNumber         = uint16(0x00ba)
+	AddrFilename             = uint16(0x00bb)
+	AddrStartAddress         = uint16(0x00c1)
+	AddrLoadAddress          = uint16(0x00c3)
 	AddrKeyboardBufferLen    = uint16(0x00c6)
 	AddrStack                = uint16(0x0100)
 	AddrKeyboardBuffer       = uint16(0x0277)
 	AddrBorderColor          = uint16(0xd020)
 	AddrBackgroundColor      = uint16(0xd021)
+	AddrKernalTalk           = uint16(0xed09)
+	AddrKernalListen         = uint16(0xed0c)
+	AddrKernalSecond         = uint16(0xedb9)
+	AddrKernalTalkSA         = uint16(0xedc7)
+	AddrKernalCIOUT          = uint16(0xeddd)
+	AddrKernalUntalk         = uint16(0xedef)
+	AddrKernalUnlisten       = uint16(0xedfe)
+	AddrKernalACPTR          = uint16(0xee13)
+	AddrKernalLoad           = uint16(0xf4a5)
+	AddrKernalSave           = uint16(0xf5ed)
 	AddrResetVector          = uint16(0xfffc)
 	AddrISR                  = uint16(0xff48)
 	AddrNmiVector            = uint16(0xfffa)
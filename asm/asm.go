@@ -0,0 +1,488 @@
+// Package asm is a two-pass cross assembler for the 6502. Opcodes come
+// from the tables used by the emulator.
+//
+// Source lines have an optional label, an instruction, directive or
+// macro call, and an optional comment that starts with a semicolon. A
+// label starts in the first column or ends with a colon. Directives start
+// with a period, which may be left out, so that sources written for AS65
+// can be assembled as well.
+package asm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blackchip-org/mach85"
+)
+
+const maxDepth = 16
+
+// Error is a problem found in the source.
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Err)
+}
+
+// Program is the result of assembling a source file.
+type Program struct {
+	Origin  uint16 // lowest address written
+	Code    []uint8
+	Start   uint16 // given with .end or the origin
+	Symbols []Symbol
+	Listing []Line
+}
+
+type Symbol struct {
+	Name  string
+	Value int
+}
+
+// Line is a source line in the listing with the bytes it produced.
+type Line struct {
+	File      string
+	Line      int
+	Addressed bool
+	Address   uint16
+	Bytes     []uint8
+	Source    string
+}
+
+type segment struct {
+	pc  int
+	bss bool // space is reserved but nothing is written
+}
+
+type macro struct {
+	name   string
+	params []string
+	body   []string
+}
+
+type cond struct {
+	active bool
+	parent bool
+	taken  bool
+}
+
+// Assembler keeps the state of a pass through the source.
+type Assembler struct {
+	// ReadFile reads source files and can be replaced to assemble sources
+	// that are not on disk.
+	ReadFile func(filename string) ([]uint8, error)
+
+	pass       int
+	symbols    map[string]int
+	prev       map[string]int
+	macros     map[string]*macro
+	segments   map[string]*segment
+	seg        *segment
+	image      [0x10000]uint8
+	written    [0x10000]bool
+	wide       map[int]bool
+	insts      int
+	conds      []cond
+	def        *macro
+	expansions int
+	depth      int
+	ended      bool
+	start      int
+	listing    []Line
+	line       *Line
+}
+
+func New() *Assembler {
+	return &Assembler{ReadFile: ioutil.ReadFile}
+}
+
+// Assemble assembles a source file and those it includes.
+func Assemble(filename string) (*Program, error) {
+	return New().Assemble(filename)
+}
+
+func (a *Assembler) Assemble(filename string) (*Program, error) {
+	a.wide = map[int]bool{}
+	for a.pass = 1; a.pass <= 2; a.pass++ {
+		a.prev = a.symbols
+		a.symbols = map[string]int{}
+		a.macros = map[string]*macro{}
+		a.segments = map[string]*segment{
+			"code": {},
+			"data": {},
+			"bss":  {bss: true},
+		}
+		a.seg = a.segments["code"]
+		a.insts = 0
+		a.conds = nil
+		a.def = nil
+		a.expansions = 0
+		a.ended = false
+		a.start = -1
+		a.listing = nil
+		if err := a.include(filename); err != nil {
+			return nil, err
+		}
+		if a.def != nil {
+			return nil, fmt.Errorf("%v: missing endm for macro %v", filename, a.def.name)
+		}
+		if len(a.conds) > 0 {
+			return nil, fmt.Errorf("%v: missing endif", filename)
+		}
+	}
+	return a.program(), nil
+}
+
+func (a *Assembler) program() *Program {
+	p := &Program{Listing: a.listing}
+	first, last := -1, -1
+	for addr, w := range a.written {
+		if w {
+			if first < 0 {
+				first = addr
+			}
+			last = addr
+		}
+	}
+	if first >= 0 {
+		p.Origin = uint16(first)
+		p.Code = append([]uint8{}, a.image[first:last+1]...)
+	}
+	p.Start = p.Origin
+	if a.start >= 0 {
+		p.Start = uint16(a.start)
+	}
+	for name, value := range a.symbols {
+		p.Symbols = append(p.Symbols, Symbol{Name: name, Value: value})
+	}
+	sort.Slice(p.Symbols, func(i, j int) bool {
+		si, sj := p.Symbols[i], p.Symbols[j]
+		if si.Value != sj.Value {
+			return si.Value < sj.Value
+		}
+		return si.Name < sj.Name
+	})
+	return p
+}
+
+func (a *Assembler) include(filename string) error {
+	if a.depth >= maxDepth {
+		return fmt.Errorf("include nested too deeply: %v", filename)
+	}
+	data, err := a.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	text := strings.Replace(string(data), "\r\n", "\n", -1)
+	a.depth++
+	defer func() { a.depth-- }()
+	for i, line := range strings.Split(text, "\n") {
+		if a.ended {
+			return nil
+		}
+		if err := a.source(filename, i+1, line); err != nil {
+			if _, ok := err.(*Error); ok {
+				return err
+			}
+			return &Error{File: filename, Line: i + 1, Err: err}
+		}
+	}
+	return nil
+}
+
+// source assembles a line and adds it to the listing.
+func (a *Assembler) source(file string, n int, text string) error {
+	line := &Line{File: file, Line: n, Source: text}
+	a.line = line
+	// Lines from a macro expansion are listed after the line that calls
+	// the macro.
+	index := len(a.listing)
+	if a.pass == 2 {
+		a.listing = append(a.listing, Line{})
+	}
+	err := a.statement(file, text)
+	if a.pass == 2 {
+		a.listing[index] = *line
+	}
+	return err
+}
+
+var assignment = regexp.MustCompile(`^\s*([A-Za-z_.@][\w.@]*|\*)\s*=(.*)$`)
+
+func (a *Assembler) statement(file string, text string) error {
+	code := stripComment(text)
+	if a.def != nil {
+		return a.defineLine(code, text)
+	}
+	label, op, operand := a.split(code)
+	switch op {
+	case "if", "else", "endif":
+		return a.conditional(op, operand)
+	}
+	if !a.active() {
+		return nil
+	}
+	if op == "=" || op == "equ" {
+		return a.assign(label, operand)
+	}
+	if op == "macro" && label != "" {
+		return a.defineMacro(label, operand)
+	}
+	if label != "" {
+		if err := a.define(label, a.seg.pc); err != nil {
+			return err
+		}
+		a.line.Addressed = true
+		a.line.Address = uint16(a.seg.pc)
+	}
+	if op == "" {
+		return nil
+	}
+	if d, ok := directives[op]; ok {
+		return d(a, file, operand)
+	}
+	if m, ok := a.macros[op]; ok {
+		return a.expand(file, m, operand)
+	}
+	if inst, ok := mach85.LookupInstruction(op); ok {
+		return a.instruction(inst, operand)
+	}
+	return fmt.Errorf("unknown instruction: %v", op)
+}
+
+// split separates a line into its label, operation and operand. The
+// operation is in lower case without the period of a directive.
+func (a *Assembler) split(code string) (string, string, string) {
+	if m := assignment.FindStringSubmatch(code); m != nil {
+		return m[1], "=", strings.TrimSpace(m[2])
+	}
+	label := ""
+	rest := code
+	if code != "" && code[0] != ' ' && code[0] != '\t' {
+		word, after := firstWord(code)
+		if strings.HasSuffix(word, ":") || !a.isKeyword(word) {
+			label, rest = strings.TrimSuffix(word, ":"), after
+		}
+	}
+	word, after := firstWord(rest)
+	if label == "" && strings.HasSuffix(word, ":") {
+		label = strings.TrimSuffix(word, ":")
+		word, after = firstWord(after)
+	}
+	op := strings.TrimPrefix(strings.ToLower(word), ".")
+	return label, op, strings.TrimSpace(after)
+}
+
+func (a *Assembler) isKeyword(word string) bool {
+	lower := strings.ToLower(word)
+	name := strings.TrimPrefix(lower, ".")
+	if _, ok := directives[name]; ok {
+		return true
+	}
+	if _, ok := a.macros[name]; ok {
+		return true
+	}
+	_, ok := mach85.LookupInstruction(lower)
+	return ok
+}
+
+func firstWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// stripComment removes the comment from a line, ignoring semicolons in
+// quotes.
+func stripComment(text string) string {
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+		case ch == '"':
+			quote = ch
+		case ch == '\'':
+			// A character constant such as ';'
+			if i+2 < len(text) && text[i+2] == '\'' {
+				i += 2
+			} else {
+				quote = ch
+			}
+		case ch == ';':
+			return strings.TrimRight(text[:i], " \t")
+		}
+	}
+	return strings.TrimRight(text, " \t")
+}
+
+// splitArgs splits a list at the commas that are not in quotes.
+func splitArgs(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	args := []string{}
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote != 0:
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == ',':
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func (a *Assembler) lookup(name string) (int, bool) {
+	if value, ok := a.symbols[name]; ok {
+		return value, true
+	}
+	value, ok := a.prev[name]
+	return value, ok
+}
+
+// eval returns the value of an expression. In the first pass the value
+// is unknown, and known is false, when it uses a symbol that has not been
+// defined yet. Undefined symbols are an error in the second pass.
+func (a *Assembler) eval(src string) (value int, known bool, err error) {
+	value, unknown, err := Eval(src, a.seg.pc, a.lookup)
+	if err != nil {
+		return 0, false, err
+	}
+	if unknown != "" {
+		if a.pass == 2 {
+			return 0, false, fmt.Errorf("undefined symbol: %v", unknown)
+		}
+		return 0, false, nil
+	}
+	return value, true, nil
+}
+
+// evalNow returns the value of an expression that must be known in the
+// first pass.
+func (a *Assembler) evalNow(src string) (int, error) {
+	value, unknown, err := Eval(src, a.seg.pc, a.lookup)
+	if err != nil {
+		return 0, err
+	}
+	if unknown != "" {
+		return 0, fmt.Errorf("undefined symbol: %v", unknown)
+	}
+	return value, nil
+}
+
+func (a *Assembler) define(name string, value int) error {
+	if _, exists := a.symbols[name]; exists {
+		return fmt.Errorf("symbol already defined: %v", name)
+	}
+	if prev, ok := a.prev[name]; ok && a.pass == 2 && prev != value {
+		return fmt.Errorf("value of %v changed between passes", name)
+	}
+	a.symbols[name] = value
+	return nil
+}
+
+func (a *Assembler) assign(name string, operand string) error {
+	if name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if name == "*" {
+		return a.org(operand)
+	}
+	value, known, err := a.eval(operand)
+	if err != nil || !known {
+		return err
+	}
+	a.line.Addressed = true
+	a.line.Address = uint16(value)
+	return a.define(name, value)
+}
+
+func (a *Assembler) org(operand string) error {
+	value, err := a.evalNow(operand)
+	if err != nil {
+		return err
+	}
+	if value < 0 || value > 0xffff {
+		return fmt.Errorf("invalid address: %v", operand)
+	}
+	a.seg.pc = value
+	a.line.Addressed = true
+	a.line.Address = uint16(value)
+	return nil
+}
+
+// emit writes bytes at the program counter.
+func (a *Assembler) emit(values ...uint8) error {
+	if !a.line.Addressed {
+		a.line.Addressed = true
+		a.line.Address = uint16(a.seg.pc)
+	}
+	for _, v := range values {
+		if a.seg.pc > 0xffff {
+			return fmt.Errorf("program counter past $ffff")
+		}
+		if a.seg.bss {
+			return fmt.Errorf("code in bss segment")
+		}
+		if a.pass == 2 {
+			a.image[a.seg.pc] = v
+			a.written[a.seg.pc] = true
+			a.line.Bytes = append(a.line.Bytes, v)
+		}
+		a.seg.pc++
+	}
+	return nil
+}
+
+func (a *Assembler) active() bool {
+	return len(a.conds) == 0 || a.conds[len(a.conds)-1].active
+}
+
+func (a *Assembler) conditional(op string, operand string) error {
+	switch op {
+	case "if":
+		parent := a.active()
+		c := cond{parent: parent}
+		if parent {
+			value, err := a.evalNow(operand)
+			if err != nil {
+				return err
+			}
+			c.active = value != 0
+			c.taken = c.active
+		}
+		a.conds = append(a.conds, c)
+	case "else":
+		if len(a.conds) == 0 {
+			return fmt.Errorf("else without if")
+		}
+		c := &a.conds[len(a.conds)-1]
+		c.active = c.parent && !c.taken
+		c.taken = true
+	case "endif":
+		if len(a.conds) == 0 {
+			return fmt.Errorf("endif without if")
+		}
+		a.conds = a.conds[:len(a.conds)-1]
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackchip-org/mach85"
+)
+
+func TestDecimalTest(t *testing.T) {
+	prog, err := Assemble("test/6502_decimal_test.a65")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("test/6502_decimal_test.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prog.Origin != 0x200 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0x200, prog.Origin)
+	}
+	if !bytes.Equal(want, prog.Code) {
+		t.Errorf("\n want: % x \n have: % x \n", want, prog.Code)
+	}
+}
+
+// The decimal mode test is run on the emulated CPU, which stops at the
+// illegal opcode used to end the test.
+func TestRunDecimalTest(t *testing.T) {
+	prog, err := Assemble("test/6502_decimal_test.a65")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := mach85.NewMemory(mach85.NewRAM(0x10000))
+	mem.Import(prog.Origin, prog.Code)
+	cpu := mach85.New6510(mem)
+	cpu.PC = prog.Start - 1
+	for i := 0; i < 10000000; i++ {
+		if err := cpu.Next(); err != nil {
+			if err.Error() != "illegal opcode: $db" {
+				t.Fatal(err)
+			}
+			if have := mem.Load(0x0b); have != 0 {
+				t.Errorf("\n want: %v \n have: %v \n", 0, have)
+			}
+			return
+		}
+	}
+	t.Errorf("test did not finish")
+}
+
+// testFiles assembles sources held in memory. The main file is "main.s".
+func testFiles(files map[string]string) (*Program, error) {
+	a := New()
+	a.ReadFile = func(name string) ([]uint8, error) {
+		text, ok := files[name]
+		if !ok {
+			return nil, errors.New("file not found: " + name)
+		}
+		return []uint8(text), nil
+	}
+	return a.Assemble("main.s")
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []uint8
+	}{
+		{"labels", `
+		.org $c000
+start:	ldx #0
+loop	inx
+		bne loop
+		jmp start`,
+			[]uint8{0xa2, 0x00, 0xe8, 0xd0, 0xfd, 0x4c, 0x00, 0xc0}},
+		{"forward zero page", `
+		* = $1000
+		lda value
+		lda value,x
+value = $10`,
+			[]uint8{0xad, 0x10, 0x00, 0xbd, 0x10, 0x00}},
+		{"backward zero page", `
+value = $10
+		* = $1000
+		lda value
+		lda value,x
+		lda (value),y
+		lda (value,x)
+		ldx value,y`,
+			[]uint8{0xa5, 0x10, 0xb5, 0x10, 0xb1, 0x10, 0xa1, 0x10, 0xb6, 0x10}},
+		{"expressions", `
+		.org $1000
+		lda #<vector
+		ldx #>vector
+		.byte 1+2*3, (1+2)*3, %1010, 'a', -1, ~0 & $ff
+		.word vector, * + 2
+vector	.byte $ea`,
+			[]uint8{0xa9, 0x0e, 0xa2, 0x10, 0x07, 0x09, 0x0a, 0x61, 0xff, 0xff,
+				0x0e, 0x10, 0x0e, 0x10, 0xea}},
+		{"indirect", `
+		.org $1000
+		jmp ($fffc)
+		asl
+		asl a`,
+			[]uint8{0x6c, 0xfc, 0xff, 0x0a, 0x0a}},
+		{"text", `
+		.org $1000
+		.text "Hi!", 13
+		.screen "Hi!"`,
+			[]uint8{0x48, 0x49, 0x21, 0x0d, 0x08, 0x09, 0x21}},
+		{"reserve", `
+		.org $1000
+		.byte 1
+		.ds 2
+		.ds 2, $ff
+		.byte 2`,
+			[]uint8{0x01, 0x00, 0x00, 0xff, 0xff, 0x02}},
+		{"segments", `
+		bss
+		org $fb
+ptr		ds 2
+		code
+		org $1000
+		sta (ptr),y`,
+			[]uint8{0x91, 0xfb}},
+		{"conditionals", `
+debug = 1
+		.org $1000
+		.if debug
+		.byte 1
+		.if debug = 2
+		.byte 2
+		.else
+		.byte 3
+		.endif
+		.else
+		.byte 4
+		.endif`,
+			[]uint8{0x01, 0x03}},
+		{"macros", `
+		.macro add16 dst, value
+		clc
+		lda \dst
+		adc #<\value
+		sta \dst
+		.endm
+wait	macro
+loop\@	dex
+		bne loop\@
+		endm
+		.org $1000
+		add16 $fb, $0102
+		wait
+		wait`,
+			[]uint8{0x18, 0xa5, 0xfb, 0x69, 0x02, 0x85, 0xfb,
+				0xca, 0xd0, 0xfd, 0xca, 0xd0, 0xfd}},
+		{"end", `
+		.org $1000
+		rts
+		.end
+		brk`,
+			[]uint8{0x60}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prog, err := testFiles(map[string]string{"main.s": test.src})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(test.want, prog.Code) {
+				t.Errorf("\n want: % x \n have: % x \n", test.want, prog.Code)
+			}
+		})
+	}
+}
+
+func TestInclude(t *testing.T) {
+	prog, err := testFiles(map[string]string{
+		"main.s":       "\t.org $1000\n\t.include \"lib/chrout.s\"\n\tjsr chrout",
+		"lib/chrout.s": "chrout = $ffd2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{0x20, 0xd2, 0xff}
+	if !bytes.Equal(want, prog.Code) {
+		t.Errorf("\n want: % x \n have: % x \n", want, prog.Code)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"\tfoo", "main.s:1: unknown instruction: foo"},
+		{"\tlda", "main.s:1: operand required: lda"},
+		{"\tlda #$100", "main.s:1: value out of range: $100"},
+		{"\tjmp $10,y", "main.s:1: invalid addressing mode for jmp: $10,y"},
+		{"\tlda (1000),y", "main.s:1: address not in zero page: 1000"},
+		{"\tlda missing", "main.s:1: undefined symbol: missing"},
+		{"x\tnop\nx\tnop", "main.s:2: symbol already defined: x"},
+		{"\t.org $1000\n\tbne $2000", "main.s:2: branch out of range: $2000"},
+		{"\t.byte 1/0", "main.s:1: division by zero"},
+		{"\t.if 1", "main.s: missing endif"},
+		{"\t.endif", "main.s:1: endif without if"},
+		{"\t.macro m", "main.s: missing endm for macro m"},
+		{"\t.include \"none.s\"", "main.s:1: file not found: none.s"},
+		{"\tbss\n\tnop", "main.s:2: code in bss segment"},
+		{"\t.macro m\n\tfoo\n\t.endm\n\tm", "main.s:4: in macro m: unknown instruction: foo"},
+	}
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			_, err := testFiles(map[string]string{"main.s": test.src})
+			if err == nil || err.Error() != test.err {
+				t.Errorf("\n want: %v \n have: %v \n", test.err, err)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	symbols := map[string]int{"a": 2, "b": 3}
+	lookup := func(name string) (int, bool) {
+		v, ok := symbols[name]
+		return v, ok
+	}
+	tests := []struct {
+		expr    string
+		want    int
+		unknown string
+	}{
+		{"1 + 2 * 3", 7, ""},
+		{"a << b", 16, ""},
+		{"$ff & ~$0f | 1", 0xf1, ""},
+		{"<$1234", 0x34, ""},
+		{">$1234", 0x12, ""},
+		{"a < b", 1, ""},
+		{"a = b", 0, ""},
+		{"a != b", 1, ""},
+		{"[a + 1] * 2", 6, ""},
+		{"* + 1", 0x1001, ""},
+		{"-a", -2, ""},
+		{"0x10 + %11", 19, ""},
+		{"c + 1", 1, "c"},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			have, unknown, err := Eval(test.expr, 0x1000, lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != test.want || unknown != test.unknown {
+				t.Errorf("\n want: %v %v \n have: %v %v \n", test.want, test.unknown, have, unknown)
+			}
+		})
+	}
+}
+
+func TestOutput(t *testing.T) {
+	prog, err := testFiles(map[string]string{"main.s": "\t.org $c000\nstart\tlda #1 ; one\n\t.byte 1, 2, 3, 4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listing, symbols bytes.Buffer
+	prog.WriteListing(&listing)
+	prog.WriteSymbols(&symbols)
+	tests := []struct {
+		name string
+		want interface{}
+		have interface{}
+	}{
+		{"prg", []uint8{0x00, 0xc0, 0xa9, 0x01, 0x01, 0x02, 0x03, 0x04}, prog.PRG()},
+		{"listing", []string{
+			"    1  c000            \t.org $c000",
+			"    2  c000  a9 01     start\tlda #1 ; one",
+			"    3  c002  01 02 03  \t.byte 1, 2, 3, 4",
+			"       c005  04",
+			"",
+		}, strings.Split(listing.String(), "\n")},
+		{"symbols", "start            = $c000\n", symbols.String()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.want, test.have) {
+				t.Errorf("\n want: %q \n have: %q \n", test.want, test.have)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package asm
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/blackchip-org/mach85"
+)
+
+type directive func(a *Assembler, file string, operand string) error
+
+// Directives by name. AS65 names are included where they differ.
+var directives map[string]directive
+
+func init() {
+	directives = map[string]directive{
+		"org":     func(a *Assembler, _ string, operand string) error { return a.org(operand) },
+		"byte":    (*Assembler).byteDirective,
+		"db":      (*Assembler).byteDirective,
+		"word":    (*Assembler).wordDirective,
+		"dw":      (*Assembler).wordDirective,
+		"text":    (*Assembler).textDirective,
+		"screen":  (*Assembler).screenDirective,
+		"ds":      (*Assembler).reserve,
+		"res":     (*Assembler).reserve,
+		"include": (*Assembler).includeDirective,
+		"macro":   (*Assembler).macroDirective,
+		"endm":    func(*Assembler, string, string) error { return fmt.Errorf("endm without macro") },
+		"if":      nil, // handled when skipping lines
+		"else":    nil,
+		"endif":   nil,
+		"equ":     nil, // handled with the label
+		"end":     (*Assembler).end,
+		"code":    segmentDirective("code"),
+		"data":    segmentDirective("data"),
+		"bss":     segmentDirective("bss"),
+	}
+}
+
+func (a *Assembler) byteDirective(_ string, operand string) error {
+	return a.data(operand, func(ch byte) (uint8, bool) { return ch, true })
+}
+
+// textDirective encodes strings in PETSCII as typed on the C64 keyboard in
+// upper case mode.
+func (a *Assembler) textDirective(_ string, operand string) error {
+	return a.data(operand, petscii)
+}
+
+// screenDirective encodes strings as screen codes to be stored directly
+// in screen memory.
+func (a *Assembler) screenDirective(_ string, operand string) error {
+	return a.data(operand, func(ch byte) (uint8, bool) {
+		code, ok := petscii(ch)
+		return screenCode(code), ok
+	})
+}
+
+func petscii(ch byte) (uint8, bool) {
+	return mach85.PetsciiUnshiftedEncoder(rune(ch))
+}
+
+func screenCode(code uint8) uint8 {
+	switch {
+	case code < 0x20:
+		return code + 0x80
+	case code < 0x40:
+		return code
+	case code < 0x60:
+		return code - 0x40
+	case code < 0x80:
+		return code - 0x20
+	case code < 0xa0:
+		return code + 0x40
+	case code < 0xc0:
+		return code - 0x40
+	case code < 0xff:
+		return code - 0x80
+	}
+	return 0x5e // pi
+}
+
+// data emits a list of bytes where strings are converted with the
+// encoder.
+func (a *Assembler) data(operand string, encode func(byte) (uint8, bool)) error {
+	args := splitArgs(operand)
+	if len(args) == 0 {
+		return fmt.Errorf("missing value")
+	}
+	for _, arg := range args {
+		if len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+			for _, ch := range []byte(arg[1 : len(arg)-1]) {
+				code, ok := encode(ch)
+				if !ok {
+					return fmt.Errorf("unable to encode character: %q", ch)
+				}
+				if err := a.emit(code); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		value, known, err := a.eval(arg)
+		if err != nil {
+			return err
+		}
+		if known && (value < -0x80 || value > 0xff) {
+			return fmt.Errorf("value out of range: %v", arg)
+		}
+		if err := a.emit(uint8(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Assembler) wordDirective(_ string, operand string) error {
+	args := splitArgs(operand)
+	if len(args) == 0 {
+		return fmt.Errorf("missing value")
+	}
+	for _, arg := range args {
+		value, known, err := a.eval(arg)
+		if err != nil {
+			return err
+		}
+		if known && (value < -0x8000 || value > 0xffff) {
+			return fmt.Errorf("value out of range: %v", arg)
+		}
+		if err := a.emit(uint8(value), uint8(value>>8)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserve skips the number of bytes given, or fills them if a value is
+// also given.
+func (a *Assembler) reserve(_ string, operand string) error {
+	args := splitArgs(operand)
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("invalid operand: %v", operand)
+	}
+	n, err := a.evalNow(args[0])
+	if err != nil {
+		return err
+	}
+	if n < 0 || a.seg.pc+n > 0x10000 {
+		return fmt.Errorf("invalid size: %v", args[0])
+	}
+	if len(args) == 1 {
+		a.line.Addressed = true
+		a.line.Address = uint16(a.seg.pc)
+		a.seg.pc += n
+		return nil
+	}
+	fill, known, err := a.eval(args[1])
+	if err != nil {
+		return err
+	}
+	if known && (fill < -0x80 || fill > 0xff) {
+		return fmt.Errorf("value out of range: %v", args[1])
+	}
+	for i := 0; i < n; i++ {
+		if err := a.emit(uint8(fill)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includeDirective assembles another file. The path is relative to the
+// file with the directive.
+func (a *Assembler) includeDirective(file string, operand string) error {
+	name := strings.Trim(operand, `"'`)
+	if name == "" {
+		return fmt.Errorf("missing file name")
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(filepath.Dir(file), name)
+	}
+	return a.include(name)
+}
+
+// end stops assembling. The address given is where the program starts.
+func (a *Assembler) end(_ string, operand string) error {
+	if operand != "" {
+		value, known, err := a.eval(operand)
+		if err != nil {
+			return err
+		}
+		if known {
+			a.start = value & 0xffff
+		}
+	}
+	a.ended = true
+	return nil
+}
+
+func segmentDirective(name string) directive {
+	return func(a *Assembler, _ string, operand string) error {
+		if operand != "" {
+			return fmt.Errorf("invalid operand: %v", operand)
+		}
+		a.seg = a.segments[name]
+		return nil
+	}
+}
+
+// macroDirective starts a macro with the name given as the first operand
+// instead of the label.
+func (a *Assembler) macroDirective(_ string, operand string) error {
+	name, params := firstWord(operand)
+	return a.defineMacro(name, params)
+}
+
+func (a *Assembler) defineMacro(name string, operand string) error {
+	if name == "" {
+		return fmt.Errorf("missing macro name")
+	}
+	name = strings.ToLower(name)
+	if _, exists := a.macros[name]; exists {
+		return fmt.Errorf("macro already defined: %v", name)
+	}
+	if _, exists := directives[name]; exists {
+		return fmt.Errorf("invalid macro name: %v", name)
+	}
+	if _, exists := mach85.LookupInstruction(name); exists {
+		return fmt.Errorf("invalid macro name: %v", name)
+	}
+	a.def = &macro{name: name, params: splitArgs(operand)}
+	return nil
+}
+
+// defineLine adds a line to the macro being defined.
+func (a *Assembler) defineLine(code string, text string) error {
+	fields := strings.Fields(code)
+	if len(fields) > 0 && strings.TrimPrefix(strings.ToLower(fields[0]), ".") == "endm" {
+		a.macros[a.def.name] = a.def
+		a.def = nil
+		return nil
+	}
+	a.def.body = append(a.def.body, text)
+	return nil
+}
+
+// expand assembles the body of a macro. Parameters are referred to in
+// the body as \1 to \9 or by name with a backslash, and \@ is replaced
+// with a number unique to each expansion to make labels.
+func (a *Assembler) expand(file string, m *macro, operand string) error {
+	if a.depth >= maxDepth {
+		return fmt.Errorf("macro nested too deeply: %v", m.name)
+	}
+	args := splitArgs(operand)
+	if len(args) > len(m.params) && len(args) > 9 {
+		return fmt.Errorf("too many arguments for macro %v", m.name)
+	}
+	a.expansions++
+	pairs := []string{`\@`, fmt.Sprint(a.expansions)}
+	for i := 1; i <= 9; i++ {
+		arg := ""
+		if i <= len(args) {
+			arg = args[i-1]
+		}
+		pairs = append(pairs, fmt.Sprintf(`\%v`, i), arg)
+	}
+	// Longest names first so that one is not replaced as part of another
+	params := append([]string{}, m.params...)
+	sortByLength(params)
+	for _, p := range params {
+		arg := ""
+		for i, name := range m.params {
+			if name == p && i < len(args) {
+				arg = args[i]
+			}
+		}
+		pairs = append(pairs, `\`+p, arg)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	a.depth++
+	defer func() { a.depth-- }()
+	n := a.line.Line
+	for _, text := range m.body {
+		if a.ended {
+			return nil
+		}
+		if err := a.source(file, n, replacer.Replace(text)); err != nil {
+			return fmt.Errorf("in macro %v: %v", m.name, err)
+		}
+	}
+	return nil
+}
+
+func sortByLength(names []string) {
+	for i := 1; i < len(names); i++ {
+		for j := i; j > 0 && len(names[j]) > len(names[j-1]); j-- {
+			names[j], names[j-1] = names[j-1], names[j]
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Binary operators from the lowest to the highest precedence
+var binaryOps = []struct {
+	op   string
+	prec int
+}{
+	// Two character operators are listed first so that they are matched
+	// before the single character ones.
+	{"==", 1}, {"!=", 1}, {"<>", 1}, {"<=", 1}, {">=", 1},
+	{"<<", 5}, {">>", 5},
+	{"=", 1}, {"<", 1}, {">", 1},
+	{"|", 2}, {"^", 3}, {"&", 4},
+	{"+", 6}, {"-", 6},
+	{"*", 7}, {"/", 7}, {"%", 7},
+}
+
+// expr parses an expression. Symbols that are not defined yet make the
+// value unknown, which is allowed in the first pass.
+type expr struct {
+	src     string
+	pos     int
+	pc      int
+	lookup  func(name string) (int, bool)
+	unknown string
+}
+
+// Eval evaluates an expression where * is the program counter given and
+// symbols are found with the lookup function. Numbers are decimal unless
+// prefixed with $ for hex or % for binary, and 'c' is the ASCII code of
+// a character. The result is unknown if a symbol is not found, and the
+// name of the first symbol not found is returned.
+func Eval(src string, pc int, lookup func(string) (int, bool)) (int, string, error) {
+	e := &expr{src: src, pc: pc, lookup: lookup}
+	value, err := e.parse(1)
+	if err != nil {
+		return 0, "", err
+	}
+	e.skipSpace()
+	if e.pos < len(e.src) {
+		return 0, "", fmt.Errorf("invalid expression: %v", src)
+	}
+	return value, e.unknown, nil
+}
+
+func (e *expr) skipSpace() {
+	for e.pos < len(e.src) && (e.src[e.pos] == ' ' || e.src[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+func (e *expr) parse(minPrec int) (int, error) {
+	left, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		e.skipSpace()
+		op, prec := e.peekBinary()
+		if op == "" || prec < minPrec {
+			return left, nil
+		}
+		e.pos += len(op)
+		right, err := e.parse(prec + 1)
+		if err != nil {
+			return 0, err
+		}
+		left, err = e.apply(op, left, right)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (e *expr) peekBinary() (string, int) {
+	rest := e.src[e.pos:]
+	for _, b := range binaryOps {
+		if strings.HasPrefix(rest, b.op) {
+			return b.op, b.prec
+		}
+	}
+	return "", 0
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (e *expr) apply(op string, a int, b int) (int, error) {
+	switch op {
+	case "=", "==":
+		return boolValue(a == b), nil
+	case "!=", "<>":
+		return boolValue(a != b), nil
+	case "<":
+		return boolValue(a < b), nil
+	case ">":
+		return boolValue(a > b), nil
+	case "<=":
+		return boolValue(a <= b), nil
+	case ">=":
+		return boolValue(a >= b), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "<<":
+		return a << uint(b), nil
+	case ">>":
+		return a >> uint(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	// Division
+	if b == 0 {
+		if e.unknown != "" {
+			return 0, nil
+		}
+		return 0, errors.New("division by zero")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return a % b, nil
+}
+
+func (e *expr) unary() (int, error) {
+	e.skipSpace()
+	if e.pos >= len(e.src) {
+		return 0, fmt.Errorf("invalid expression: %v", e.src)
+	}
+	ch := e.src[e.pos]
+	switch ch {
+	case '-', '~', '!', '<', '>':
+		e.pos++
+		value, err := e.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch ch {
+		case '-':
+			return -value, nil
+		case '~':
+			return ^value, nil
+		case '!':
+			return boolValue(value == 0), nil
+		case '<':
+			return value & 0xff, nil
+		}
+		return value >> 8 & 0xff, nil
+	}
+	return e.primary()
+}
+
+func (e *expr) primary() (int, error) {
+	ch := e.src[e.pos]
+	switch {
+	case ch == '(' || ch == '[':
+		closing := map[byte]byte{'(': ')', '[': ']'}[ch]
+		e.pos++
+		value, err := e.parse(1)
+		if err != nil {
+			return 0, err
+		}
+		e.skipSpace()
+		if e.pos >= len(e.src) || e.src[e.pos] != closing {
+			return 0, fmt.Errorf("missing %c: %v", closing, e.src)
+		}
+		e.pos++
+		return value, nil
+	case ch == '*':
+		e.pos++
+		return e.pc, nil
+	case ch == '\'':
+		if e.pos+2 >= len(e.src) || e.src[e.pos+2] != '\'' {
+			return 0, fmt.Errorf("invalid character: %v", e.src[e.pos:])
+		}
+		value := int(e.src[e.pos+1])
+		e.pos += 3
+		return value, nil
+	case ch == '$':
+		return e.number(1, 16, isHexDigit)
+	case ch == '%':
+		return e.number(1, 2, func(c byte) bool { return c == '0' || c == '1' })
+	case ch >= '0' && ch <= '9':
+		if strings.HasPrefix(e.src[e.pos:], "0x") {
+			return e.number(2, 16, isHexDigit)
+		}
+		return e.number(0, 10, func(c byte) bool { return c >= '0' && c <= '9' })
+	case isSymbolStart(ch):
+		start := e.pos
+		for e.pos < len(e.src) && isSymbolChar(e.src[e.pos]) {
+			e.pos++
+		}
+		name := e.src[start:e.pos]
+		value, ok := e.lookup(name)
+		if !ok && e.unknown == "" {
+			e.unknown = name
+		}
+		return value, nil
+	}
+	return 0, fmt.Errorf("invalid expression: %v", e.src)
+}
+
+func (e *expr) number(prefix int, base int, valid func(byte) bool) (int, error) {
+	e.pos += prefix
+	start := e.pos
+	for e.pos < len(e.src) && valid(e.src[e.pos]) {
+		e.pos++
+	}
+	value, err := strconv.ParseInt(e.src[start:e.pos], base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %v", e.src[start-prefix:e.pos])
+	}
+	return int(value), nil
+}
+
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isSymbolStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.' || c == '@'
+}
+
+func isSymbolChar(c byte) bool {
+	return isSymbolStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,102 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blackchip-org/mach85"
+)
+
+// operandModes returns the addressing modes the operand could be written
+// for, in order of preference, along with the expression for the value.
+func operandModes(inst mach85.Instruction, operand string) ([]mach85.Mode, string) {
+	lower := strings.ToLower(operand)
+	_, indirect := mach85.LookupOpcode(inst, mach85.Indirect)
+	switch {
+	case lower == "a":
+		return []mach85.Mode{mach85.Accumulator}, ""
+	case strings.HasPrefix(lower, "#"):
+		return []mach85.Mode{mach85.Immediate}, operand[1:]
+	case strings.HasPrefix(lower, "(") && strings.HasSuffix(strings.Replace(lower, " ", "", -1), ",x)"):
+		expr := operand[1:strings.LastIndex(operand, ",")]
+		return []mach85.Mode{mach85.IndirectX}, expr
+	case strings.HasPrefix(lower, "(") && strings.HasSuffix(strings.Replace(lower, " ", "", -1), "),y"):
+		expr := operand[1:strings.LastIndex(operand, ")")]
+		return []mach85.Mode{mach85.IndirectY}, expr
+	case indirect && strings.HasPrefix(lower, "(") && strings.HasSuffix(lower, ")"):
+		return []mach85.Mode{mach85.Indirect}, operand[1 : len(operand)-1]
+	case strings.HasSuffix(strings.Replace(lower, " ", "", -1), ",x"):
+		expr := operand[:strings.LastIndex(operand, ",")]
+		return []mach85.Mode{mach85.ZeroPageX, mach85.AbsoluteX}, expr
+	case strings.HasSuffix(strings.Replace(lower, " ", "", -1), ",y"):
+		expr := operand[:strings.LastIndex(operand, ",")]
+		return []mach85.Mode{mach85.ZeroPageY, mach85.AbsoluteY}, expr
+	}
+	return []mach85.Mode{mach85.Relative, mach85.ZeroPage, mach85.Absolute}, operand
+}
+
+// instruction emits an instruction. Zero page addressing is used when the
+// value is known to fit. If a value is not known in the first pass,
+// absolute addressing is used in both passes so that the size does not
+// change.
+func (a *Assembler) instruction(inst mach85.Instruction, operand string) error {
+	id := a.insts
+	a.insts++
+	if operand == "" {
+		for _, mode := range []mach85.Mode{mach85.Implied, mach85.Accumulator} {
+			if opcode, ok := mach85.LookupOpcode(inst, mode); ok {
+				return a.emit(opcode)
+			}
+		}
+		return fmt.Errorf("operand required: %v", inst)
+	}
+	modes, expr := operandModes(inst, operand)
+	value, known := 0, true
+	if expr != "" {
+		var err error
+		value, known, err = a.eval(expr)
+		if err != nil {
+			return err
+		}
+	}
+	if !known {
+		a.wide[id] = true
+	}
+	wide := a.wide[id]
+	for _, mode := range modes {
+		opcode, ok := mach85.LookupOpcode(inst, mode)
+		if !ok {
+			continue
+		}
+		switch mode {
+		case mach85.Accumulator:
+			return a.emit(opcode)
+		case mach85.Immediate:
+			if known && (value < -0x80 || value > 0xff) {
+				return fmt.Errorf("value out of range: %v", expr)
+			}
+			return a.emit(opcode, uint8(value))
+		case mach85.ZeroPage, mach85.ZeroPageX, mach85.ZeroPageY:
+			if wide || value < 0 || value > 0xff {
+				continue
+			}
+			return a.emit(opcode, uint8(value))
+		case mach85.IndirectX, mach85.IndirectY:
+			if known && (value < 0 || value > 0xff) {
+				return fmt.Errorf("address not in zero page: %v", expr)
+			}
+			return a.emit(opcode, uint8(value))
+		case mach85.Relative:
+			offset := value - a.seg.pc - 2
+			if known && (offset < -0x80 || offset > 0x7f) {
+				return fmt.Errorf("branch out of range: %v", expr)
+			}
+			return a.emit(opcode, uint8(offset))
+		}
+		if known && (value < 0 || value > 0xffff) {
+			return fmt.Errorf("address out of range: %v", expr)
+		}
+		return a.emit(opcode, uint8(value), uint8(value>>8))
+	}
+	return fmt.Errorf("invalid addressing mode for %v: %v", inst, operand)
+}
@@ -0,0 +1,63 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PRG returns the code with the load address in front as used by the
+// KERNAL.
+func (p *Program) PRG() []uint8 {
+	return append([]uint8{uint8(p.Origin), uint8(p.Origin >> 8)}, p.Code...)
+}
+
+// WriteListing writes each source line with its address and the bytes it
+// produced. Lines that produced more than three bytes continue on the
+// lines that follow.
+func (p *Program) WriteListing(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	for _, line := range p.Listing {
+		addr := "    "
+		if line.Addressed {
+			addr = fmt.Sprintf("%04x", line.Address)
+		}
+		bytes := line.Bytes
+		n := len(bytes)
+		if n > 3 {
+			n = 3
+		}
+		fmt.Fprintf(out, "%5d  %v  %-8v  %v\n", line.Line, addr, hexBytes(bytes[:n]), line.Source)
+		for i := 3; i < len(bytes); i += 3 {
+			end := i + 3
+			if end > len(bytes) {
+				end = len(bytes)
+			}
+			fmt.Fprintf(out, "%5v  %04x  %v\n", "", line.Address+uint16(i), hexBytes(bytes[i:end]))
+		}
+	}
+	return out.Flush()
+}
+
+func hexBytes(values []uint8) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(strs, " ")
+}
+
+// WriteSymbols writes the symbols in a form that can be included in
+// another source file.
+func (p *Program) WriteSymbols(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	for _, s := range p.Symbols {
+		if s.Value >= 0 && s.Value <= 0xffff {
+			fmt.Fprintf(out, "%-16v = $%04x\n", s.Name, s.Value)
+		} else {
+			fmt.Fprintf(out, "%-16v = %v\n", s.Name, s.Value)
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,137 @@
+package mach85
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// assembly is the opcodes table in reverse.
+var assembly = func() map[Instruction]map[Mode]uint8 {
+	table := map[Instruction]map[Mode]uint8{}
+	for opcode, op := range opcodes {
+		if table[op.inst] == nil {
+			table[op.inst] = map[Mode]uint8{}
+		}
+		table[op.inst][op.mode] = opcode
+	}
+	return table
+}()
+
+var instructionNames = func() map[string]Instruction {
+	names := map[string]Instruction{}
+	for inst, name := range instructionStrings {
+		if inst != Illegal {
+			names[name] = inst
+		}
+	}
+	return names
+}()
+
+// LookupInstruction returns the instruction for a mnemonic such as "lda".
+func LookupInstruction(name string) (Instruction, bool) {
+	inst, ok := instructionNames[strings.ToLower(name)]
+	return inst, ok
+}
+
+// LookupOpcode returns the opcode for the instruction in the addressing
+// mode given.
+func LookupOpcode(inst Instruction, mode Mode) (uint8, bool) {
+	opcode, ok := assembly[inst][mode]
+	return opcode, ok
+}
+
+// OperandLen returns the number of bytes that follow the opcode in the
+// addressing mode given.
+func OperandLen(mode Mode) int {
+	return operandLengths[mode]
+}
+
+// Assemble encodes one instruction written in the syntax used by the
+// disassembler, such as "lda ($fb),y" or "bne $c010". Operands with more
+// than two hex digits use absolute addressing even if the value would
+// fit in the zero page.
+func Assemble(address uint16, line string) ([]uint8, error) {
+	fields := strings.Fields(strings.ToLower(line))
+	if len(fields) == 0 {
+		return nil, errors.New("no instruction")
+	}
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("invalid operand: %v", strings.Join(fields[1:], " "))
+	}
+	inst, ok := instructionNames[fields[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction: %v", fields[0])
+	}
+	modes := assembly[inst]
+	if len(fields) == 1 {
+		for _, mode := range []Mode{Implied, Accumulator} {
+			if opcode, ok := modes[mode]; ok {
+				return []uint8{opcode}, nil
+			}
+		}
+		return nil, fmt.Errorf("operand required: %v", inst)
+	}
+	candidates, value, wide, err := parseOperand(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	for _, mode := range candidates {
+		opcode, ok := modes[mode]
+		if !ok {
+			continue
+		}
+		switch mode {
+		case Immediate, ZeroPage, ZeroPageX, ZeroPageY, IndirectX, IndirectY:
+			if wide || value > 0xff {
+				continue
+			}
+		case Relative:
+			offset := int(value) - int(address) - 2
+			if offset < -128 || offset > 127 {
+				return nil, fmt.Errorf("branch out of range: $%04x", value)
+			}
+			return []uint8{opcode, uint8(offset)}, nil
+		}
+		switch operandLengths[mode] {
+		case 0:
+			return []uint8{opcode}, nil
+		case 1:
+			return []uint8{opcode, uint8(value)}, nil
+		}
+		return []uint8{opcode, uint8(value), uint8(value >> 8)}, nil
+	}
+	return nil, fmt.Errorf("invalid addressing mode for %v: %v", inst, fields[1])
+}
+
+// parseOperand returns the addressing modes the operand could be written
+// for, in order of preference.
+func parseOperand(str string) ([]Mode, uint16, bool, error) {
+	var modes []Mode
+	arg := str
+	switch {
+	case str == "a":
+		return []Mode{Accumulator}, 0, false, nil
+	case strings.HasPrefix(str, "#"):
+		modes, arg = []Mode{Immediate}, str[1:]
+	case strings.HasPrefix(str, "(") && strings.HasSuffix(str, ",x)"):
+		modes, arg = []Mode{IndirectX}, str[1:len(str)-3]
+	case strings.HasPrefix(str, "(") && strings.HasSuffix(str, "),y"):
+		modes, arg = []Mode{IndirectY}, str[1:len(str)-3]
+	case strings.HasPrefix(str, "(") && strings.HasSuffix(str, ")"):
+		modes, arg = []Mode{Indirect}, str[1:len(str)-1]
+	case strings.HasSuffix(str, ",x"):
+		modes, arg = []Mode{ZeroPageX, AbsoluteX}, str[:len(str)-2]
+	case strings.HasSuffix(str, ",y"):
+		modes, arg = []Mode{ZeroPageY, AbsoluteY}, str[:len(str)-2]
+	default:
+		modes = []Mode{Relative, ZeroPage, Absolute}
+	}
+	value, err := parseUint(arg, 16)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("invalid operand: %v", str)
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(arg, "$"), "0x")
+	wide := !strings.HasPrefix(arg, "+") && len(digits) > 2
+	return modes, uint16(value), wide, nil
+}
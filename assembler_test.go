@@ -0,0 +1,91 @@
+package mach85
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Each instruction is disassembled and then assembled again.
+func TestAssembleAll(t *testing.T) {
+	for opcode := range opcodes {
+		mem := NewMemory(NewRAM(0x10000))
+		mem.StoreN(0x1234, opcode, 0x56, 0x78)
+		dasm := NewDisassembler(mem)
+		dasm.PC = 0x1233
+		op := dasm.Next()
+		line := op.String()[len("$1234: 00 00 00  "):]
+		have, err := Assemble(0x1234, line)
+		if err != nil {
+			t.Errorf("%v: %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(op.Bytes, have) {
+			t.Errorf("%v \n want: % x \n have: % x \n", line, op.Bytes, have)
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		line string
+		want []uint8
+		err  string
+	}{
+		{"lda #$01", []uint8{0xa9, 0x01}, ""},
+		{"LDA #1", []uint8{0xa9, 0x01}, ""},
+		{"lda #+10", []uint8{0xa9, 0x0a}, ""},
+		{"lda $10", []uint8{0xa5, 0x10}, ""},
+		{"lda $0010", []uint8{0xad, 0x10, 0x00}, ""},
+		{"lda $10,x", []uint8{0xb5, 0x10}, ""},
+		{"ldy $1000,x", []uint8{0xbc, 0x00, 0x10}, ""},
+		{"lda $10,y", []uint8{0xb9, 0x10, 0x00}, ""},
+		{"asl", []uint8{0x0a}, ""},
+		{"asl a", []uint8{0x0a}, ""},
+		{"jmp ($fffc)", []uint8{0x6c, 0xfc, 0xff}, ""},
+		{"jsr $ffd2", []uint8{0x20, 0xd2, 0xff}, ""},
+		{"bne $1234", []uint8{0xd0, 0xfe}, ""},
+		{"beq $1200", []uint8{0xf0, 0xca}, ""},
+		{"", nil, "no instruction"},
+		{"foo", nil, "unknown instruction: foo"},
+		{"lda", nil, "operand required: lda"},
+		{"lda #$100", nil, "invalid addressing mode for lda: #$100"},
+		{"lda ($1000),y", nil, "invalid addressing mode for lda: ($1000),y"},
+		{"jmp $10,x", nil, "invalid addressing mode for jmp: $10,x"},
+		{"lda $xyz", nil, "invalid operand: $xyz"},
+		{"lda $10 $20", nil, "invalid operand: $10 $20"},
+		{"bne $2000", nil, "branch out of range: $2000"},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			have, err := Assemble(0x1234, test.line)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("\n want: %v \n have: %v \n", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.want, have) {
+				t.Errorf("\n want: % x \n have: % x \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestAssembleCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "a c000 lda #$01 \n a c010 \n inx \n foo \n rts \n \n p c011")
+	want := []string{
+		"$c000: a9 01     lda #$01",
+		"$c010: e8        inx",
+		"unknown instruction: foo",
+		"$c011: 60        rts",
+		"$60 +96",
+	}
+	have := testLines(t, out, 5)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
@@ -0,0 +1,159 @@
+package mach85
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Audio renders the SID output to the default SDL audio device. The chip
+// is clocked by the cycles executed by the CPU, which keeps the state of
+// the SID the same from one run to the next.
+type Audio struct {
+	sid        *SID
+	dev        sdl.AudioDeviceID
+	cpu        *CPU
+	lastCycles uint64
+	samples    []int16
+	data       []byte
+}
+
+func NewAudio(sid *SID) (*Audio, error) {
+	spec := sdl.AudioSpec{
+		Freq:     int32(sid.SampleRate),
+		Format:   sdl.AUDIO_S16LSB,
+		Channels: 1,
+		Samples:  1024,
+	}
+	dev, err := sdl.OpenAudioDevice("", false, &spec, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	sdl.PauseAudioDevice(dev, false)
+	return &Audio{
+		sid: sid,
+		dev: dev,
+	}, nil
+}
+
+func (a *Audio) Service() error {
+	cycles := a.cpu.Cycles - a.lastCycles
+	if cycles < uint64(a.sid.ClockRate/100) { // 10 ms
+		return nil
+	}
+	a.lastCycles = a.cpu.Cycles
+	a.samples = a.sid.Step(int(cycles), a.samples[:0])
+
+	// Drop samples if the device is falling behind instead of letting the
+	// latency grow.
+	maxQueued := uint32(a.sid.SampleRate / 5 * 2) // 200 ms
+	if sdl.GetQueuedAudioSize(a.dev) > maxQueued {
+		return nil
+	}
+	return a.Queue(a.samples)
+}
+
+func (a *Audio) state(s *stateCodec) {
+	s.fields(&a.lastCycles)
+}
+
+// Queue sends samples to the audio device.
+func (a *Audio) Queue(samples []int16) error {
+	if cap(a.data) < len(samples)*2 {
+		a.data = make([]byte, len(samples)*2)
+	}
+	data := a.data[:len(samples)*2]
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return sdl.QueueAudio(a.dev, data)
+}
+
+// Queued returns the number of samples waiting to be played.
+func (a *Audio) Queued() int {
+	return int(sdl.GetQueuedAudioSize(a.dev) / 2)
+}
+
+// SIDRecorder renders the SID output to a WAV file. The chip is clocked by
+// the cycles executed by the CPU instead of by the wall clock so that the
+// same program always produces the same output.
+type SIDRecorder struct {
+	sid        *SID
+	cpu        *CPU
+	file       *os.File
+	wav        *WAVWriter
+	lastCycles uint64
+	samples    []int16
+	prevRate   int
+	mutex      sync.Mutex
+}
+
+func NewSIDRecorder(sid *SID, cpu *CPU, filename string, sampleRate int) (*SIDRecorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	wav, err := NewWAVWriter(file, sampleRate)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r := &SIDRecorder{
+		sid:        sid,
+		cpu:        cpu,
+		file:       file,
+		wav:        wav,
+		lastCycles: cpu.Cycles,
+		prevRate:   sid.SampleRate,
+	}
+	sid.SampleRate = sampleRate
+	return r, nil
+}
+
+func (r *SIDRecorder) Service() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.wav == nil {
+		return nil
+	}
+	cycles := r.cpu.Cycles - r.lastCycles
+	r.lastCycles = r.cpu.Cycles
+	r.samples = r.sid.Step(int(cycles), r.samples)
+	// Write in larger blocks since the header is rewritten each time
+	if len(r.samples) < 4096 {
+		return nil
+	}
+	return r.flush()
+}
+
+// restart continues recording from the current cycle count after the
+// machine has been restored to a different point in time.
+func (r *SIDRecorder) restart() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.lastCycles = r.cpu.Cycles
+}
+
+func (r *SIDRecorder) flush() error {
+	err := r.wav.Write(r.samples)
+	r.samples = r.samples[:0]
+	return err
+}
+
+// Close writes any remaining samples and closes the file.
+func (r *SIDRecorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.wav == nil {
+		return nil
+	}
+	err := r.flush()
+	r.wav = nil
+	r.sid.SampleRate = r.prevRate
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package mach85
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BreakpointInfo describes a breakpoint, which stops the machine before
+// the instruction at the address is executed.
+type BreakpointInfo struct {
+	Address   uint16
+	Enabled   bool
+	Condition string   // stop only when this expression is not zero
+	Ignore    int      // number of hits to pass before stopping
+	Hits      int      // number of times the condition was met
+	Commands  []string // monitor commands to run when stopped
+	Continue  bool     // keep running after the commands are run
+}
+
+func NewBreakpointInfo(address uint16) *BreakpointInfo {
+	return &BreakpointInfo{Address: address, Enabled: true}
+}
+
+func (b *BreakpointInfo) String() string {
+	state := "enabled"
+	if !b.Enabled {
+		state = "disabled"
+	}
+	parts := []string{fmt.Sprintf("$%04x %-8v hits %v", b.Address, state, b.Hits)}
+	if b.Ignore > 0 {
+		parts = append(parts, fmt.Sprintf("ignore %v", b.Ignore))
+	}
+	if b.Continue {
+		parts = append(parts, "continue")
+	}
+	if b.Condition != "" {
+		parts = append(parts, "if "+b.Condition)
+	}
+	if len(b.Commands) > 0 {
+		parts = append(parts, "do "+strings.Join(b.Commands, "; "))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// breakpoint checks for a breakpoint at the address of the next
+// instruction and returns true if the machine should stop. A condition
+// that cannot be evaluated stops the machine with the error.
+func (m *Mach85) breakpoint() bool {
+	b, ok := m.Breakpoints[m.cpu.PC+1]
+	if !ok || !b.Enabled {
+		return false
+	}
+	if b.Condition != "" {
+		value, err := m.Expr.Eval(b.Condition)
+		if err != nil {
+			m.Err = fmt.Errorf("breakpoint $%04x: %v", b.Address, err)
+			return true
+		}
+		if value == 0 {
+			return false
+		}
+	}
+	b.Hits++
+	return b.Hits > b.Ignore
+}
+
+// SortedBreakpoints returns the breakpoints in order of address.
+func (m *Mach85) SortedBreakpoints() []*BreakpointInfo {
+	list := make([]*BreakpointInfo, 0, len(m.Breakpoints))
+	for _, b := range m.Breakpoints {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
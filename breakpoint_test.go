@@ -0,0 +1,102 @@
+package mach85
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Counts up in X forever
+var countLoop = []uint8{
+	0xe8,             // $0800: inx
+	0x4c, 0x00, 0x08, // $0801: jmp $0800
+}
+
+func TestBreakpointStop(t *testing.T) {
+	tests := []struct {
+		name  string
+		cmds  string
+		x     uint8
+		hits  int
+		error string
+	}{
+		{"condition", "b 0800 if x==5", 5, 1, ""},
+		{"ignore", "b 0800 ignore 3", 4, 4, ""},
+		{"ignore with condition", "b 0800 if x&1 \n b 0800 ignore 2", 5, 3, ""},
+		{"enable", "b 0800 disable \n b 0800 if x==2 \n b 0800 enable", 2, 1, ""},
+		{"invalid condition", "b 0800 if foo \n b 0800 if x==3", 3, 1, "unknown symbol: foo"},
+		{"ambiguous condition", "b 0800 if a==10 \n b 0800 if x==3", 3, 1, "ambiguous: a, use .a or $a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mon, out := newTestMonitor()
+			mon.mach.Memory.StoreN(0x0800, countLoop...)
+			testMonitorParse(mon, test.cmds+"\n g")
+			mon.mach.Start()
+			mon.mach.Run()
+			if mon.mach.Status != Breakpoint {
+				t.Fatalf("\n want: %v \n have: %v \n", Breakpoint, mon.mach.Status)
+			}
+			if mon.cpu.X != test.x {
+				t.Errorf("\n want: %v \n have: %v \n", test.x, mon.cpu.X)
+			}
+			hits := mon.mach.Breakpoints[0x0800].Hits
+			if hits != test.hits {
+				t.Errorf("\n want: %v \n have: %v \n", test.hits, hits)
+			}
+			have := strings.Split(out.String(), "\n")[0]
+			if test.error != have {
+				t.Errorf("\n want: %v \n have: %v \n", test.error, have)
+			}
+		})
+	}
+}
+
+func TestBreakpointDisabled(t *testing.T) {
+	mon, _ := newTestMonitor()
+	mon.mach.Memory.StoreN(0x0800, 0xea, 0xea, 0xea) // nop
+	testMonitorParse(mon, "b 0801 on \n b 0801 disable \n b 0802 on \n g")
+	mon.mach.Start()
+	mon.mach.Run()
+	want := uint16(0x0801)
+	have := mon.cpu.PC
+	if want != have {
+		t.Errorf("\n want: %04x \n have: %04x \n", want, have)
+	}
+}
+
+func TestBreakpointCommands(t *testing.T) {
+	mon, _ := newTestMonitor()
+	mon.mach.Memory.StoreN(0x0800, countLoop...)
+	testMonitorParse(mon, "b 0800 do p c000 x; p c001 .a \n b 0800 continue on \n g")
+	mon.mach.Start()
+	mon.mach.Run()
+	mon.cpu.A = 0x42
+	mon.breakpointCommands()
+	// Stops again at the next hit as the test machine quits on stop
+	mon.mach.Run()
+	if hits := mon.mach.Breakpoints[0x0800].Hits; hits != 2 {
+		t.Errorf("\n want: %v \n have: %v \n", 2, hits)
+	}
+	want := []uint8{0x01, 0x42}
+	have := []uint8{mon.mem.Load(0xc000), mon.mem.Load(0xc001)}
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestBreakpointList(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "bl \n b c000 on \n b 0800 if .a==1 \n b 0800 do r; m c000 \n "+
+		"b 0800 continue on \n b c000 ignore 2 \n b c000 disable \n b 0800 \n bl")
+	want := []string{
+		"no breakpoints",
+		"$0800 enabled  hits 0  continue  if .a==1  do r; m c000",
+		"$0800 enabled  hits 0  continue  if .a==1  do r; m c000",
+		"$c000 disabled hits 0  ignore 2",
+	}
+	have := testLines(t, out, 4)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
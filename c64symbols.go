@@ -0,0 +1,360 @@
+package mach85
+
+// C64Symbols are the names of the ROM entry points, vectors, zero page
+// locations and I/O registers. Most names are from the Commodore 64
+// Programmer's Reference Guide and Mapping the Commodore 64.
+// https://archive.org/details/Compute_s_Mapping_the_Commodore_64
+var C64Symbols = map[string]uint16{
+	// Zero page
+	"D6510":  0x0000,
+	"R6510":  0x0001,
+	"ADRAY1": 0x0003,
+	"ADRAY2": 0x0005,
+	"CHARAC": 0x0007,
+	"ENDCHR": 0x0008,
+	"TRMPOS": 0x0009,
+	"COUNT":  0x000b,
+	"DIMFLG": 0x000c,
+	"VALTYP": 0x000d,
+	"INTFLG": 0x000e,
+	"GARBFL": 0x000f,
+	"SUBFLG": 0x0010,
+	"INPFLG": 0x0011,
+	"TANSGN": 0x0012,
+	"CHANNL": 0x0013,
+	"LINNUM": 0x0014,
+	"TEMPPT": 0x0016,
+	"LASTPT": 0x0017,
+	"TEMPST": 0x0019,
+	"INDEX":  0x0022,
+	"RESHO":  0x0026,
+	"TXTTAB": 0x002b,
+	"VARTAB": 0x002d,
+	"ARYTAB": 0x002f,
+	"STREND": 0x0031,
+	"FRETOP": 0x0033,
+	"FRESPC": 0x0035,
+	"MEMSIZ": 0x0037,
+	"CURLIN": 0x0039,
+	"OLDLIN": 0x003b,
+	"OLDTXT": 0x003d,
+	"DATLIN": 0x003f,
+	"DATPTR": 0x0041,
+	"INPPTR": 0x0043,
+	"VARNAM": 0x0045,
+	"VARPNT": 0x0047,
+	"FORPNT": 0x0049,
+	"FACEXP": 0x0061,
+	"ARGEXP": 0x0069,
+	"CHRGET": 0x0073,
+	"CHRGOT": 0x0079,
+	"TXTPTR": 0x007a,
+	"RNDX":   0x008b,
+	"STATUS": 0x0090,
+	"STKEY":  0x0091,
+	"SVXT":   0x0092,
+	"VERCK":  0x0093,
+	"C3PO":   0x0094,
+	"BSOUR":  0x0095,
+	"SYNO":   0x0096,
+	"XSAV":   0x0097,
+	"LDTND":  0x0098,
+	"DFLTN":  0x0099,
+	"DFLTO":  0x009a,
+	"PRTY":   0x009b,
+	"DPSW":   0x009c,
+	"MSGFLG": 0x009d,
+	"PTR1":   0x009e,
+	"PTR2":   0x009f,
+	"TIME":   0x00a0,
+	"TSFCNT": 0x00a3,
+	"TBTCNT": 0x00a4,
+	"CNTDN":  0x00a5,
+	"BUFPNT": 0x00a6,
+	"INBIT":  0x00a7,
+	"BITCI":  0x00a8,
+	"RINONE": 0x00a9,
+	"RIDATA": 0x00aa,
+	"RIPRTY": 0x00ab,
+	"SAL":    0x00ac,
+	"EAL":    0x00ae,
+	"CMP0":   0x00b0,
+	"TAPE1":  0x00b2,
+	"BITTS":  0x00b4,
+	"NXTBIT": 0x00b5,
+	"RODATA": 0x00b6,
+	"FNLEN":  0x00b7,
+	"LA":     0x00b8,
+	"SA":     0x00b9,
+	"FA":     0x00ba,
+	"FNADR":  0x00bb,
+	"ROPRTY": 0x00bd,
+	"FSBLK":  0x00be,
+	"MYCH":   0x00bf,
+	"CAS1":   0x00c0,
+	"STAL":   0x00c1,
+	"MEMUSS": 0x00c3,
+	"LSTX":   0x00c5,
+	"NDX":    0x00c6,
+	"RVS":    0x00c7,
+	"INDX":   0x00c8,
+	"LXSP":   0x00c9,
+	"SFDX":   0x00cb,
+	"BLNSW":  0x00cc,
+	"BLNCT":  0x00cd,
+	"GDBLN":  0x00ce,
+	"BLNON":  0x00cf,
+	"CRSW":   0x00d0,
+	"PNT":    0x00d1,
+	"PNTR":   0x00d3,
+	"QTSW":   0x00d4,
+	"LNMX":   0x00d5,
+	"TBLX":   0x00d6,
+	"INSRT":  0x00d8,
+	"LDTB1":  0x00d9,
+	"USER":   0x00f3,
+	"KEYTAB": 0x00f5,
+	"RIBUF":  0x00f7,
+	"ROBUF":  0x00f9,
+	"FREKZP": 0x00fb,
+	"BASZPT": 0x00ff,
+
+	// Pages 1 to 3
+	"STACK":      0x0100,
+	"BUF":        0x0200,
+	"LAT":        0x0259,
+	"FAT":        0x0263,
+	"SAT":        0x026d,
+	"KEYD":       0x0277,
+	"MEMSTR":     0x0281,
+	"TIMOUT":     0x0285,
+	"COLOR":      0x0286,
+	"GDCOL":      0x0287,
+	"HIBASE":     0x0288,
+	"XMAX":       0x0289,
+	"RPTFLG":     0x028a,
+	"KOUNT":      0x028b,
+	"DELAY":      0x028c,
+	"SHFLAG":     0x028d,
+	"LSTSHF":     0x028e,
+	"KEYLOG":     0x028f,
+	"MODE":       0x0291,
+	"AUTODN":     0x0292,
+	"IERROR":     0x0300,
+	"IMAIN":      0x0302,
+	"ICRNCH":     0x0304,
+	"IQPLOP":     0x0306,
+	"IGONE":      0x0308,
+	"IEVAL":      0x030a,
+	"SAREG":      0x030c,
+	"SXREG":      0x030d,
+	"SYREG":      0x030e,
+	"SPREG":      0x030f,
+	"CINV":       0x0314,
+	"CBINV":      0x0316,
+	"NMINV":      0x0318,
+	"IOPEN":      0x031a,
+	"ICLOSE":     0x031c,
+	"ICHKIN":     0x031e,
+	"ICKOUT":     0x0320,
+	"ICLRCH":     0x0322,
+	"IBASIN":     0x0324,
+	"IBSOUT":     0x0326,
+	"ISTOP":      0x0328,
+	"IGETIN":     0x032a,
+	"ICLALL":     0x032c,
+	"USRCMD":     0x032e,
+	"ILOAD":      0x0330,
+	"ISAVE":      0x0332,
+	"TBUFFR":     0x033c,
+	"SCREEN_RAM": 0x0400,
+
+	// BASIC
+	"READY":   0xa474,
+	"MAIN":    0xa480,
+	"LINKPRG": 0xa533,
+	"INLIN":   0xa560,
+	"CRUNCH":  0xa579,
+	"FNDLIN":  0xa613,
+	"SCRTCH":  0xa642,
+	"NEWSTT":  0xa7ae,
+	"GONE":    0xa7e4,
+	"STROUT":  0xab1e,
+	"FRMNUM":  0xad8a,
+	"FRMEVL":  0xad9e,
+	"GETBYTC": 0xb79e,
+	"GETADR":  0xb7f7,
+	"LINPRT":  0xbdcd,
+	"INIT":    0xe394,
+
+	// VIC-II
+	"VIC_SP0X":   0xd000,
+	"VIC_SP0Y":   0xd001,
+	"VIC_SP1X":   0xd002,
+	"VIC_SP1Y":   0xd003,
+	"VIC_SP2X":   0xd004,
+	"VIC_SP2Y":   0xd005,
+	"VIC_SP3X":   0xd006,
+	"VIC_SP3Y":   0xd007,
+	"VIC_SP4X":   0xd008,
+	"VIC_SP4Y":   0xd009,
+	"VIC_SP5X":   0xd00a,
+	"VIC_SP5Y":   0xd00b,
+	"VIC_SP6X":   0xd00c,
+	"VIC_SP6Y":   0xd00d,
+	"VIC_SP7X":   0xd00e,
+	"VIC_SP7Y":   0xd00f,
+	"VIC_MSIGX":  0xd010,
+	"VIC_SCROLY": 0xd011,
+	"VIC_RASTER": 0xd012,
+	"VIC_LPENX":  0xd013,
+	"VIC_LPENY":  0xd014,
+	"VIC_SPENA":  0xd015,
+	"VIC_SCROLX": 0xd016,
+	"VIC_YXPAND": 0xd017,
+	"VIC_VMCSB":  0xd018,
+	"VIC_VICIRQ": 0xd019,
+	"VIC_IRQMSK": 0xd01a,
+	"VIC_SPBGPR": 0xd01b,
+	"VIC_SPMC":   0xd01c,
+	"VIC_XXPAND": 0xd01d,
+	"VIC_SPSPCL": 0xd01e,
+	"VIC_SPBGCL": 0xd01f,
+	"VIC_EXTCOL": 0xd020,
+	"VIC_BGCOL0": 0xd021,
+	"VIC_BGCOL1": 0xd022,
+	"VIC_BGCOL2": 0xd023,
+	"VIC_BGCOL3": 0xd024,
+	"VIC_SPMC0":  0xd025,
+	"VIC_SPMC1":  0xd026,
+	"VIC_SP0COL": 0xd027,
+	"VIC_SP1COL": 0xd028,
+	"VIC_SP2COL": 0xd029,
+	"VIC_SP3COL": 0xd02a,
+	"VIC_SP4COL": 0xd02b,
+	"VIC_SP5COL": 0xd02c,
+	"VIC_SP6COL": 0xd02d,
+	"VIC_SP7COL": 0xd02e,
+
+	// SID
+	"SID_FRELO1": 0xd400,
+	"SID_FREHI1": 0xd401,
+	"SID_PWLO1":  0xd402,
+	"SID_PWHI1":  0xd403,
+	"SID_VCREG1": 0xd404,
+	"SID_ATDCY1": 0xd405,
+	"SID_SUREL1": 0xd406,
+	"SID_FRELO2": 0xd407,
+	"SID_FREHI2": 0xd408,
+	"SID_PWLO2":  0xd409,
+	"SID_PWHI2":  0xd40a,
+	"SID_VCREG2": 0xd40b,
+	"SID_ATDCY2": 0xd40c,
+	"SID_SUREL2": 0xd40d,
+	"SID_FRELO3": 0xd40e,
+	"SID_FREHI3": 0xd40f,
+	"SID_PWLO3":  0xd410,
+	"SID_PWHI3":  0xd411,
+	"SID_VCREG3": 0xd412,
+	"SID_ATDCY3": 0xd413,
+	"SID_SUREL3": 0xd414,
+	"SID_CUTLO":  0xd415,
+	"SID_CUTHI":  0xd416,
+	"SID_RESON":  0xd417,
+	"SID_SIGVOL": 0xd418,
+	"SID_POTX":   0xd419,
+	"SID_POTY":   0xd41a,
+	"SID_RANDOM": 0xd41b,
+	"SID_ENV3":   0xd41c,
+
+	// Color RAM
+	"COLOR_RAM": 0xd800,
+
+	// CIA1
+	"CIA1_PRA":    0xdc00,
+	"CIA1_PRB":    0xdc01,
+	"CIA1_DDRA":   0xdc02,
+	"CIA1_DDRB":   0xdc03,
+	"CIA1_TALO":   0xdc04,
+	"CIA1_TAHI":   0xdc05,
+	"CIA1_TBLO":   0xdc06,
+	"CIA1_TBHI":   0xdc07,
+	"CIA1_TOD10":  0xdc08,
+	"CIA1_TODSEC": 0xdc09,
+	"CIA1_TODMIN": 0xdc0a,
+	"CIA1_TODHR":  0xdc0b,
+	"CIA1_SDR":    0xdc0c,
+	"CIA1_ICR":    0xdc0d,
+	"CIA1_CRA":    0xdc0e,
+	"CIA1_CRB":    0xdc0f,
+
+	// CIA2
+	"CIA2_PRA":    0xdd00,
+	"CIA2_PRB":    0xdd01,
+	"CIA2_DDRA":   0xdd02,
+	"CIA2_DDRB":   0xdd03,
+	"CIA2_TALO":   0xdd04,
+	"CIA2_TAHI":   0xdd05,
+	"CIA2_TBLO":   0xdd06,
+	"CIA2_TBHI":   0xdd07,
+	"CIA2_TOD10":  0xdd08,
+	"CIA2_TODSEC": 0xdd09,
+	"CIA2_TODMIN": 0xdd0a,
+	"CIA2_TODHR":  0xdd0b,
+	"CIA2_SDR":    0xdd0c,
+	"CIA2_ICR":    0xdd0d,
+	"CIA2_CRA":    0xdd0e,
+	"CIA2_CRB":    0xdd0f,
+
+	// KERNAL
+	"CLSR":  0xe544,
+	"HOME":  0xe566,
+	"START": 0xfce2,
+	"NMI":   0xfe43,
+
+	// KERNAL jump table
+	"CINT":   0xff81,
+	"IOINIT": 0xff84,
+	"RAMTAS": 0xff87,
+	"RESTOR": 0xff8a,
+	"VECTOR": 0xff8d,
+	"SETMSG": 0xff90,
+	"SECOND": 0xff93,
+	"TKSA":   0xff96,
+	"MEMTOP": 0xff99,
+	"MEMBOT": 0xff9c,
+	"SCNKEY": 0xff9f,
+	"SETTMO": 0xffa2,
+	"ACPTR":  0xffa5,
+	"CIOUT":  0xffa8,
+	"UNTLK":  0xffab,
+	"UNLSN":  0xffae,
+	"LISTEN": 0xffb1,
+	"TALK":   0xffb4,
+	"READST": 0xffb7,
+	"SETLFS": 0xffba,
+	"SETNAM": 0xffbd,
+	"OPEN":   0xffc0,
+	"CLOSE":  0xffc3,
+	"CHKIN":  0xffc6,
+	"CHKOUT": 0xffc9,
+	"CLRCHN": 0xffcc,
+	"CHRIN":  0xffcf,
+	"CHROUT": 0xffd2,
+	"LOAD":   0xffd5,
+	"SAVE":   0xffd8,
+	"SETTIM": 0xffdb,
+	"RDTIM":  0xffde,
+	"STOP":   0xffe1,
+	"GETIN":  0xffe4,
+	"CLALL":  0xffe7,
+	"UDTIM":  0xffea,
+	"SCREEN": 0xffed,
+	"PLOT":   0xfff0,
+	"IOBASE": 0xfff3,
+
+	// Hardware vectors
+	"NMI_VECTOR":   0xfffa,
+	"RESET_VECTOR": 0xfffc,
+	"IRQ_VECTOR":   0xfffe,
+}
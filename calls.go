@@ -0,0 +1,58 @@
+package mach85
+
+type CallType int
+
+const (
+	CallJsr CallType = iota
+	CallBrk
+	CallIRQ
+	CallNMI
+)
+
+func (t CallType) String() string {
+	switch t {
+	case CallJsr:
+		return "jsr"
+	case CallBrk:
+		return "brk"
+	case CallIRQ:
+		return "irq"
+	case CallNMI:
+		return "nmi"
+	}
+	return "???"
+}
+
+// Call is an entry on the shadow call stack that the CPU keeps alongside
+// the hardware stack.
+type Call struct {
+	Type CallType
+	From uint16 // address of the jsr or brk, or the instruction interrupted
+	To   uint16 // address of the subroutine or the interrupt handler
+	SP   uint8  // stack pointer after the return address was pushed
+}
+
+// Deep enough for any program that does not leave the stack by other
+// means than a return or txs.
+const maxCalls = 0x100
+
+func (c *CPU) call(t CallType, from uint16, to uint16) {
+	if len(c.calls) >= maxCalls {
+		c.calls = c.calls[1:]
+	}
+	c.calls = append(c.calls, Call{Type: t, From: from, To: to, SP: c.SP})
+}
+
+// unwind drops the calls that the stack pointer has moved above after
+// a return or a change of the stack pointer. The stack pointer can wrap.
+func (c *CPU) unwind() {
+	for len(c.calls) > 0 && int8(c.SP-c.calls[len(c.calls)-1].SP) > 0 {
+		c.calls = c.calls[:len(c.calls)-1]
+	}
+}
+
+// Calls returns the shadow call stack with the most recent call last. It
+// is empty after a reset or restoring a snapshot.
+func (c *CPU) Calls() []Call {
+	return append([]Call{}, c.calls...)
+}
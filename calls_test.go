@@ -0,0 +1,126 @@
+package mach85
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCalls(t *testing.T) {
+	mem := NewMemory(NewRAM(0x10000))
+	mem.StoreN(0x0800, 0x20, 0x10, 0x08) // jsr $0810
+	mem.StoreN(0x0810, 0xea, 0xea, 0x60) // nop, nop, rts
+	mem.StoreN(0x0900, 0x40)             // rti
+	mem.Store16(AddrIrqVector, 0x0900)
+	cpu := New6510(mem)
+	cpu.PC = 0x0800 - 1
+	cpu.SP = 0xff
+
+	jsr := Call{Type: CallJsr, From: 0x0800, To: 0x0810, SP: 0xfd}
+	irq := Call{Type: CallIRQ, From: 0x0811, To: 0x0900, SP: 0xfa}
+	steps := []struct {
+		irq  bool
+		want []Call
+	}{
+		{false, []Call{jsr}},     // jsr $0810
+		{true, []Call{jsr, irq}}, // nop, then the interrupt
+		{false, []Call{jsr}},     // rti
+		{false, []Call{jsr}},     // nop
+		{false, []Call{}},        // rts
+	}
+	for i, step := range steps {
+		if step.irq {
+			cpu.IRQ()
+		}
+		if err := cpu.Next(); err != nil {
+			t.Fatal(err)
+		}
+		have := cpu.Calls()
+		if !reflect.DeepEqual(step.want, have) {
+			t.Errorf("step %v\n want: %v \n have: %v \n", i, step.want, have)
+		}
+	}
+}
+
+func TestCallsTxs(t *testing.T) {
+	mem := NewMemory(NewRAM(0x10000))
+	mem.StoreN(0x0800, 0x20, 0x10, 0x08) // jsr $0810
+	mem.StoreN(0x0810, 0xa2, 0xff, 0x9a) // ldx #$ff, txs
+	cpu := New6510(mem)
+	cpu.PC = 0x0800 - 1
+	cpu.SP = 0xff
+	for i := 0; i < 3; i++ {
+		if err := cpu.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := cpu.Calls(); len(calls) != 0 {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
+
+func TestBacktrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		history bool
+		irq     bool
+		want    []string
+	}{
+		{"calls", true, false, []string{
+			"#0  $01fc jsr $0820 sub2 from $0810 sub1  call sub2",
+			"#1  $01fe jsr $0810 sub1 from $0800 start",
+		}},
+		{"stack", false, false, []string{
+			"no call history, from the stack:",
+			"#0  $01fc jsr $0820 sub2 from $0810 sub1  call sub2",
+			"#1  $01fe jsr $0810 sub1 from $0800 start",
+		}},
+		{"irq calls", true, true, []string{
+			"#0  $01f9 irq $0900 isr from $0822",
+			"#1  $01fc jsr $0820 sub2 from $0810 sub1  call sub2",
+			"#2  $01fe jsr $0810 sub1 from $0800 start",
+		}},
+		{"irq stack", false, true, []string{
+			"no call history, from the stack:",
+			"#0  $01f9 irq $0900 isr from $0822",
+			"#1  $01fc jsr $0820 sub2 from $0810 sub1  call sub2",
+			"#2  $01fe jsr $0810 sub1 from $0800 start",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mon, out := newTestMonitor()
+			for _, s := range subroutines {
+				mon.mach.Memory.StoreN(s.address, s.code...)
+			}
+			source := NewSource()
+			source.Symbols = map[string]uint16{"start": 0x0800, "sub1": 0x0810, "sub2": 0x0820, "isr": 0x0900}
+			source.Comments[0x0810] = "call sub2\nand return"
+			mon.Disassembler.LoadSource(source)
+			mon.mach.Breakpoints[0x0804] = NewBreakpointInfo(0x0804)
+			mon.cpu.SP = 0xff
+			mon.mach.Memory.Store(AddrProcessorPort, 0x34) // all RAM
+			mon.mach.Memory.Store16(AddrIrqVector, 0x0900)
+			mon.mach.Memory.Store(0x0900, 0xea) // nop
+			for i := 0; i < 2; i++ {
+				if err := mon.mach.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.irq {
+				mon.cpu.IRQ()
+				if err := mon.mach.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !test.history {
+				mon.cpu.calls = nil
+			}
+			testMonitorParse(mon, "bt")
+			have := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if !reflect.DeepEqual(test.want, have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
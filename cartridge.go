@@ -0,0 +1,387 @@
+package mach85
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// http://unusedino.de/ec64/technical/formats/crt.html
+
+// CartType is the hardware type in a CRT file which selects how banks are
+// switched.
+type CartType uint16
+
+const (
+	CartNormal       CartType = 0
+	CartActionReplay CartType = 1
+	CartOcean        CartType = 5
+	CartMagicDesk    CartType = 19
+	CartEasyFlash    CartType = 32
+)
+
+var cartTypeNames = map[CartType]string{
+	CartNormal:       "normal",
+	CartActionReplay: "action replay",
+	CartOcean:        "ocean",
+	CartMagicDesk:    "magic desk",
+	CartEasyFlash:    "easyflash",
+}
+
+func (c CartType) String() string {
+	if name, ok := cartTypeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("type %v", uint16(c))
+}
+
+const (
+	crtSignature = "C64 CARTRIDGE   "
+	chipHeader   = "CHIP"
+	cartBankLen  = 0x2000
+)
+
+type crtHeader struct {
+	Signature [16]uint8
+	HeaderLen uint32
+	Version   uint16
+	Type      uint16
+	ExROM     uint8
+	Game      uint8
+	_         [6]uint8
+	Name      [32]uint8
+}
+
+type chipPacket struct {
+	Signature [4]uint8
+	Length    uint32
+	ChipType  uint16
+	Bank      uint16
+	Address   uint16
+	Size      uint16
+}
+
+// CRTChip is a ROM or flash chip loaded at the address in a bank.
+type CRTChip struct {
+	Bank    int
+	Address uint16
+	Data    []uint8
+}
+
+// CRT is a cartridge image. ExROM and Game are true when the line is
+// pulled low by the cartridge at startup.
+type CRT struct {
+	Name  string
+	Type  CartType
+	ExROM bool
+	Game  bool
+	Chips []CRTChip
+}
+
+func LoadCRT(filename string) (*CRT, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCRT(data)
+}
+
+func ParseCRT(data []uint8) (*CRT, error) {
+	var h crtHeader
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &h); err != nil {
+		return nil, errors.New("not a CRT file")
+	}
+	if string(h.Signature[:]) != crtSignature {
+		return nil, errors.New("not a CRT file")
+	}
+	c := &CRT{
+		Name:  strings.TrimRight(string(h.Name[:]), "\x00"),
+		Type:  CartType(h.Type),
+		ExROM: h.ExROM == 0,
+		Game:  h.Game == 0,
+	}
+	if _, ok := cartTypeNames[c.Type]; !ok {
+		return nil, fmt.Errorf("unsupported cartridge: %v", c.Type)
+	}
+	for offset := int(h.HeaderLen); offset < len(data); {
+		var p chipPacket
+		if err := binary.Read(bytes.NewReader(data[offset:]), binary.BigEndian, &p); err != nil {
+			return nil, errors.New("truncated CHIP packet")
+		}
+		if string(p.Signature[:]) != chipHeader {
+			return nil, fmt.Errorf("invalid CHIP packet at $%x", offset)
+		}
+		start := offset + binary.Size(p)
+		end := start + int(p.Size)
+		if end > len(data) || p.Length == 0 {
+			return nil, errors.New("truncated CHIP packet")
+		}
+		c.Chips = append(c.Chips, CRTChip{
+			Bank:    int(p.Bank),
+			Address: p.Address,
+			Data:    data[start:end],
+		})
+		offset += int(p.Length)
+	}
+	if len(c.Chips) == 0 {
+		return nil, errors.New("no CHIP packets")
+	}
+	return c, nil
+}
+
+// Cartridge is a CRT plugged into the expansion port. The ROM in the
+// selected bank appears as ROML at $8000 and ROMH at $a000, or at $e000 in
+// Ultimax mode. Banks are switched by writing to the I/O areas at $de00
+// and $df00.
+type Cartridge struct {
+	CRT      *CRT
+	Bank     int
+	ExROM    bool // pulled low
+	Game     bool // pulled low
+	Disabled bool
+	lo       map[int][]uint8
+	hi       map[int][]uint8
+	ram      []uint8
+	ramOn    bool
+	mem      *Memory64
+	cpu      *CPU
+}
+
+func NewCartridge(crt *CRT) *Cartridge {
+	c := &Cartridge{
+		CRT: crt,
+		lo:  map[int][]uint8{},
+		hi:  map[int][]uint8{},
+	}
+	for _, chip := range crt.Chips {
+		banks := c.lo
+		if chip.Address >= 0xa000 {
+			banks = c.hi
+		}
+		for i := 0; i < len(chip.Data); i += cartBankLen {
+			bank := make([]uint8, cartBankLen)
+			for j := range bank {
+				bank[j] = 0xff
+			}
+			copy(bank[chip.Address&0x1fff:], chip.Data[i:])
+			banks[chip.Bank] = bank
+			// The second half of a 16K chip is ROMH
+			banks = c.hi
+		}
+	}
+	switch crt.Type {
+	case CartActionReplay:
+		c.ram = make([]uint8, cartBankLen)
+	case CartEasyFlash:
+		c.ram = make([]uint8, 0x100)
+	}
+	return c
+}
+
+// usesIO2 reports whether the cartridge has anything in the $df00 page.
+func (c *Cartridge) usesIO2() bool {
+	return c.CRT.Type == CartActionReplay || c.CRT.Type == CartEasyFlash
+}
+
+// Reset returns to the first bank with the lines set as they are at power
+// on. An EasyFlash starts in Ultimax mode.
+func (c *Cartridge) Reset() {
+	c.Bank = 0
+	c.Disabled = false
+	c.ramOn = false
+	c.ExROM = c.CRT.ExROM
+	c.Game = c.CRT.Game
+	if c.CRT.Type == CartEasyFlash {
+		c.ExROM = false
+		c.Game = true
+	}
+	c.apply()
+}
+
+// apply updates the memory configuration with the lines of the cartridge.
+func (c *Cartridge) apply() {
+	if c.mem == nil {
+		return
+	}
+	c.mem.ExROM = !c.ExROM || c.Disabled
+	c.mem.Game = !c.Game || c.Disabled
+}
+
+func (c *Cartridge) rom(hi bool, address uint16) uint8 {
+	bank, ok := c.lo[c.Bank]
+	if hi {
+		if b, found := c.hi[c.Bank]; found {
+			bank, ok = b, true
+		}
+	}
+	if !ok {
+		return 0xff
+	}
+	return bank[address&0x1fff]
+}
+
+// Freeze presses the freeze button on an Action Replay. The cartridge
+// switches to Ultimax mode and interrupts the CPU with an NMI.
+func (c *Cartridge) Freeze() error {
+	if c.CRT.Type != CartActionReplay {
+		return fmt.Errorf("no freeze button on %v cartridge", c.CRT.Type)
+	}
+	c.Disabled = false
+	c.Bank = 0
+	c.ExROM = false
+	c.Game = true
+	c.ramOn = false
+	c.apply()
+	c.cpu.NMI()
+	return nil
+}
+
+// Load handles reads of the I/O areas.
+func (c *Cartridge) Load(address uint16) uint8 {
+	if c.Disabled {
+		return 0xff
+	}
+	switch c.CRT.Type {
+	case CartActionReplay:
+		if address >= 0xdf00 {
+			if c.ramOn {
+				return c.ram[address&0x1fff]
+			}
+			return c.rom(false, address)
+		}
+	case CartEasyFlash:
+		if address >= 0xdf00 {
+			return c.ram[address&0xff]
+		}
+	}
+	return 0xff
+}
+
+// Store handles writes to the I/O areas.
+func (c *Cartridge) Store(address uint16, value uint8) {
+	if c.Disabled {
+		return
+	}
+	switch c.CRT.Type {
+	case CartOcean:
+		if address < 0xdf00 {
+			c.Bank = int(value & 0x3f)
+		}
+	case CartMagicDesk:
+		if address < 0xdf00 {
+			c.Bank = int(value & 0x3f)
+			c.Disabled = value&0x80 != 0
+		}
+	case CartEasyFlash:
+		switch {
+		case address >= 0xdf00:
+			c.ram[address&0xff] = value
+		case address&0x02 == 0:
+			c.Bank = int(value & 0x3f)
+		default:
+			// Without the mode bit, GAME is set by the boot jumper
+			c.Game = value&0x04 == 0 || value&0x01 != 0
+			c.ExROM = value&0x02 != 0
+		}
+	case CartActionReplay:
+		if address >= 0xdf00 {
+			if c.ramOn {
+				c.ram[address&0x1fff] = value
+			}
+			return
+		}
+		c.Game = value&0x01 != 0
+		c.ExROM = value&0x02 == 0
+		c.Bank = int(value >> 3 & 0x03)
+		c.ramOn = value&0x20 != 0
+		c.Disabled = value&0x04 != 0
+	}
+	c.apply()
+}
+
+func (c *Cartridge) state(s *stateCodec) {
+	s.fields(&c.Bank, &c.ExROM, &c.Game, &c.Disabled, &c.ramOn)
+	if c.ram != nil {
+		s.fields(c.ram)
+	}
+	if s.restore {
+		c.apply()
+	}
+}
+
+// cartROM is the chunk for ROML or ROMH.
+type cartROM struct {
+	cart *Cartridge
+	hi   bool
+}
+
+func (r cartROM) Load(address uint16) uint8 {
+	if !r.hi && r.cart.ramOn {
+		return r.cart.ram[address&0x1fff]
+	}
+	return r.cart.rom(r.hi, address)
+}
+
+func (r cartROM) Store(address uint16, value uint8) {
+	if !r.hi && r.cart.ramOn {
+		r.cart.ram[address&0x1fff] = value
+	}
+}
+
+func (c *Cartridge) String() string {
+	return fmt.Sprintf("%v (%v, bank %v)", c.CRT.Name, c.CRT.Type, c.Bank)
+}
+
+// AttachCartridge plugs in the cartridge and resets the machine to start
+// it.
+func (m *Mach85) AttachCartridge(filename string) error {
+	mem64, err := m.mem64()
+	if err != nil {
+		return err
+	}
+	crt, err := LoadCRT(filename)
+	if err != nil {
+		return err
+	}
+	c := NewCartridge(crt)
+	if c.usesIO2() && m.reu != nil {
+		return errors.New("REU uses the $df00 page")
+	}
+	if m.cart != nil {
+		m.DetachCartridge()
+	}
+	c.mem = mem64
+	c.cpu = m.cpu
+	mem64.Chunks[CartLoROM] = cartROM{cart: c}
+	mem64.Chunks[CartHiROM] = cartROM{cart: c, hi: true}
+	mem64.MapIO(0xde00, 0xdeff, c)
+	m.cart = c
+	m.mapIO2(mem64)
+	c.Reset()
+	m.Reset()
+	return nil
+}
+
+func (m *Mach85) DetachCartridge() error {
+	if m.cart == nil {
+		return errors.New("no cartridge attached")
+	}
+	mem64 := m.Memory.Base.(*Memory64)
+	mem64.Chunks[CartLoROM] = NullMemory{}
+	mem64.Chunks[CartHiROM] = NullMemory{}
+	mem64.MapIO(0xde00, 0xdeff, nil)
+	mem64.Game = true
+	mem64.ExROM = true
+	m.cart = nil
+	m.mapIO2(mem64)
+	m.Reset()
+	return nil
+}
+
+// Cartridge returns the cartridge attached or nil if there is none.
+func (m *Mach85) Cartridge() *Cartridge {
+	return m.cart
+}
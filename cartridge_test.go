@@ -0,0 +1,185 @@
+package mach85
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// testCRT builds a cartridge image from the chips given.
+func testCRT(cartType CartType, exrom uint8, game uint8, chips ...CRTChip) []uint8 {
+	data := make([]uint8, 0x40)
+	copy(data, crtSignature)
+	binary.BigEndian.PutUint32(data[0x10:], 0x40)
+	binary.BigEndian.PutUint16(data[0x14:], 0x0100)
+	binary.BigEndian.PutUint16(data[0x16:], uint16(cartType))
+	data[0x18] = exrom
+	data[0x19] = game
+	copy(data[0x20:], "TEST")
+	for _, chip := range chips {
+		p := make([]uint8, 0x10)
+		copy(p, chipHeader)
+		binary.BigEndian.PutUint32(p[4:], uint32(0x10+len(chip.Data)))
+		binary.BigEndian.PutUint16(p[0xa:], uint16(chip.Bank))
+		binary.BigEndian.PutUint16(p[0xc:], chip.Address)
+		binary.BigEndian.PutUint16(p[0xe:], uint16(len(chip.Data)))
+		data = append(data, p...)
+		data = append(data, chip.Data...)
+	}
+	return data
+}
+
+// testChip returns a chip filled with $10 plus the bank number. The second
+// half of a 16K chip is filled with $80 plus the bank number.
+func testChip(bank int, address uint16, size int) CRTChip {
+	data := make([]uint8, size)
+	for i := range data {
+		data[i] = 0x10 | uint8(bank)
+	}
+	if size > cartBankLen {
+		data[cartBankLen] = 0x80 | uint8(bank)
+	}
+	return CRTChip{Bank: bank, Address: address, Data: data}
+}
+
+func newTestCartridge(t *testing.T, data []uint8) *Mach85 {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(data)
+	file.Close()
+	defer os.Remove(file.Name())
+	mach := New()
+	if err := mach.AttachCartridge(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	return mach
+}
+
+func TestParseCRT(t *testing.T) {
+	crt, err := ParseCRT(testCRT(CartOcean, 0, 0, testChip(0, 0x8000, 0x2000), testChip(1, 0x8000, 0x2000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crt.Name != "TEST" || crt.Type != CartOcean || !crt.ExROM || !crt.Game {
+		t.Errorf("unexpected header: %+v", crt)
+	}
+	if len(crt.Chips) != 2 || crt.Chips[1].Bank != 1 {
+		t.Errorf("unexpected chips: %+v", crt.Chips)
+	}
+}
+
+func TestParseCRTInvalid(t *testing.T) {
+	if _, err := ParseCRT([]uint8("C64 CARTRIDGE")); err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := ParseCRT(testCRT(99, 0, 0, testChip(0, 0x8000, 0x2000))); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestCartridgeModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		exrom   uint8
+		game    uint8
+		chip    CRTChip
+		address uint16
+		want    uint8
+	}{
+		{"8k", 0, 1, testChip(0, 0x8000, 0x2000), 0x8000, 0x10},
+		{"16k", 0, 0, testChip(0, 0x8000, 0x4000), 0xa000, 0x80},
+		{"ultimax", 1, 0, testChip(0, 0xe000, 0x2000), 0xfffc, 0x10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mach := newTestCartridge(t, testCRT(CartNormal, test.exrom, test.game, test.chip))
+			mach.Memory.Store(AddrProcessorPort, 0x37)
+			have := mach.Memory.Load(test.address)
+			if have != test.want {
+				t.Errorf("\n want: %02x \n have: %02x \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestCartridgeOcean(t *testing.T) {
+	mach := newTestCartridge(t, testCRT(CartOcean, 0, 0,
+		testChip(0, 0x8000, 0x2000), testChip(1, 0x8000, 0x2000)))
+	mach.Memory.Store(AddrProcessorPort, 0x37)
+	mach.Memory.Store(0xde00, 0x81)
+	if have := mach.Memory.Load(0x8000); have != 0x11 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x11, have)
+	}
+}
+
+func TestCartridgeMagicDesk(t *testing.T) {
+	mach := newTestCartridge(t, testCRT(CartMagicDesk, 0, 1,
+		testChip(0, 0x8000, 0x2000), testChip(1, 0x8000, 0x2000)))
+	mach.Memory.Store(AddrProcessorPort, 0x37)
+	mach.Memory.Store(0xde00, 0x01)
+	if have := mach.Memory.Load(0x8000); have != 0x11 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x11, have)
+	}
+	mach.Memory.Store(0xde00, 0x80)
+	mach.Memory.Store(0x8000, 0x42)
+	if have := mach.Memory.Load(0x8000); have != 0x42 {
+		t.Errorf("cartridge not disabled: %02x", have)
+	}
+}
+
+func TestCartridgeEasyFlash(t *testing.T) {
+	mach := newTestCartridge(t, testCRT(CartEasyFlash, 1, 0,
+		testChip(0, 0x8000, 0x2000), testChip(0, 0xa000, 0x2000),
+		testChip(1, 0x8000, 0x2000)))
+	mach.Memory.Store(AddrProcessorPort, 0x37)
+	mem64 := mach.Memory.Base.(*Memory64)
+	if mem64.Mapped(0xe000) != CartHiROM {
+		t.Fatalf("not started in ultimax mode")
+	}
+	mach.Memory.Store(0xde02, 0x06) // 8K mode
+	mach.Memory.Store(0xde00, 0x01)
+	if have := mach.Memory.Load(0x8000); have != 0x11 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x11, have)
+	}
+	if mem64.Mapped(0xa000) != BasicROM {
+		t.Errorf("\n want: %v \n have: %v \n", BasicROM, mem64.Mapped(0xa000))
+	}
+	mach.Memory.Store(0xdf10, 0x42)
+	if have := mach.Memory.Load(0xdf10); have != 0x42 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x42, have)
+	}
+}
+
+func TestCartridgeActionReplay(t *testing.T) {
+	var chips []CRTChip
+	for bank := 0; bank < 4; bank++ {
+		chips = append(chips, testChip(bank, 0x8000, 0x2000))
+	}
+	mach := newTestCartridge(t, testCRT(CartActionReplay, 0, 1, chips...))
+	mach.Memory.Store(AddrProcessorPort, 0x37)
+	mach.Memory.Store(0xde00, 0x10) // bank 2, 8K mode
+	if have := mach.Memory.Load(0x8000); have != 0x12 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x12, have)
+	}
+	mach.Memory.Store(0xde00, 0x20) // RAM at $8000
+	mach.Memory.Store(0x8000, 0x42)
+	if have := mach.Memory.Load(0x8000); have != 0x42 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x42, have)
+	}
+	mach.Memory.Store(0xde00, 0x04) // disable
+	mach.Cartridge().Freeze()
+	mem64 := mach.Memory.Base.(*Memory64)
+	if mem64.Mapped(0xe000) != CartHiROM {
+		t.Errorf("not in ultimax mode after freeze")
+	}
+	// Vector in the ROM points to $1010
+	mach.Memory.Store(0x0800, 0xea) // nop
+	mach.cpu.PC = 0x0800 - 1
+	mach.cpu.Next()
+	if mach.cpu.PC != 0x100f {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0x100f, mach.cpu.PC)
+	}
+}
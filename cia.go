@@ -0,0 +1,319 @@
+package mach85
+
+// https://www.c64-wiki.com/wiki/CIA
+
+// CIA registers
+const (
+	ciaPRA = iota
+	ciaPRB
+	ciaDDRA
+	ciaDDRB
+	ciaTALO
+	ciaTAHI
+	ciaTBLO
+	ciaTBHI
+	ciaTOD10THS
+	ciaTODSEC
+	ciaTODMIN
+	ciaTODHR
+	ciaSDR
+	ciaICR
+	ciaCRA
+	ciaCRB
+)
+
+// CIA interrupt flags
+const (
+	ciaIntTA = 1 << iota
+	ciaIntTB
+	ciaIntTOD
+	ciaIntSDR
+	ciaIntFLG
+)
+
+// CIA control register bits
+const (
+	ciaStart   = 0x01
+	ciaOneShot = 0x08
+	ciaLoad    = 0x10
+)
+
+// CIA is the MOS Technology 6526 Complex Interface Adapter. The ports are
+// connected in the same way as the VIA. Timers are clocked from the
+// cycles executed by the CPU each time the device is serviced. The
+// interrupt line is only connected to the CPU when Interrupts is set.
+type CIA struct {
+	ReadA      func() uint8
+	ReadB      func() uint8
+	WriteA     func(uint8)
+	WriteB     func(uint8)
+	Interrupts bool
+
+	cpu     *CPU
+	cycles  uint64
+	pra     uint8
+	prb     uint8
+	ddra    uint8
+	ddrb    uint8
+	ta      int
+	taLatch uint16
+	tb      int
+	tbLatch uint16
+	cra     uint8
+	crb     uint8
+	icr     uint8
+	mask    uint8
+	sdr     uint8
+	tod     [4]uint8
+}
+
+func NewCIA(cpu *CPU) *CIA {
+	return &CIA{cpu: cpu, cycles: cpu.Cycles}
+}
+
+// PortA returns the state of the output pins on port A.
+func (c *CIA) PortA() uint8 {
+	return c.pra&c.ddra | ^c.ddra
+}
+
+// PortB returns the state of the output pins on port B.
+func (c *CIA) PortB() uint8 {
+	return c.prb&c.ddrb | ^c.ddrb
+}
+
+func (c *CIA) writeA() {
+	if c.WriteA != nil {
+		c.WriteA(c.PortA())
+	}
+}
+
+func (c *CIA) writeB() {
+	if c.WriteB != nil {
+		c.WriteB(c.PortB())
+	}
+}
+
+func (c *CIA) Load(address uint16) uint8 {
+	switch address & 0xf {
+	case ciaPRA:
+		in := uint8(0xff)
+		if c.ReadA != nil {
+			in = c.ReadA()
+		}
+		return c.pra&c.ddra | in&^c.ddra
+	case ciaPRB:
+		in := uint8(0xff)
+		if c.ReadB != nil {
+			in = c.ReadB()
+		}
+		return c.prb&c.ddrb | in&^c.ddrb
+	case ciaDDRA:
+		return c.ddra
+	case ciaDDRB:
+		return c.ddrb
+	case ciaTALO:
+		return uint8(c.ta)
+	case ciaTAHI:
+		return uint8(c.ta >> 8)
+	case ciaTBLO:
+		return uint8(c.tb)
+	case ciaTBHI:
+		return uint8(c.tb >> 8)
+	case ciaTOD10THS, ciaTODSEC, ciaTODMIN, ciaTODHR:
+		return c.tod[address&0xf-ciaTOD10THS]
+	case ciaSDR:
+		return c.sdr
+	case ciaICR:
+		value := c.icr
+		if c.icr&c.mask != 0 {
+			value |= 0x80
+		}
+		c.icr = 0
+		return value
+	case ciaCRA:
+		return c.cra
+	}
+	return c.crb // ciaCRB
+}
+
+// Peek reads a register without clearing the interrupt flags.
+func (c *CIA) Peek(address uint16) uint8 {
+	icr := c.icr
+	value := c.Load(address)
+	c.icr = icr
+	return value
+}
+
+func (c *CIA) Store(address uint16, value uint8) {
+	switch address & 0xf {
+	case ciaPRA:
+		c.pra = value
+		c.writeA()
+	case ciaPRB:
+		c.prb = value
+		c.writeB()
+	case ciaDDRA:
+		c.ddra = value
+		c.writeA()
+	case ciaDDRB:
+		c.ddrb = value
+		c.writeB()
+	case ciaTALO:
+		c.taLatch = c.taLatch&0xff00 | uint16(value)
+	case ciaTAHI:
+		c.taLatch = c.taLatch&0x00ff | uint16(value)<<8
+		c.cra = c.writeHi(c.cra, &c.ta, c.taLatch)
+	case ciaTBLO:
+		c.tbLatch = c.tbLatch&0xff00 | uint16(value)
+	case ciaTBHI:
+		c.tbLatch = c.tbLatch&0x00ff | uint16(value)<<8
+		c.crb = c.writeHi(c.crb, &c.tb, c.tbLatch)
+	case ciaTOD10THS, ciaTODSEC, ciaTODMIN, ciaTODHR:
+		c.tod[address&0xf-ciaTOD10THS] = value
+	case ciaSDR:
+		c.sdr = value
+	case ciaICR:
+		if value&0x80 != 0 {
+			c.mask |= value & 0x1f
+		} else {
+			c.mask &^= value & 0x1f
+		}
+	case ciaCRA:
+		if value&ciaLoad != 0 {
+			c.ta = int(c.taLatch)
+		}
+		c.cra = value &^ ciaLoad
+	case ciaCRB:
+		if value&ciaLoad != 0 {
+			c.tb = int(c.tbLatch)
+		}
+		c.crb = value &^ ciaLoad
+	}
+}
+
+// writeHi loads a stopped timer when the high byte of the latch is
+// written. A timer in one-shot mode is also started.
+func (c *CIA) writeHi(cr uint8, timer *int, latch uint16) uint8 {
+	if cr&ciaStart == 0 {
+		*timer = int(latch)
+		if cr&ciaOneShot != 0 {
+			cr |= ciaStart
+		}
+	}
+	return cr
+}
+
+// Service clocks the timers by the cycles the CPU has executed since the
+// last call.
+func (c *CIA) Service() error {
+	c.Clock(int(c.cpu.Cycles - c.cycles))
+	c.cycles = c.cpu.Cycles
+	if c.Interrupts && c.icr&c.mask != 0 && c.cpu.acceptsIRQ() {
+		c.cpu.IRQ()
+	}
+	return nil
+}
+
+// Flag signals a negative edge on the FLAG input.
+func (c *CIA) Flag() {
+	c.icr |= ciaIntFLG
+}
+
+// Clock advances the timers by the number of cycles given.
+func (c *CIA) Clock(cycles int) {
+	underflows := 0
+	if c.cra&ciaStart != 0 {
+		underflows = c.count(&c.cra, &c.ta, c.taLatch, cycles)
+		if underflows > 0 {
+			c.icr |= ciaIntTA
+		}
+	}
+	if c.crb&ciaStart != 0 {
+		n := 0
+		switch c.crb >> 5 & 0x3 {
+		case 0:
+			n = cycles
+		case 2:
+			n = underflows
+		}
+		if c.count(&c.crb, &c.tb, c.tbLatch, n) > 0 {
+			c.icr |= ciaIntTB
+		}
+	}
+}
+
+// count decrements the timer and returns the number of times it has
+// underflowed. The timer is reloaded from the latch on underflow and
+// stopped if in one-shot mode.
+func (c *CIA) count(cr *uint8, timer *int, latch uint16, n int) int {
+	*timer -= n
+	underflows := 0
+	for *timer < 0 {
+		underflows++
+		if *cr&ciaOneShot != 0 {
+			*cr &^= ciaStart
+			*timer = int(latch)
+			break
+		}
+		*timer += int(latch) + 1
+	}
+	return underflows
+}
+
+// state saves or restores the registers. The port outputs are written
+// again after a restore.
+func (c *CIA) state(s *stateCodec) {
+	s.fields(&c.Interrupts, &c.cycles, &c.pra, &c.prb, &c.ddra, &c.ddrb)
+	s.fields(&c.ta, &c.taLatch, &c.tb, &c.tbLatch, &c.cra, &c.crb)
+	s.fields(&c.icr, &c.mask, &c.sdr, &c.tod)
+	if s.restore {
+		c.writeA()
+		c.writeB()
+	}
+}
+
+// initCIAs replaces the RAM at $dc00 and $dd00 with the CIAs. Registers
+// start with the values the KERNAL stored there while they were still
+// RAM.
+func (m *Mach85) initCIAs() {
+	if m.cia1 != nil {
+		return
+	}
+	mem64 := m.Memory.Base.(*Memory64)
+	m.cia1 = NewCIA(m.cpu)
+	m.cia2 = NewCIA(m.cpu)
+	for _, c := range []struct {
+		cia  *CIA
+		base uint16
+	}{{m.cia1, 0xdc00}, {m.cia2, 0xdd00}} {
+		for reg := uint16(0); reg < 0x10; reg++ {
+			c.cia.Store(reg, mem64.io.Load(c.base-0xd000+reg))
+		}
+		mem64.MapIO(c.base, c.base+0xff, c.cia)
+		m.AddDevice(c.cia)
+	}
+}
+
+// useCIAInterrupts connects the first CIA to the IRQ line. Its timer then
+// replaces the jiffy clock as the source of the 60 Hz interrupt.
+func (m *Mach85) useCIAInterrupts() {
+	m.initCIAs()
+	if m.cia1.Interrupts {
+		return
+	}
+	m.cia1.Interrupts = true
+	m.RemoveDevice(m.clock)
+}
+
+// useJiffyClock disconnects the first CIA from the IRQ line and brings
+// back the jiffy clock.
+func (m *Mach85) useJiffyClock() {
+	if m.cia1 != nil {
+		m.cia1.Interrupts = false
+	}
+	if m.clock == nil {
+		return
+	}
+	m.RemoveDevice(m.clock)
+	m.AddDevice(m.clock)
+}
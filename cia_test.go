@@ -0,0 +1,88 @@
+package mach85
+
+import "testing"
+
+func TestCIATimerOneShot(t *testing.T) {
+	c := NewCIA(New6510(NewMemory(NewRAM(0x10000))))
+	// As the KERNAL does when waiting for EOI on the serial bus
+	c.Store(ciaTBHI, 0x01)
+	c.Store(ciaCRB, ciaStart|ciaOneShot|ciaLoad)
+	c.Clock(0x100)
+	if c.Load(ciaICR)&ciaIntTB != 0 {
+		t.Fatalf("timer expired early")
+	}
+	c.Clock(1)
+	if c.Load(ciaICR)&ciaIntTB == 0 {
+		t.Fatalf("timer did not expire")
+	}
+	if c.Load(ciaICR) != 0 {
+		t.Errorf("interrupt flags not cleared on read")
+	}
+	if c.Load(ciaCRB)&ciaStart != 0 {
+		t.Errorf("one shot timer not stopped")
+	}
+}
+
+func TestCIATimerContinuous(t *testing.T) {
+	c := NewCIA(New6510(NewMemory(NewRAM(0x10000))))
+	c.Store(ciaTALO, 0x09)
+	c.Store(ciaTAHI, 0x00)
+	c.Store(ciaTBLO, 0x01)
+	c.Store(ciaTBHI, 0x00)
+	c.Store(ciaCRA, ciaStart)
+	c.Store(ciaCRB, ciaStart|0x40) // count timer A underflows
+	c.Clock(20)
+	if have := c.Load(ciaICR); have != ciaIntTA|ciaIntTB {
+		t.Errorf("\n want: %02x \n have: %02x \n", ciaIntTA|ciaIntTB, have)
+	}
+	if have := c.Load(ciaTALO); have != 9 {
+		t.Errorf("\n want: %v \n have: %v \n", 9, have)
+	}
+}
+
+func TestCIAService(t *testing.T) {
+	cpu := New6510(NewMemory(NewRAM(0x10000)))
+	c := NewCIA(cpu)
+	c.Store(ciaTALO, 0x20)
+	c.Store(ciaTAHI, 0x00)
+	c.Store(ciaCRA, ciaStart)
+	cpu.Cycles += 0x10
+	c.Service()
+	if have := c.Load(ciaTALO); have != 0x10 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x10, have)
+	}
+}
+
+func TestCIAInterruptNotNested(t *testing.T) {
+	cpu := New6510(NewMemory(NewRAM(0x10000)))
+	cpu.mem.StoreN(0x0200, 0x58, 0x4c, 0x01, 0x02) // cli, jmp $0201
+	cpu.mem.StoreN(0x0300, 0xea, 0xea, 0xea, 0xea, 0xea)
+	cpu.mem.StoreN(0x0305, 0xad, 0x0d, 0xdc, 0x40) // lda $dc0d, rti
+	cpu.mem.Store16(AddrIrqVector, 0x0300)
+	cpu.PC = 0x0200 - 1
+	cpu.SP = 0xff
+	c := NewCIA(cpu)
+	c.Interrupts = true
+	c.Store(ciaTALO, 0x20)
+	c.Store(ciaTAHI, 0x00)
+	c.Store(ciaICR, 0x80|ciaIntTA)
+	c.Store(ciaCRA, ciaStart)
+	handled := 0
+	for cpu.Cycles < 2000 {
+		if cpu.PC+1 == 0x0305 {
+			// The CIA is not mapped into memory
+			c.Load(ciaICR)
+			handled++
+		}
+		if err := cpu.Next(); err != nil {
+			t.Fatal(err)
+		}
+		c.Service()
+		if cpu.SP < 0xfc {
+			t.Fatalf("interrupts nested: sp $%02x", cpu.SP)
+		}
+	}
+	if handled == 0 {
+		t.Errorf("no interrupts handled")
+	}
+}
@@ -4,21 +4,54 @@ import "time"
 
 // https://www.c64-wiki.com/wiki/Jiffy_Clock
 
+// Cycles between interrupts with the timer value set by the KERNAL, NTSC
+const jiffyCycles = 0x4295 + 1
+
+// JiffyClock interrupts the CPU 60 times per second. The time is measured
+// in cycles executed so that a program runs the same way each time.
 type JiffyClock struct {
-	lastUpdate time.Time
+	lastUpdate uint64
 	cpu        *CPU
 }
 
 func NewJiffyClock(cpu *CPU) *JiffyClock {
-	return &JiffyClock{cpu: cpu}
+	return &JiffyClock{cpu: cpu, lastUpdate: cpu.Cycles}
 }
 
 func (c *JiffyClock) Service() error {
-	now := time.Now()
-	if now.Sub(c.lastUpdate) < 16800000 { // 16.8 ms, NTSC
+	if c.cpu.Cycles-c.lastUpdate < jiffyCycles {
 		return nil
 	}
-	c.lastUpdate = now
+	c.lastUpdate = c.cpu.Cycles
 	c.cpu.IRQ()
 	return nil
 }
+
+func (c *JiffyClock) state(s *stateCodec) {
+	s.fields(&c.lastUpdate)
+}
+
+// pacer slows the machine down to the speed of the real one.
+type pacer struct {
+	start  time.Time
+	cycles uint64
+}
+
+// restart measures from the cycle count given, after the machine has
+// been stopped.
+func (p *pacer) restart(cycles uint64) {
+	p.start = time.Now()
+	p.cycles = cycles
+}
+
+// wait sleeps while the machine is ahead of the wall clock.
+func (p *pacer) wait(cycles uint64) {
+	if cycles < p.cycles {
+		p.restart(cycles)
+		return
+	}
+	due := time.Duration(cycles-p.cycles) * time.Second / ClockRateNTSC
+	if ahead := due - time.Since(p.start); ahead > time.Millisecond {
+		time.Sleep(ahead)
+	}
+}
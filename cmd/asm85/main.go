@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blackchip-org/mach85/asm"
+)
+
+var (
+	listing string
+	out     string
+	raw     bool
+	symbols string
+)
+
+func init() {
+	flag.StringVar(&listing, "l", "", "write a listing to this file")
+	flag.StringVar(&out, "o", "", "write the program to this file instead of the source name with .prg or .bin")
+	flag.BoolVar(&raw, "raw", false, "write a raw binary without the load address")
+	flag.StringVar(&symbols, "s", "", "write the symbols to this file")
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: asm85 [options] file.s\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	source := flag.Arg(0)
+
+	prog, err := asm.Assemble(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	data := prog.PRG()
+	ext := ".prg"
+	if raw {
+		data = prog.Code
+		ext = ".bin"
+	}
+	if out == "" {
+		out = strings.TrimSuffix(source, filepath.Ext(source)) + ext
+	}
+	if err := ioutil.WriteFile(out, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if listing != "" {
+		if err := writeFile(listing, prog.WriteListing); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if symbols != "" {
+		if err := writeFile(symbols, prog.WriteSymbols); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func writeFile(filename string, write func(io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
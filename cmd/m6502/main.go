@@ -9,7 +9,10 @@ import (
 func main() {
 	log.SetFlags(0)
 
-	mach := mach85.New()
+	mach, err := mach85.NewMachine(mach85.Profiles["6502"])
+	if err != nil {
+		log.Fatal(err)
+	}
 	mach.AddDevice(mach85.NewWatchdog(mach))
 	mon := mach85.NewMonitor(mach)
 	mon.Prompt = "m6502> "
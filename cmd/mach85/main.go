@@ -12,10 +12,36 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-var wait bool
+var (
+	cart      string
+	disk      string
+	input     string
+	machine   string
+	reu       int
+	rewind    int
+	snapshot  string
+	symbols   string
+	tape      string
+	trueDrive bool
+	wait      bool
+	wav       string
+	wavRate   int
+)
 
 func init() {
+	flag.StringVar(&cart, "cart", "", "attach this CRT cartridge")
+	flag.StringVar(&disk, "disk", "", "attach this disk image or directory as device 8")
+	flag.StringVar(&input, "input", "", "play back the input recorded in this file")
+	flag.StringVar(&machine, "machine", "c64", "machine to emulate: c64, pet, vic20, 6502 or a profile file")
+	flag.IntVar(&reu, "reu", 0, "attach an REU with this size in kilobytes")
+	flag.IntVar(&rewind, "rewind", 0, "keep this many frames of history for rewinding")
+	flag.StringVar(&snapshot, "snapshot", "", "start from the state saved in this snapshot")
+	flag.StringVar(&symbols, "symbols", "", "load the symbols in this label file")
+	flag.StringVar(&tape, "tape", "", "insert this T64 or TAP file into the datasette")
+	flag.BoolVar(&trueDrive, "true-drive", false, "emulate 1541 hardware for D64 images")
 	flag.BoolVar(&wait, "w", false, "wait for user to issue go command")
+	flag.StringVar(&wav, "wav", "", "record sound to this WAV file")
+	flag.IntVar(&wavRate, "wav-rate", 44100, "sample rate for the WAV file")
 }
 
 func main() {
@@ -28,19 +54,78 @@ func main() {
 	defer sdl.Quit()
 	sdl.GLSetSwapInterval(1)
 
-	mach := mach85.New()
+	profile, err := mach85.LookupProfile(machine)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mach, err := mach85.NewMachine(profile)
+	if err != nil {
+		log.Fatalf("unable to create machine: %v", err)
+	}
 	if err := mach.Init(); err != nil {
 		log.Fatalf("unable to initialize: %v", err)
 	}
+	if cart != "" {
+		if err := mach.AttachCartridge(cart); err != nil {
+			log.Fatalf("unable to attach cartridge: %v", err)
+		}
+	}
+	if reu != 0 {
+		if err := mach.AttachREU(reu); err != nil {
+			log.Fatalf("unable to attach REU: %v", err)
+		}
+	}
+	if rewind != 0 {
+		if err := mach.EnableRewind(rewind); err != nil {
+			log.Fatalf("unable to enable rewind: %v", err)
+		}
+	}
+	mach.EmulateDrives = trueDrive
+	mach.RealTime = true
+	if disk != "" {
+		if err := mach.AttachDisk(8, disk); err != nil {
+			log.Fatalf("unable to attach disk: %v", err)
+		}
+	}
+	if tape != "" {
+		if err := mach.AttachTape(tape); err != nil {
+			log.Fatalf("unable to attach tape: %v", err)
+		}
+	}
+	if snapshot != "" {
+		if err := mach.LoadSnapshot(snapshot); err != nil {
+			log.Fatalf("unable to load snapshot: %v", err)
+		}
+	}
+	if input != "" {
+		if err := mach.PlayInput(input); err != nil {
+			log.Fatalf("unable to play input: %v", err)
+		}
+	}
+	if wav != "" {
+		if err := mach.RecordSID(wav, wavRate); err != nil {
+			log.Fatalf("unable to record: %v", err)
+		}
+	}
 	mon := mach85.NewMonitor(mach)
-	in, err := os.Open(filepath.Join(rom.Path, "c64rom_en.source"))
-	if err != nil {
-		log.Fatal(err)
+	if profile.Name == "c64" {
+		in, err := os.Open(filepath.Join(rom.Path, "c64rom_en.source"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		decoder := json.NewDecoder(in)
+		source := &mach85.Source{}
+		decoder.Decode(source)
+		mon.Disassembler.LoadSource(source)
+		mon.Disassembler.LoadSource(&mach85.Source{Symbols: mach85.C64Symbols})
+	}
+	if symbols != "" {
+		source, err := mach85.LoadSymbols(symbols)
+		if err != nil {
+			log.Fatalf("unable to load symbols: %v", err)
+		}
+		mon.Disassembler.LoadSource(source)
 	}
-	decoder := json.NewDecoder(in)
-	source := &mach85.Source{}
-	decoder.Decode(source)
-	mon.Disassembler.LoadSource(source)
 
 	go mon.Run()
 	if !wait {
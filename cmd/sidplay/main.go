@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/blackchip-org/mach85"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+var (
+	song    int
+	seconds int
+	wav     string
+	wavRate int
+)
+
+func init() {
+	flag.IntVar(&song, "song", 0, "song number to play instead of the default")
+	flag.IntVar(&seconds, "seconds", 0, "stop playing after this many seconds")
+	flag.StringVar(&wav, "wav", "", "write sound to this WAV file instead of playing it")
+	flag.IntVar(&wavRate, "wav-rate", 44100, "sample rate for the WAV file")
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: sidplay [options] file.sid\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	tune, err := mach85.LoadPSID(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("unable to load tune: %v", err)
+	}
+	model := tune.Model()
+	// Only override the model from the tune when given on the command line
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "sid-model" {
+			model, err = mach85.ParseSIDModel(f.Value.String())
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	})
+	if song == 0 {
+		song = tune.StartSong
+	}
+
+	player := mach85.NewSIDPlayer(tune, model)
+	if err := player.Init(song); err != nil {
+		log.Fatalf("unable to start tune: %v", err)
+	}
+	clock := "NTSC"
+	if tune.PAL() {
+		clock = "PAL"
+	}
+	fmt.Printf("%v\n%v\n%v\n", tune.Name, tune.Author, tune.Released)
+	fmt.Printf("song %v of %v, %v, %v\n", song, tune.Songs, model, clock)
+
+	if wav != "" {
+		if seconds == 0 {
+			log.Fatalf("number of seconds required when writing a WAV file")
+		}
+		if err := record(player); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := play(player); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func record(player *mach85.SIDPlayer) error {
+	out, err := os.Create(wav)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := mach85.NewWAVWriter(out, wavRate)
+	if err != nil {
+		return err
+	}
+	player.SID.SampleRate = wavRate
+	total := seconds * wavRate
+	var samples []int16
+	for written := 0; written < total; {
+		samples, err = player.Frame(samples[:0])
+		if err != nil {
+			return err
+		}
+		if written+len(samples) > total {
+			samples = samples[:total-written]
+		}
+		if err := w.Write(samples); err != nil {
+			return err
+		}
+		written += len(samples)
+	}
+	return nil
+}
+
+func play(player *mach85.SIDPlayer) error {
+	if err := sdl.Init(sdl.INIT_AUDIO); err != nil {
+		return fmt.Errorf("unable to initialize sdl: %v", err)
+	}
+	defer sdl.Quit()
+	audio, err := mach85.NewAudio(player.SID)
+	if err != nil {
+		return fmt.Errorf("unable to open audio: %v", err)
+	}
+
+	rate := player.SID.SampleRate
+	total := seconds * rate
+	lowWater := rate / 10 // 100 ms
+	var samples []int16
+	for played := 0; seconds == 0 || played < total; {
+		if audio.Queued() > lowWater {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		samples, err = player.Frame(samples[:0])
+		if err != nil {
+			return err
+		}
+		if err := audio.Queue(samples); err != nil {
+			return err
+		}
+		played += len(samples)
+	}
+	// Let the last of the samples play out
+	for audio.Queued() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
@@ -20,9 +20,13 @@ type CPU struct {
 	V bool // Overflow flag
 	N bool // Signed flag
 
+	Cycles uint64 // Number of cycles executed
+
 	mem   *Memory
 	inISR bool
+	calls []Call
 	irq   chan bool
+	nmi   chan bool
 	reset chan bool
 }
 
@@ -41,6 +45,7 @@ func New6510(mem *Memory) *CPU {
 	return &CPU{
 		mem:   mem,
 		irq:   make(chan bool, 10),
+		nmi:   make(chan bool, 10),
 		reset: make(chan bool, 10),
 	}
 }
@@ -124,7 +129,9 @@ func (c *CPU) brk() {
 	c.push(c.SR())
 	c.I = true
 	c.B = false
+	from := c.PC - 1
 	c.PC = c.mem.Load16(AddrIrqVector) - 1
+	c.call(CallBrk, from, c.PC+1)
 }
 
 func (c *CPU) Next() error {
@@ -135,6 +142,7 @@ func (c *CPU) Next() error {
 	} else {
 		execute(c)
 	}
+	c.Cycles += uint64(opcodes[opcode].cycles)
 	if opcode == 0x40 { // rti
 		c.inISR = false
 	}
@@ -146,6 +154,7 @@ func (c *CPU) Next() error {
 		c.SP = 0
 		c.SetSR(0)
 		c.inISR = false
+		c.calls = nil
 		// Vector is actual start address so set the PC one byte behind
 		c.PC = c.mem.Load16(AddrResetVector) - 1
 	case <-c.irq:
@@ -153,11 +162,25 @@ func (c *CPU) Next() error {
 			// http://www.6502.org/tutorials/6502opcodes.html#RTI
 			// Note that unlike RTS, the return address on the stack is the
 			// actual address rather than the address-1.
+			from := c.PC + 1
 			c.push16(c.PC + 1)
 			c.push(c.SR())
+			c.I = true
 			c.PC = c.mem.Load16(AddrIrqVector) - 1
+			c.call(CallIRQ, from, c.PC+1)
 			c.inISR = true
+			c.Cycles += 7
 		}
+	case <-c.nmi:
+		// Cannot be disabled
+		from := c.PC + 1
+		c.push16(c.PC + 1)
+		c.push(c.SR())
+		c.I = true
+		c.PC = c.mem.Load16(AddrNmiVector) - 1
+		c.call(CallNMI, from, c.PC+1)
+		c.inISR = true
+		c.Cycles += 7
 	default:
 	}
 	return nil
@@ -167,6 +190,42 @@ func (c *CPU) IRQ() {
 	c.irq <- true
 }
 
+// acceptsIRQ reports whether a device holding the IRQ line should request
+// an interrupt. The I flag is set while the handler runs, so a device
+// that is still waiting to be acknowledged asks again only after the
+// handler returns.
+func (c *CPU) acceptsIRQ() bool {
+	return !c.I && len(c.irq) == 0
+}
+
+func (c *CPU) NMI() {
+	c.nmi <- true
+}
+
+// state saves or restores the registers along with the interrupts that
+// are waiting to be handled.
+func (c *CPU) state(s *stateCodec) {
+	s.fields(&c.PC, &c.A, &c.X, &c.Y, &c.SP)
+	s.fields(&c.C, &c.Z, &c.I, &c.D, &c.B, &c.V, &c.N)
+	s.fields(&c.Cycles, &c.inISR)
+	if s.restore {
+		c.calls = nil
+	}
+	for _, ch := range []chan bool{c.irq, c.nmi, c.reset} {
+		pending := len(ch)
+		s.fields(&pending)
+		if !s.restore {
+			continue
+		}
+		for len(ch) > 0 {
+			<-ch
+		}
+		for i := 0; i < pending; i++ {
+			ch <- true
+		}
+	}
+}
+
 func (c *CPU) setFlagsNZ(value uint8) {
 	c.Z = value == 0
 	c.N = value&(1<<7) != 0
@@ -184,6 +184,9 @@ func TestIRQ(t *testing.T) {
 	if want != have {
 		t.Errorf("\n want: %02x \n have: %02x\n", want, have)
 	}
+	if !c.I {
+		t.Errorf("interrupts not disabled in handler")
+	}
 }
 
 func TestIRQIgnore(t *testing.T) {
@@ -198,3 +201,19 @@ func TestIRQIgnore(t *testing.T) {
 		t.Errorf("\n want: %02x \n have: %02x\n", want, have)
 	}
 }
+
+func TestNMI(t *testing.T) {
+	c := newTestCPU()
+	c.mem.Store(0x0200, 0xea)         // nop
+	c.mem.StoreN(AddrISR, 0xa9, 0x12) // lda #12
+	c.mem.Store16(AddrNmiVector, AddrISR)
+	c.I = true
+	c.NMI()
+	c.Next()
+	c.Next()
+	want := uint8(0x12)
+	have := c.A
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x\n", want, have)
+	}
+}
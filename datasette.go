@@ -0,0 +1,174 @@
+package mach85
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Device number of the datasette
+const tapeDevice = 1
+
+// Bit in the processor port that is clear when a button is pressed on the
+// datasette
+const cassetteSense = 0x10
+
+// Datasette is a tape drive with either a T64 container or a TAP image
+// inserted. Files in a T64 are read by replacing the KERNAL LOAD routine.
+// A TAP is played as pulses on the FLAG line of the first CIA for the
+// KERNAL, or a loader on the tape, to decode. The motor is not emulated
+// and the tape runs whenever PLAY is pressed.
+type Datasette struct {
+	Filename string
+	T64      *T64
+	TAP      *TAP
+	Playing  bool
+	pos      int // next T64 entry or TAP pulse
+	wait     int // cycles left in the current pulse
+	cpu      *CPU
+	mem      *Memory64
+	cia      *CIA
+	cycles   uint64
+}
+
+// LoadTape reads a T64 or TAP file.
+func LoadTape(filename string) (*Datasette, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	d := &Datasette{Filename: filename}
+	if bytes.HasPrefix(data, []uint8(tapSignature)) {
+		d.TAP, err = ParseTAP(data)
+	} else {
+		d.T64, err = ParseT64(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filepath.Base(filename), err)
+	}
+	return d, nil
+}
+
+func (d *Datasette) Play() {
+	d.Playing = true
+}
+
+func (d *Datasette) Stop() {
+	d.Playing = false
+}
+
+func (d *Datasette) Rewind() {
+	d.Playing = false
+	d.pos = 0
+	d.wait = 0
+}
+
+// Service presses the cassette sense line while playing and sends the
+// pulses that have passed under the head since the last call.
+func (d *Datasette) Service() error {
+	cycles := int(d.cpu.Cycles - d.cycles)
+	d.cycles = d.cpu.Cycles
+	port := d.mem.Chunks[RAM0].Load(AddrProcessorPort)
+	if d.Playing {
+		d.mem.Chunks[RAM0].Store(AddrProcessorPort, port&^cassetteSense)
+	} else {
+		d.mem.Chunks[RAM0].Store(AddrProcessorPort, port|cassetteSense)
+	}
+	if !d.Playing || d.TAP == nil {
+		return nil
+	}
+	d.wait -= cycles
+	for d.wait <= 0 {
+		if d.pos >= len(d.TAP.Pulses) {
+			d.Stop()
+			return nil
+		}
+		d.cia.Flag()
+		d.wait += d.TAP.Pulses[d.pos]
+		d.pos++
+	}
+	return nil
+}
+
+func (d *Datasette) state(s *stateCodec) {
+	s.fields(&d.Playing, &d.pos, &d.wait, &d.cycles)
+}
+
+func (d *Datasette) String() string {
+	state := "stopped"
+	if d.Playing {
+		state = "playing"
+	}
+	n := 0
+	if d.T64 != nil {
+		n = len(d.T64.Entries)
+	} else {
+		n = len(d.TAP.Pulses)
+	}
+	return fmt.Sprintf("%v (%v, %v/%v)", d.Filename, state, d.pos, n)
+}
+
+// AttachTape inserts a T64 or TAP file into the datasette. Playing a TAP
+// connects the first CIA to the IRQ line in place of the jiffy clock.
+func (m *Mach85) AttachTape(filename string) error {
+	mem64, err := m.mem64()
+	if err != nil {
+		return err
+	}
+	d, err := LoadTape(filename)
+	if err != nil {
+		return err
+	}
+	m.DetachTape()
+	d.cpu = m.cpu
+	d.mem = mem64
+	d.cycles = m.cpu.Cycles
+	if d.TAP != nil {
+		m.useCIAInterrupts()
+		d.cia = m.cia1
+	}
+	m.tape = d
+	m.AddDevice(d)
+	return nil
+}
+
+// DetachTape removes the tape. The jiffy clock is used again for the 60 Hz
+// interrupt if a TAP was attached.
+func (m *Mach85) DetachTape() error {
+	if m.tape == nil {
+		return fmt.Errorf("no tape attached")
+	}
+	if m.tape.TAP != nil {
+		m.useJiffyClock()
+	}
+	m.RemoveDevice(m.tape)
+	m.tape = nil
+	return nil
+}
+
+// Tape returns the datasette or nil if no tape is attached.
+func (m *Mach85) Tape() *Datasette {
+	return m.tape
+}
+
+// trapTapeLoad replaces LOAD from the datasette when a T64 is inserted.
+// Files are read in order from the position of the tape, as the KERNAL
+// would, and an empty name loads the next file.
+func (m *Mach85) trapTapeLoad() bool {
+	if m.tape == nil || m.tape.T64 == nil {
+		return false
+	}
+	verify := m.cpu.A != 0
+	m.Memory.Store(AddrVerifyFlag, m.cpu.A)
+	m.Memory.Store(AddrStatus, 0)
+	i, err := m.tape.T64.Find(m.filename(), m.tape.pos)
+	if err != nil {
+		m.tape.pos = len(m.tape.T64.Entries)
+		m.kernalReturn(kernalErrFileNotFound)
+		return true
+	}
+	m.tape.pos = i + 1
+	m.loadData(m.tape.T64.Entries[i].Program(), verify)
+	return true
+}
@@ -0,0 +1,112 @@
+package mach85
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func newTestTape(t *testing.T, data []uint8) (*Mach85, string) {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(data)
+	file.Close()
+	mach := New()
+	mach.StopOnBreak = true
+	mach.QuitOnStop = true
+	if err := mach.AttachTape(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	return mach, file.Name()
+}
+
+func TestTapeLoadT64(t *testing.T) {
+	mach, name := newTestTape(t, testT64([]uint8{1, 2}, []uint8{3, 4, 5}))
+	defer os.Remove(name)
+	testKernalCallDevice(mach, tapeDevice, AddrKernalLoad, "", 1, 0)
+	if mach.cpu.C {
+		t.Fatalf("unexpected error: %v", mach.cpu.A)
+	}
+	if mach.Memory.Load(0xc001) != 2 {
+		t.Errorf("\n want: %v \n have: %v \n", 2, mach.Memory.Load(0xc001))
+	}
+	// Next file on the tape
+	testKernalCallDevice(mach, tapeDevice, AddrKernalLoad, "", 1, 0)
+	if mach.Memory.Load(0xc102) != 5 {
+		t.Errorf("\n want: %v \n have: %v \n", 5, mach.Memory.Load(0xc102))
+	}
+	// End of tape
+	testKernalCallDevice(mach, tapeDevice, AddrKernalLoad, "", 1, 0)
+	if !mach.cpu.C || mach.cpu.A != kernalErrFileNotFound {
+		t.Errorf("\n want: %v \n have: %v \n", kernalErrFileNotFound, mach.cpu.A)
+	}
+	mach.Tape().Rewind()
+	testKernalCallDevice(mach, tapeDevice, AddrKernalLoad, "BPROG", 1, 0)
+	if mach.cpu.C {
+		t.Errorf("unexpected error: %v", mach.cpu.A)
+	}
+}
+
+func TestTapePlayTAP(t *testing.T) {
+	data := append([]uint8(tapSignature), 1, 0, 0, 0, 2, 0, 0, 0)
+	data = append(data, 0x30, 0x30)
+	mach, name := newTestTape(t, data)
+	defer os.Remove(name)
+	tape := mach.Tape()
+
+	tape.Service()
+	if mach.Memory.Load(AddrProcessorPort)&cassetteSense == 0 {
+		t.Errorf("sense line pressed when stopped")
+	}
+	tape.Play()
+	tape.Service()
+	if mach.Memory.Load(AddrProcessorPort)&cassetteSense != 0 {
+		t.Errorf("sense line not pressed when playing")
+	}
+	if mach.cia1.Load(0xdc0d)&ciaIntFLG == 0 {
+		t.Fatalf("no pulse at start of tape")
+	}
+	mach.cpu.Cycles += 0x30*8 - 1
+	tape.Service()
+	if mach.cia1.Load(0xdc0d)&ciaIntFLG != 0 {
+		t.Fatalf("pulse too early")
+	}
+	mach.cpu.Cycles++
+	tape.Service()
+	if mach.cia1.Load(0xdc0d)&ciaIntFLG == 0 {
+		t.Fatalf("no pulse")
+	}
+	mach.cpu.Cycles += 0x30 * 8
+	tape.Service()
+	if tape.Playing {
+		t.Errorf("still playing at end of tape")
+	}
+}
+
+func TestTapeDetachTAP(t *testing.T) {
+	data := append([]uint8(tapSignature), 1, 0, 0, 0, 2, 0, 0, 0)
+	data = append(data, 0x30, 0x30)
+	mach, name := newTestTape(t, data)
+	defer os.Remove(name)
+	// Removed when the TAP was attached, as the clock is added by Init
+	mach.clock = NewJiffyClock(mach.cpu)
+	hasClock := func() bool {
+		for _, d := range mach.devices {
+			if d == mach.clock {
+				return true
+			}
+		}
+		return false
+	}
+	if hasClock() {
+		t.Errorf("jiffy clock used with a TAP attached")
+	}
+	if err := mach.DetachTape(); err != nil {
+		t.Fatal(err)
+	}
+	if !hasClock() || mach.cia1.Interrupts {
+		t.Errorf("jiffy clock not used after detach")
+	}
+}
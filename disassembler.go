@@ -12,20 +12,26 @@ type Operation struct {
 	Operand     uint16
 	Bytes       []uint8
 	Comment     string
+	Symbol      string
 }
 
 type Source struct {
 	Comments map[uint16]string `json:"comments"`
+	Symbols  map[string]uint16 `json:"symbols,omitempty"`
 }
 
 func NewSource() *Source {
-	return &Source{Comments: make(map[uint16]string)}
+	return &Source{
+		Comments: make(map[uint16]string),
+		Symbols:  make(map[string]uint16),
+	}
 }
 
 type Disassembler struct {
 	PC     uint16
 	mem    *Memory
 	source *Source
+	names  map[uint16]string
 }
 
 func NewDisassembler(mem *Memory) *Disassembler {
@@ -33,6 +39,7 @@ func NewDisassembler(mem *Memory) *Disassembler {
 		PC:     0xffff,
 		mem:    mem,
 		source: NewSource(),
+		names:  make(map[uint16]string),
 	}
 }
 
@@ -71,9 +78,22 @@ func (d *Disassembler) Next() Operation {
 	result.Instruction = op.inst
 	result.Mode = op.mode
 	result.Operand = operand
+	switch op.mode {
+	case Implied, Accumulator, Immediate:
+	case Relative:
+		result.Symbol = d.names[result.target()]
+	default:
+		result.Symbol = d.Name(operand)
+	}
 	return result
 }
 
+// target is the address a branch instruction jumps to. The offset is
+// relative to the address after the instruction.
+func (o Operation) target() uint16 {
+	return o.Address + uint16(int8(o.Operand)) + 2
+}
+
 func (o Operation) String() string {
 	b0 := fmt.Sprintf("%02x", o.Bytes[0])
 	b1, b2 := "  ", "  "
@@ -91,17 +111,15 @@ func (o Operation) String() string {
 		// the instruction
 		value := o.Operand
 		if o.Mode == Relative {
-			value8 := int8(value)
-			if value8 >= 0 {
-				value = o.Address + uint16(value8) + 2
-			} else {
-				value = o.Address - uint16(value8*-1) + 2
-			}
+			value = o.target()
 		}
 		// If the format does not contain a formatting directive, just use as is.
 		// For example: "asl a"
 		if strings.Contains(format, "%") {
 			operand = " " + fmt.Sprintf(format, value)
+			if o.Symbol != "" {
+				operand = " " + symbolFormat(format, o.Symbol)
+			}
 		} else {
 			operand = " " + format
 		}
@@ -122,4 +140,43 @@ func (d *Disassembler) LoadSource(source *Source) {
 	for address, text := range source.Comments {
 		d.source.Comments[address] = text
 	}
+	for name, address := range source.Symbols {
+		d.source.Symbols[name] = address
+		// When more than one name has the same address, use the first in
+		// alphabetical order so that the output is always the same
+		if prev, ok := d.names[address]; !ok || name < prev {
+			d.names[address] = name
+		}
+	}
+}
+
+// Lookup returns the address of a symbol.
+func (d *Disassembler) Lookup(name string) (uint16, bool) {
+	address, ok := d.source.Symbols[name]
+	return address, ok
+}
+
+// Name returns the symbol for an address. If there is none, the byte
+// before is tried so that the high byte of a word is shown as NAME+1.
+func (d *Disassembler) Name(address uint16) string {
+	if name, ok := d.names[address]; ok {
+		return name
+	}
+	if name, ok := d.names[address-1]; ok && address != 0 {
+		return name + "+1"
+	}
+	return ""
+}
+
+// symbolFormat replaces the hex value in an operand format with a name.
+func symbolFormat(format string, name string) string {
+	i := strings.Index(format, "$%")
+	if i < 0 {
+		return format
+	}
+	j := i + 2
+	for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+		j++
+	}
+	return format[:i] + name + format[j+1:]
 }
@@ -0,0 +1,703 @@
+package mach85
+
+// http://unusedino.de/ec64/technical/formats/d64.html
+// http://unusedino.de/ec64/technical/formats/d71.html
+// http://unusedino.de/ec64/technical/formats/d81.html
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+type FileType uint8
+
+const (
+	FileDEL FileType = iota
+	FileSEQ
+	FilePRG
+	FileUSR
+	FileREL
+)
+
+const (
+	fileClosed = 0x80
+	fileLocked = 0x40
+)
+
+var fileTypeNames = map[FileType]string{
+	FileDEL: "DEL",
+	FileSEQ: "SEQ",
+	FilePRG: "PRG",
+	FileUSR: "USR",
+	FileREL: "REL",
+}
+
+func (f FileType) String() string {
+	if name, ok := fileTypeNames[f]; ok {
+		return name
+	}
+	return "???"
+}
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrFileExists   = errors.New("file exists")
+	ErrDiskFull     = errors.New("disk full")
+	ErrDirFull      = errors.New("directory full")
+)
+
+const (
+	sectorLen   = 0x100
+	dirEntryLen = 0x20
+	padChar     = 0xa0 // shifted space used to pad names
+)
+
+// DiskFormat describes the layout of a disk image.
+type DiskFormat struct {
+	Name          string
+	Tracks        int
+	DOSType       string
+	sectors       func(track int) int
+	dirTrack      int
+	dirSector     int // first directory sector
+	reservedTrack int // not used for files, other than the directory track
+	interleave    int
+	dirInterleave int
+	nameOffset    int // disk name in the header sector
+	bam           func(d *DiskImage, track int) (int, int)
+	format        func(d *DiskImage)
+}
+
+func sectors1541(track int) int {
+	switch {
+	case track <= 17:
+		return 21
+	case track <= 24:
+		return 19
+	case track <= 30:
+		return 18
+	}
+	return 17
+}
+
+var (
+	FormatD64 = &DiskFormat{
+		Name:          "d64",
+		Tracks:        35,
+		DOSType:       "2A",
+		sectors:       sectors1541,
+		dirTrack:      18,
+		dirSector:     1,
+		interleave:    10,
+		dirInterleave: 3,
+		nameOffset:    0x90,
+		bam:           bamD64,
+		format:        formatD64,
+	}
+	FormatD71 = &DiskFormat{
+		Name:    "d71",
+		Tracks:  70,
+		DOSType: "2A",
+		sectors: func(track int) int {
+			if track > 35 {
+				track -= 35
+			}
+			return sectors1541(track)
+		},
+		dirTrack:      18,
+		dirSector:     1,
+		reservedTrack: 53,
+		interleave:    6,
+		dirInterleave: 3,
+		nameOffset:    0x90,
+		bam:           bamD71,
+		format:        formatD71,
+	}
+	FormatD81 = &DiskFormat{
+		Name:          "d81",
+		Tracks:        80,
+		DOSType:       "3D",
+		sectors:       func(int) int { return 40 },
+		dirTrack:      40,
+		dirSector:     3,
+		interleave:    1,
+		dirInterleave: 1,
+		nameOffset:    0x04,
+		bam:           bamD81,
+		format:        formatD81,
+	}
+)
+
+var diskFormats = []*DiskFormat{FormatD64, FormatD71, FormatD81}
+
+func (f *DiskFormat) size() int {
+	total := 0
+	for t := 1; t <= f.Tracks; t++ {
+		total += f.sectors(t)
+	}
+	return total * sectorLen
+}
+
+// bamD64 returns the offsets of the free sector count and the bitmap
+// for a track.
+func bamD64(d *DiskImage, track int) (int, int) {
+	header := d.offset(18, 0)
+	entry := header + 4 + (track-1)*4
+	return entry, entry + 1
+}
+
+func bamD71(d *DiskImage, track int) (int, int) {
+	if track <= 35 {
+		return bamD64(d, track)
+	}
+	header := d.offset(18, 0)
+	return header + 0xdd + track - 36, d.offset(53, 0) + (track-36)*3
+}
+
+func bamD81(d *DiskImage, track int) (int, int) {
+	sector := 1
+	if track > 40 {
+		sector = 2
+		track -= 40
+	}
+	entry := d.offset(40, sector) + 0x10 + (track-1)*6
+	return entry, entry + 1
+}
+
+func formatD64(d *DiskImage) {
+	header := d.data[d.offset(18, 0):]
+	header[0] = 18
+	header[1] = 1
+	header[2] = 'A'
+	copy(header[0xa0:0xab], []uint8{padChar, padChar, 0, 0, padChar, '2', 'A',
+		padChar, padChar, padChar, padChar})
+}
+
+func formatD71(d *DiskImage) {
+	formatD64(d)
+	d.data[d.offset(18, 0)+3] = 0x80 // double sided
+	for s := 0; s < d.Format.sectors(53); s++ {
+		d.allocate(53, s)
+	}
+}
+
+func formatD81(d *DiskImage) {
+	header := d.data[d.offset(40, 0):]
+	header[0] = 40
+	header[1] = 3
+	header[2] = 'D'
+	copy(header[0x14:0x1d], []uint8{padChar, padChar, 0, 0, padChar, '3', 'D',
+		padChar, padChar})
+	for s := 1; s <= 2; s++ {
+		bam := d.data[d.offset(40, s):]
+		if s == 1 {
+			bam[0] = 40
+			bam[1] = 2
+		} else {
+			bam[1] = 0xff
+		}
+		bam[2] = 'D'
+		bam[3] = 0xbb
+		bam[6] = 0xc0
+	}
+}
+
+// DiskImage is the contents of a floppy disk stored in a file on the host.
+// Changes are written back to the file.
+type DiskImage struct {
+	Format   *DiskFormat
+	Filename string
+	data     []uint8
+	offsets  []int
+}
+
+func newDiskImage(format *DiskFormat, data []uint8) *DiskImage {
+	d := &DiskImage{Format: format, data: data}
+	d.offsets = make([]int, format.Tracks+1)
+	offset := 0
+	for t := 1; t <= format.Tracks; t++ {
+		d.offsets[t] = offset
+		offset += format.sectors(t) * sectorLen
+	}
+	return d
+}
+
+// NewDiskImage creates a blank, formatted disk.
+func NewDiskImage(format *DiskFormat, name string, id string) *DiskImage {
+	d := newDiskImage(format, make([]uint8, format.size()))
+	for t := 1; t <= format.Tracks; t++ {
+		count, bitmap := format.bam(d, t)
+		n := format.sectors(t)
+		d.data[count] = uint8(n)
+		for s := 0; s < n; s++ {
+			d.data[bitmap+s/8] |= 1 << uint(s%8)
+		}
+	}
+	format.format(d)
+	for s := 0; s <= format.dirSector; s++ {
+		d.allocate(format.dirTrack, s)
+	}
+	dir := d.data[d.offset(format.dirTrack, format.dirSector):]
+	dir[1] = 0xff
+
+	header := d.data[d.offset(format.dirTrack, 0):]
+	pad(header[format.nameOffset:format.nameOffset+16], []uint8(name))
+	pad(header[format.nameOffset+0x12:format.nameOffset+0x14], []uint8(id))
+	return d
+}
+
+// LoadDiskImage reads a D64, D71 or D81 file. The format is determined by
+// the size of the file. Images that include error information are
+// accepted and the error information is kept as-is.
+func LoadDiskImage(filename string) (*DiskImage, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, format := range diskFormats {
+		size := format.size()
+		if len(data) == size || len(data) == size+size/sectorLen {
+			d := newDiskImage(format, data)
+			d.Filename = filename
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown disk image format: %v", filename)
+}
+
+// Save writes the image back to its file.
+func (d *DiskImage) Save() error {
+	if d.Filename == "" {
+		return nil
+	}
+	return ioutil.WriteFile(d.Filename, d.data, 0644)
+}
+
+func (d *DiskImage) offset(track int, sector int) int {
+	return d.offsets[track] + sector*sectorLen
+}
+
+func (d *DiskImage) sector(track int, sector int) ([]uint8, error) {
+	if track < 1 || track > d.Format.Tracks || sector < 0 || sector >= d.Format.sectors(track) {
+		return nil, fmt.Errorf("illegal track or sector: %v/%v", track, sector)
+	}
+	offset := d.offset(track, sector)
+	return d.data[offset : offset+sectorLen], nil
+}
+
+func (d *DiskImage) header() []uint8 {
+	offset := d.offset(d.Format.dirTrack, 0)
+	return d.data[offset : offset+sectorLen]
+}
+
+// Name is the disk name in PETSCII.
+func (d *DiskImage) Name() string {
+	offset := d.Format.nameOffset
+	return unpad(d.header()[offset : offset+16])
+}
+
+// ID is the disk ID in PETSCII.
+func (d *DiskImage) ID() string {
+	offset := d.Format.nameOffset + 0x12
+	return string(d.header()[offset : offset+2])
+}
+
+func (d *DiskImage) isFree(track int, sector int) bool {
+	_, bitmap := d.Format.bam(d, track)
+	return d.data[bitmap+sector/8]&(1<<uint(sector%8)) != 0
+}
+
+func (d *DiskImage) allocate(track int, sector int) {
+	if !d.isFree(track, sector) {
+		return
+	}
+	count, bitmap := d.Format.bam(d, track)
+	d.data[bitmap+sector/8] &^= 1 << uint(sector%8)
+	d.data[count]--
+}
+
+func (d *DiskImage) free(track int, sector int) {
+	if d.isFree(track, sector) {
+		return
+	}
+	count, bitmap := d.Format.bam(d, track)
+	d.data[bitmap+sector/8] |= 1 << uint(sector%8)
+	d.data[count]++
+}
+
+func (d *DiskImage) usable(track int) bool {
+	return track != d.Format.dirTrack && track != d.Format.reservedTrack
+}
+
+// BlocksFree is the number of sectors available for files.
+func (d *DiskImage) BlocksFree() int {
+	free := 0
+	for t := 1; t <= d.Format.Tracks; t++ {
+		if d.usable(t) {
+			count, _ := d.Format.bam(d, t)
+			free += int(d.data[count])
+		}
+	}
+	return free
+}
+
+// trackOrder lists the tracks in the order they are used for new files,
+// starting closest to the directory and moving outward.
+func (d *DiskImage) trackOrder() []int {
+	var order []int
+	dir := d.Format.dirTrack
+	for i := 1; i < d.Format.Tracks; i++ {
+		for _, t := range []int{dir - i, dir + i} {
+			if t >= 1 && t <= d.Format.Tracks && d.usable(t) {
+				order = append(order, t)
+			}
+		}
+	}
+	return order
+}
+
+// nextFree finds the next free sector after the one given, trying the same
+// track first with the interleave used by the drive. A track of zero
+// starts a new file.
+func (d *DiskImage) nextFree(track int, sector int) (int, int, error) {
+	order := d.trackOrder()
+	start := 0
+	for i, t := range order {
+		if t == track {
+			start = i
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		t := order[(start+i)%len(order)]
+		n := d.Format.sectors(t)
+		first := 0
+		if t == track {
+			first = (sector + d.Format.interleave) % n
+		}
+		for j := 0; j < n; j++ {
+			s := (first + j) % n
+			if d.isFree(t, s) {
+				return t, s, nil
+			}
+		}
+	}
+	return 0, 0, ErrDiskFull
+}
+
+// DirEntry is a file listed in the directory.
+type DirEntry struct {
+	Name   string // in PETSCII
+	Type   FileType
+	Closed bool
+	Locked bool
+	Track  int
+	Sector int
+	Blocks int
+	entry  []uint8
+}
+
+func (d *DiskImage) eachEntry(fn func(entry []uint8) bool) error {
+	track, sector := d.Format.dirTrack, d.Format.dirSector
+	for seen := 0; track != 0; seen++ {
+		if seen > d.Format.sectors(d.Format.dirTrack) {
+			return errors.New("directory loop")
+		}
+		data, err := d.sector(track, sector)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < sectorLen; i += dirEntryLen {
+			if !fn(data[i : i+dirEntryLen]) {
+				return nil
+			}
+		}
+		track, sector = int(data[0]), int(data[1])
+	}
+	return nil
+}
+
+func newDirEntry(entry []uint8) DirEntry {
+	return DirEntry{
+		Name:   unpad(entry[5:21]),
+		Type:   FileType(entry[2] & 0x07),
+		Closed: entry[2]&fileClosed != 0,
+		Locked: entry[2]&fileLocked != 0,
+		Track:  int(entry[3]),
+		Sector: int(entry[4]),
+		Blocks: int(entry[30]) | int(entry[31])<<8,
+		entry:  entry,
+	}
+}
+
+// Directory lists the files on the disk.
+func (d *DiskImage) Directory() ([]DirEntry, error) {
+	var entries []DirEntry
+	err := d.eachEntry(func(entry []uint8) bool {
+		if entry[2] != 0 {
+			entries = append(entries, newDirEntry(entry))
+		}
+		return true
+	})
+	return entries, err
+}
+
+// Find returns the first file that matches the pattern.
+func (d *DiskImage) Find(pattern string) (DirEntry, error) {
+	entries, err := d.Directory()
+	if err != nil {
+		return DirEntry{}, err
+	}
+	for _, e := range entries {
+		if e.Type != FileDEL && matchName(pattern, e.Name) {
+			return e, nil
+		}
+	}
+	return DirEntry{}, ErrFileNotFound
+}
+
+// ReadFile returns the contents of the first file matching the pattern.
+func (d *DiskImage) ReadFile(pattern string) ([]uint8, error) {
+	e, err := d.Find(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var data []uint8
+	track, sector := e.Track, e.Sector
+	for seen := 0; track != 0; seen++ {
+		if seen > len(d.data)/sectorLen {
+			return nil, errors.New("file loop")
+		}
+		block, err := d.sector(track, sector)
+		if err != nil {
+			return nil, err
+		}
+		track, sector = int(block[0]), int(block[1])
+		if track == 0 {
+			// Sector is the index of the last byte used
+			if sector < 1 {
+				return nil, errors.New("invalid block")
+			}
+			data = append(data, block[2:sector+1]...)
+		} else {
+			data = append(data, block[2:]...)
+		}
+	}
+	return data, nil
+}
+
+// WriteFile creates a new file with the data. Blocks are allocated in the
+// BAM and the image is saved.
+func (d *DiskImage) WriteFile(name string, fileType FileType, data []uint8) error {
+	if _, err := d.Find(name); err == nil {
+		return ErrFileExists
+	}
+	blocks := (len(data) + sectorLen - 3) / (sectorLen - 2)
+	if blocks == 0 {
+		blocks = 1
+	}
+	if blocks > d.BlocksFree() {
+		return ErrDiskFull
+	}
+	entry, err := d.newEntry()
+	if err != nil {
+		return err
+	}
+	var chain [][2]int
+	track, sector := 0, 0
+	for i := 0; i < blocks; i++ {
+		if track, sector, err = d.nextFree(track, sector); err != nil {
+			return err
+		}
+		d.allocate(track, sector)
+		chain = append(chain, [2]int{track, sector})
+	}
+	for i, ts := range chain {
+		block, _ := d.sector(ts[0], ts[1])
+		start := i * (sectorLen - 2)
+		n := copy(block[2:], data[start:])
+		if i < len(chain)-1 {
+			block[0] = uint8(chain[i+1][0])
+			block[1] = uint8(chain[i+1][1])
+		} else {
+			block[0] = 0
+			block[1] = uint8(n + 1)
+		}
+	}
+	for i := 2; i < dirEntryLen; i++ {
+		entry[i] = 0
+	}
+	entry[2] = fileClosed | uint8(fileType)
+	entry[3] = uint8(chain[0][0])
+	entry[4] = uint8(chain[0][1])
+	pad(entry[5:21], []uint8(name))
+	entry[30] = uint8(blocks)
+	entry[31] = uint8(blocks >> 8)
+	return d.Save()
+}
+
+// newEntry finds an unused directory entry, adding a sector to the
+// directory if needed.
+func (d *DiskImage) newEntry() ([]uint8, error) {
+	var found []uint8
+	err := d.eachEntry(func(entry []uint8) bool {
+		if entry[2] == 0 {
+			found = entry
+			return false
+		}
+		return true
+	})
+	if err != nil || found != nil {
+		return found, err
+	}
+	// Find the last sector in the directory and link a new one
+	track, sector := d.Format.dirTrack, d.Format.dirSector
+	last, _ := d.sector(track, sector)
+	for last[0] != 0 {
+		track, sector = int(last[0]), int(last[1])
+		last, _ = d.sector(track, sector)
+	}
+	n := d.Format.sectors(track)
+	for i := 1; i < n; i++ {
+		s := (sector + i*d.Format.dirInterleave) % n
+		if d.isFree(track, s) {
+			d.allocate(track, s)
+			last[0] = uint8(track)
+			last[1] = uint8(s)
+			block, _ := d.sector(track, s)
+			for j := range block {
+				block[j] = 0
+			}
+			block[1] = 0xff
+			return block[0:dirEntryLen], nil
+		}
+	}
+	return nil, ErrDirFull
+}
+
+// Scratch deletes the first file that matches the pattern and frees its
+// blocks.
+func (d *DiskImage) Scratch(pattern string) error {
+	e, err := d.Find(pattern)
+	if err != nil {
+		return err
+	}
+	track, sector := e.Track, e.Sector
+	for seen := 0; track != 0 && seen <= len(d.data)/sectorLen; seen++ {
+		block, err := d.sector(track, sector)
+		if err != nil {
+			break
+		}
+		d.free(track, sector)
+		track, sector = int(block[0]), int(block[1])
+	}
+	e.entry[2] = 0
+	return d.Save()
+}
+
+// Listing returns the directory as a BASIC program like the one the drive
+// sends when loading "$". The load address is included.
+func (d *DiskImage) Listing(pattern string) ([]uint8, error) {
+	entries, err := d.Directory()
+	if err != nil {
+		return nil, err
+	}
+	return listing(d.Name(), d.ID()+" "+d.Format.DOSType, entries, pattern, d.BlocksFree()), nil
+}
+
+// listing creates the BASIC program for a directory. The header is the
+// disk name followed by the ID and DOS type.
+func listing(name string, id string, entries []DirEntry, pattern string, free int) []uint8 {
+	var lines [][]uint8
+	var header bytes.Buffer
+	header.WriteByte(0x12) // rvs on
+	header.WriteByte('"')
+	header.Write(padded(name, 16, ' '))
+	header.WriteByte('"')
+	header.WriteByte(' ')
+	header.WriteString(id)
+	lines = append(lines, basicLine(0, header.Bytes()))
+
+	for _, e := range entries {
+		if pattern != "" && !matchName(pattern, e.Name) {
+			continue
+		}
+		var line bytes.Buffer
+		for n := 10; n <= 1000; n *= 10 {
+			if e.Blocks < n {
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteByte('"')
+		line.WriteString(e.Name)
+		line.WriteByte('"')
+		line.Write(padded("", 16-len(e.Name), ' '))
+		if e.Closed {
+			line.WriteByte(' ')
+		} else {
+			line.WriteByte('*')
+		}
+		line.WriteString(e.Type.String())
+		if e.Locked {
+			line.WriteByte('<')
+		}
+		lines = append(lines, basicLine(e.Blocks, line.Bytes()))
+	}
+	lines = append(lines, basicLine(free, []uint8("BLOCKS FREE.")))
+
+	start := uint16(0x0401)
+	out := []uint8{uint8(start), uint8(start >> 8)}
+	addr := start
+	for _, line := range lines {
+		addr += uint16(len(line))
+		line[0] = uint8(addr)
+		line[1] = uint8(addr >> 8)
+		out = append(out, line...)
+	}
+	return append(out, 0, 0)
+}
+
+// basicLine returns a tokenized line of BASIC with room for the link to
+// the next line.
+func basicLine(number int, text []uint8) []uint8 {
+	line := []uint8{0, 0, uint8(number), uint8(number >> 8)}
+	line = append(line, text...)
+	return append(line, 0)
+}
+
+// matchName compares a filename to a pattern where "?" matches any
+// character and "*" matches the rest of the name.
+func matchName(pattern string, name string) bool {
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '*' {
+			return true
+		}
+		if i >= len(name) || (pattern[i] != '?' && pattern[i] != name[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(name)
+}
+
+func pad(dest []uint8, src []uint8) {
+	n := copy(dest, src)
+	for i := n; i < len(dest); i++ {
+		dest[i] = padChar
+	}
+}
+
+func unpad(data []uint8) string {
+	if i := bytes.IndexByte(data, padChar); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+func padded(str string, n int, ch uint8) []uint8 {
+	out := []uint8(str)
+	for len(out) < n {
+		out = append(out, ch)
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package mach85
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiskBlocksFree(t *testing.T) {
+	var tests = []struct {
+		format *DiskFormat
+		want   int
+	}{
+		{FormatD64, 664},
+		{FormatD71, 1328},
+		{FormatD81, 3160},
+	}
+	for _, test := range tests {
+		t.Run(test.format.Name, func(t *testing.T) {
+			d := NewDiskImage(test.format, "TEST", "01")
+			have := d.BlocksFree()
+			if test.want != have {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+			if d.Name() != "TEST" || d.ID() != "01" {
+				t.Errorf("\n want: TEST 01 \n have: %v %v \n", d.Name(), d.ID())
+			}
+		})
+	}
+}
+
+func TestDiskWriteRead(t *testing.T) {
+	for _, format := range diskFormats {
+		t.Run(format.Name, func(t *testing.T) {
+			d := NewDiskImage(format, "TEST", "01")
+			data := make([]uint8, 1000)
+			for i := range data {
+				data[i] = uint8(i)
+			}
+			if err := d.WriteFile("DATA", FilePRG, data); err != nil {
+				t.Fatal(err)
+			}
+			have, err := d.ReadFile("DATA")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, have) {
+				t.Errorf("data does not match")
+			}
+			wantFree := d.Format.size()/sectorLen - d.Format.sectors(d.Format.dirTrack) - 4
+			if d.Format.reservedTrack != 0 {
+				wantFree -= d.Format.sectors(d.Format.reservedTrack)
+			}
+			if d.BlocksFree() != wantFree {
+				t.Errorf("\n want: %v \n have: %v \n", wantFree, d.BlocksFree())
+			}
+		})
+	}
+}
+
+func TestDiskWriteEmpty(t *testing.T) {
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	if err := d.WriteFile("EMPTY", FileSEQ, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := d.ReadFile("EMPTY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("\n want: 0 \n have: %v \n", len(data))
+	}
+}
+
+func TestDiskReadInvalidBlock(t *testing.T) {
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	d.WriteFile("DATA", FilePRG, []uint8{1, 2, 3})
+	e, _ := d.Find("DATA")
+	block, err := d.sector(e.Track, e.Sector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block[1] = 0 // index of the last byte used
+	_, err = d.ReadFile("DATA")
+	if err == nil || err.Error() != "invalid block" {
+		t.Errorf("\n want: %v \n have: %v \n", "invalid block", err)
+	}
+}
+
+func TestDiskFileExists(t *testing.T) {
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	d.WriteFile("DATA", FilePRG, []uint8{1})
+	err := d.WriteFile("DATA", FilePRG, []uint8{2})
+	if err != ErrFileExists {
+		t.Errorf("\n want: %v \n have: %v \n", ErrFileExists, err)
+	}
+}
+
+func TestDiskScratch(t *testing.T) {
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	d.WriteFile("DATA", FilePRG, make([]uint8, 3000))
+	if err := d.Scratch("DA*"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadFile("DATA"); err != ErrFileNotFound {
+		t.Errorf("\n want: %v \n have: %v \n", ErrFileNotFound, err)
+	}
+	if d.BlocksFree() != 664 {
+		t.Errorf("\n want: %v \n have: %v \n", 664, d.BlocksFree())
+	}
+}
+
+func TestDiskDirectoryGrows(t *testing.T) {
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	for i := 0; i < 20; i++ {
+		name := string([]uint8{'F', 'A' + uint8(i)})
+		if err := d.WriteFile(name, FilePRG, []uint8{uint8(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := d.Directory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 20 {
+		t.Errorf("\n want: %v \n have: %v \n", 20, len(entries))
+	}
+	data, err := d.ReadFile("FT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []uint8{19}) {
+		t.Errorf("\n want: %v \n have: %v \n", []uint8{19}, data)
+	}
+}
+
+func TestDiskMatchName(t *testing.T) {
+	var tests = []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"HELLO", "HELLO", true},
+		{"HELLO", "HELLO2", false},
+		{"HELLO2", "HELLO", false},
+		{"HE*", "HELLO", true},
+		{"*", "HELLO", true},
+		{"H?LLO", "HELLO", true},
+		{"H?LLO", "HALLO", true},
+		{"H?LLO", "HELL", false},
+	}
+	for _, test := range tests {
+		have := matchName(test.pattern, test.name)
+		if test.want != have {
+			t.Errorf("%v %v \n want: %v \n have: %v \n", test.pattern, test.name, test.want, have)
+		}
+	}
+}
+
+func TestDiskListing(t *testing.T) {
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	d.WriteFile("HELLO", FilePRG, make([]uint8, 300))
+	have, err := d.Listing("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{0x01, 0x04}
+	want = append(want, 0x1f, 0x04, 0x00, 0x00, 0x12)
+	want = append(want, []uint8("\"TEST            \" 01 2A")...)
+	want = append(want, 0x00)
+	want = append(want, 0x3d, 0x04, 0x02, 0x00)
+	want = append(want, []uint8("   \"HELLO\"            PRG")...)
+	want = append(want, 0x00)
+	want = append(want, 0x4e, 0x04, 0x96, 0x02)
+	want = append(want, []uint8("BLOCKS FREE.")...)
+	want = append(want, 0x00, 0x00, 0x00)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %q \n have: %q \n", want, have)
+	}
+}
+
+func TestDiskLoadSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.d64")
+
+	d := NewDiskImage(FormatD64, "TEST", "01")
+	d.Filename = filename
+	if err := d.WriteFile("DATA", FilePRG, []uint8{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	d, err = LoadDiskImage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Format != FormatD64 {
+		t.Errorf("\n want: %v \n have: %v \n", FormatD64.Name, d.Format.Name)
+	}
+	data, err := d.ReadFile("DATA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []uint8{1, 2, 3}) {
+		t.Errorf("\n want: %v \n have: %v \n", []uint8{1, 2, 3}, data)
+	}
+}
+
+func TestDiskLoadUnknownFormat(t *testing.T) {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(make([]uint8, 1000))
+	file.Close()
+	defer os.Remove(file.Name())
+	if _, err := LoadDiskImage(file.Name()); err == nil {
+		t.Errorf("expected error")
+	}
+}
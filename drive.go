@@ -0,0 +1,303 @@
+package mach85
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Drive is a device on the serial bus that files can be loaded from and
+// saved to. Filenames are in PETSCII and files are read and written in
+// whole. Programs begin with the two byte load address.
+type Drive interface {
+	Load(name string) ([]uint8, error)
+	Save(name string, data []uint8) error
+	Scratch(pattern string) error
+}
+
+const (
+	minDriveDevice = 8
+	maxDriveDevice = 30
+)
+
+// KERNAL error codes returned in the accumulator with the carry set
+const (
+	kernalErrFileNotFound     = 4
+	kernalErrDeviceNotPresent = 5
+	kernalErrMissingFilename  = 8
+)
+
+// fileSpec is a filename as given to the drive, such as "@0:NAME,S"
+type fileSpec struct {
+	name     string
+	fileType FileType
+	replace  bool
+}
+
+func parseFileSpec(str string) fileSpec {
+	spec := fileSpec{fileType: FilePRG}
+	if strings.HasPrefix(str, "@") {
+		spec.replace = true
+		str = str[1:]
+	}
+	// Drive number
+	if i := strings.IndexByte(str, ':'); i >= 0 {
+		str = str[i+1:]
+	}
+	options := strings.Split(str, ",")
+	spec.name = options[0]
+	for _, opt := range options[1:] {
+		switch opt {
+		case "S":
+			spec.fileType = FileSEQ
+		case "P":
+			spec.fileType = FilePRG
+		case "U":
+			spec.fileType = FileUSR
+		}
+	}
+	return spec
+}
+
+// DiskDrive is a drive with a disk image inserted. Loading "$" returns
+// the directory.
+type DiskDrive struct {
+	Image *DiskImage
+}
+
+func NewDiskDrive(image *DiskImage) *DiskDrive {
+	return &DiskDrive{Image: image}
+}
+
+func (d *DiskDrive) Load(name string) ([]uint8, error) {
+	if strings.HasPrefix(name, "$") {
+		pattern := ""
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			pattern = name[i+1:]
+		}
+		return d.Image.Listing(pattern)
+	}
+	return d.Image.ReadFile(parseFileSpec(name).name)
+}
+
+func (d *DiskDrive) Save(name string, data []uint8) error {
+	spec := parseFileSpec(name)
+	if spec.replace {
+		if err := d.Image.Scratch(spec.name); err != nil && err != ErrFileNotFound {
+			return err
+		}
+	}
+	return d.Image.WriteFile(spec.name, spec.fileType, data)
+}
+
+func (d *DiskDrive) Scratch(pattern string) error {
+	return d.Image.Scratch(pattern)
+}
+
+func (d *DiskDrive) String() string {
+	return d.Image.Filename
+}
+
+func checkDevice(device int) error {
+	if device < minDriveDevice || device > maxDriveDevice {
+		return fmt.Errorf("invalid device: %v", device)
+	}
+	return nil
+}
+
+// Attach connects the drive to the serial bus as the device number given.
+// The KERNAL LOAD and SAVE routines, and the serial bus routines, are
+// replaced for the device.
+func (m *Mach85) Attach(device int, drive Drive) error {
+	if err := checkDevice(device); err != nil {
+		return err
+	}
+	m.detach(device)
+	m.drives[device] = drive
+	return nil
+}
+
+// AttachDisk inserts a D64, D71 or D81 disk image into a drive. If the
+// filename is a directory, files are loaded and saved there instead. D64
+// images are inserted into an emulated 1541 when EmulateDrives is set.
+func (m *Mach85) AttachDisk(device int, filename string) error {
+	if err := checkDevice(device); err != nil {
+		return err
+	}
+	if _, err := m.mem64(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		return m.Attach(device, NewHostDrive(filename))
+	}
+	image, err := LoadDiskImage(filename)
+	if err != nil {
+		return err
+	}
+	if m.EmulateDrives && image.Format == FormatD64 {
+		return m.attachTrueDrive(device, image)
+	}
+	return m.Attach(device, NewDiskDrive(image))
+}
+
+func (m *Mach85) Detach(device int) error {
+	if !m.detach(device) {
+		return fmt.Errorf("no drive attached: %v", device)
+	}
+	return nil
+}
+
+// detach removes any drive attached as the device and returns false if
+// there was none. Emulated drives save changes to the disk first.
+func (m *Mach85) detach(device int) bool {
+	if d, ok := m.trueDrives[device]; ok {
+		d.Flush()
+		m.iec.remove(d)
+		m.RemoveDevice(d)
+		delete(m.trueDrives, device)
+		return true
+	}
+	if _, ok := m.drives[device]; !ok {
+		return false
+	}
+	delete(m.drives, device)
+	for key := range m.bus.channels {
+		if key.device == device {
+			delete(m.bus.channels, key)
+		}
+	}
+	return true
+}
+
+// Drive returns the drive attached as the device or nil if there is none.
+func (m *Mach85) Drive(device int) Drive {
+	return m.drives[device]
+}
+
+// trap runs the replacement for the KERNAL routine at the program counter,
+// if there is one, and returns true if the routine was replaced. Traps are
+// only taken when the KERNAL ROM is banked in.
+func (m *Mach85) trap() bool {
+	address := m.cpu.PC + 1
+	fn, ok := m.traps[address]
+	if !ok {
+		return false
+	}
+	mem64, ok := m.Memory.Base.(*Memory64)
+	if !ok || mem64.Mapped(address) != KernalROM {
+		return false
+	}
+	return fn()
+}
+
+// kernalReturn returns from a replaced KERNAL routine. A non-zero error
+// code is placed in the accumulator with the carry set.
+func (m *Mach85) kernalReturn(code uint8) {
+	m.cpu.C = code != 0
+	if code != 0 {
+		m.cpu.A = code
+	}
+	m.cpu.PC = m.cpu.pull16()
+}
+
+func (m *Mach85) filename() string {
+	n := m.Memory.Load(AddrFilenameLen)
+	ptr := m.Memory.Load16(AddrFilename)
+	name := make([]uint8, n)
+	for i := range name {
+		name[i] = m.Memory.Load(ptr + uint16(i))
+	}
+	return string(name)
+}
+
+// kernalError converts a drive error to the closest KERNAL error code.
+func kernalError(err error) uint8 {
+	if err == ErrFileNotFound {
+		return kernalErrFileNotFound
+	}
+	return kernalErrDeviceNotPresent
+}
+
+// trapLoad replaces the KERNAL LOAD routine after it has been called
+// through the vector at $0330. The accumulator is zero for a load and one
+// for a verify.
+func (m *Mach85) trapLoad() bool {
+	device := int(m.Memory.Load(AddrDeviceNumber))
+	if device == tapeDevice {
+		return m.trapTapeLoad()
+	}
+	drive, ok := m.drives[device]
+	if !ok {
+		return false
+	}
+	verify := m.cpu.A != 0
+	m.Memory.Store(AddrVerifyFlag, m.cpu.A)
+	m.Memory.Store(AddrStatus, 0)
+	name := m.filename()
+	if name == "" {
+		m.kernalReturn(kernalErrMissingFilename)
+		return true
+	}
+	data, err := drive.Load(name)
+	if err != nil {
+		m.kernalReturn(kernalError(err))
+		return true
+	}
+	m.loadData(data, verify)
+	return true
+}
+
+// loadData stores the program in memory, or compares it when verifying,
+// and returns from LOAD with the end address.
+func (m *Mach85) loadData(data []uint8, verify bool) {
+	if len(data) < 2 {
+		m.kernalReturn(kernalErrFileNotFound)
+		return
+	}
+	address := uint16(data[0]) | uint16(data[1])<<8
+	if m.Memory.Load(AddrSecondaryAddress) == 0 {
+		address = m.Memory.Load16(AddrLoadAddress)
+	}
+	if !verify {
+		m.Memory.Import(address, data[2:])
+	} else {
+		for i, value := range data[2:] {
+			if m.Memory.Load(address+uint16(i)) != value {
+				m.setStatus(statusVerify)
+			}
+		}
+	}
+	end := address + uint16(len(data)-2)
+	m.Memory.Store16(AddrEndAddress, end)
+	m.cpu.X = uint8(end)
+	m.cpu.Y = uint8(end >> 8)
+	m.kernalReturn(0)
+}
+
+// trapSave replaces the KERNAL SAVE routine after it has been called
+// through the vector at $0332. The start address has been copied to $c1
+// and the end address, exclusive, to $ae.
+func (m *Mach85) trapSave() bool {
+	drive, ok := m.drives[int(m.Memory.Load(AddrDeviceNumber))]
+	if !ok {
+		return false
+	}
+	m.Memory.Store(AddrStatus, 0)
+	name := m.filename()
+	if name == "" {
+		m.kernalReturn(kernalErrMissingFilename)
+		return true
+	}
+	start := m.Memory.Load16(AddrStartAddress)
+	end := m.Memory.Load16(AddrEndAddress)
+	data := []uint8{uint8(start), uint8(start >> 8)}
+	for a := start; a != end; a++ {
+		data = append(data, m.Memory.Load(a))
+	}
+	if err := drive.Save(name, data); err != nil {
+		m.kernalReturn(kernalError(err))
+		return true
+	}
+	m.kernalReturn(0)
+	return true
+}
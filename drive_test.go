@@ -0,0 +1,145 @@
+package mach85
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestDriveMach(t *testing.T) (*Mach85, *DiskImage) {
+	mach := New()
+	mach.StopOnBreak = true
+	mach.QuitOnStop = true
+	disk := NewDiskImage(FormatD64, "TEST", "01")
+	if err := mach.Attach(8, NewDiskDrive(disk)); err != nil {
+		t.Fatal(err)
+	}
+	return mach, disk
+}
+
+// testKernalCall sets up the zero page as SETLFS and SETNAM would, then
+// calls the routine for device 8.
+func testKernalCall(mach *Mach85, routine uint16, name string, sa uint8, a uint8) {
+	testKernalCallDevice(mach, 8, routine, name, sa, a)
+}
+
+func testKernalCallDevice(mach *Mach85, device uint8, routine uint16, name string, sa uint8, a uint8) {
+	mach.Memory.Import(0x0900, []uint8(name))
+	mach.Memory.Store(AddrFilenameLen, uint8(len(name)))
+	mach.Memory.Store16(AddrFilename, 0x0900)
+	mach.Memory.Store(AddrDeviceNumber, device)
+	mach.Memory.Store(AddrSecondaryAddress, sa)
+	mach.Memory.StoreN(0x0800,
+		0xa9, a, // lda #a
+		0x20, uint8(routine), uint8(routine>>8), // jsr routine
+		0x00, // brk
+	)
+	mach.cpu.PC = 0x0800 - 1
+	mach.Start()
+	mach.Run()
+}
+
+func TestDriveLoad(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	disk.WriteFile("HELLO", FilePRG, []uint8{0x00, 0xc0, 1, 2, 3})
+	testKernalCall(mach, AddrKernalLoad, "HELLO", 1, 0)
+	if mach.cpu.C {
+		t.Fatalf("unexpected error: %v", mach.cpu.A)
+	}
+	have := []uint8{mach.Memory.Load(0xc000), mach.Memory.Load(0xc001), mach.Memory.Load(0xc002)}
+	if !bytes.Equal([]uint8{1, 2, 3}, have) {
+		t.Errorf("\n want: %v \n have: %v \n", []uint8{1, 2, 3}, have)
+	}
+	end := uint16(mach.cpu.X) | uint16(mach.cpu.Y)<<8
+	if end != 0xc003 {
+		t.Errorf("\n want: $c003 \n have: $%04x \n", end)
+	}
+}
+
+func TestDriveLoadRelocated(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	disk.WriteFile("HELLO", FilePRG, []uint8{0x00, 0xc0, 1, 2, 3})
+	mach.Memory.Store16(AddrLoadAddress, 0x2000)
+	testKernalCall(mach, AddrKernalLoad, "HE*", 0, 0)
+	if mach.Memory.Load(0x2002) != 3 {
+		t.Errorf("\n want: %v \n have: %v \n", 3, mach.Memory.Load(0x2002))
+	}
+}
+
+func TestDriveLoadDirectory(t *testing.T) {
+	mach, _ := newTestDriveMach(t)
+	mach.Memory.Store16(AddrLoadAddress, 0x0801)
+	testKernalCall(mach, AddrKernalLoad, "$", 0, 0)
+	// Disk name after the line link, line number, rvs on and quote
+	have := mach.Memory.Load(0x0801 + 6)
+	if have != 'T' {
+		t.Errorf("\n want: %02x \n have: %02x \n", 'T', have)
+	}
+}
+
+func TestDriveLoadNotFound(t *testing.T) {
+	mach, _ := newTestDriveMach(t)
+	testKernalCall(mach, AddrKernalLoad, "NOPE", 1, 0)
+	if !mach.cpu.C || mach.cpu.A != kernalErrFileNotFound {
+		t.Errorf("\n want: %v \n have: %v \n", kernalErrFileNotFound, mach.cpu.A)
+	}
+}
+
+func TestDriveVerify(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	disk.WriteFile("HELLO", FilePRG, []uint8{0x00, 0xc0, 1, 2, 3})
+	mach.Memory.StoreN(0xc000, 1, 2, 4)
+	testKernalCall(mach, AddrKernalLoad, "HELLO", 1, 1)
+	if mach.Memory.Load(AddrStatus) != 0x10 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x10, mach.Memory.Load(AddrStatus))
+	}
+	if mach.Memory.Load(0xc002) != 4 {
+		t.Errorf("verify changed memory")
+	}
+}
+
+func TestDriveSave(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	mach.Memory.StoreN(0xc000, 1, 2, 3)
+	mach.Memory.Store16(AddrStartAddress, 0xc000)
+	mach.Memory.Store16(AddrEndAddress, 0xc003)
+	testKernalCall(mach, AddrKernalSave, "0:SAVED,S", 0, 0)
+	if mach.cpu.C {
+		t.Fatalf("unexpected error: %v", mach.cpu.A)
+	}
+	e, err := disk.Find("SAVED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != FileSEQ {
+		t.Errorf("\n want: %v \n have: %v \n", FileSEQ, e.Type)
+	}
+	data, _ := disk.ReadFile("SAVED")
+	want := []uint8{0x00, 0xc0, 1, 2, 3}
+	if !bytes.Equal(want, data) {
+		t.Errorf("\n want: %v \n have: %v \n", want, data)
+	}
+}
+
+func TestDriveSaveReplace(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	disk.WriteFile("SAVED", FilePRG, []uint8{0x00, 0xc0, 9})
+	mach.Memory.StoreN(0xc000, 1)
+	mach.Memory.Store16(AddrStartAddress, 0xc000)
+	mach.Memory.Store16(AddrEndAddress, 0xc001)
+	testKernalCall(mach, AddrKernalSave, "@0:SAVED", 0, 0)
+	data, _ := disk.ReadFile("SAVED")
+	want := []uint8{0x00, 0xc0, 1}
+	if !bytes.Equal(want, data) {
+		t.Errorf("\n want: %v \n have: %v \n", want, data)
+	}
+}
+
+func TestDriveNotAttached(t *testing.T) {
+	mach, _ := newTestDriveMach(t)
+	mach.Detach(8)
+	// Without a KERNAL the routine runs into a break instead
+	testKernalCall(mach, AddrKernalLoad, "HELLO", 1, 0)
+	if mach.cpu.PC>>8 != 0xf4 {
+		t.Errorf("trap taken without a drive")
+	}
+}
@@ -53,3 +53,34 @@ func decoder(code uint8, decode Decoder) (rune, bool) {
 	}
 	return decode(code)
 }
+
+type Encoder func(rune) (uint8, bool)
+
+var petsciiUnshiftedCodes = encoderTable(petsciiUnshifted[:])
+
+// PetsciiUnshiftedEncoder converts host characters to the PETSCII codes
+// produced by the keyboard in the unshifted (uppercase/graphics) mode. Host
+// lowercase letters are mapped to uppercase.
+var PetsciiUnshiftedEncoder = func(ch rune) (uint8, bool) {
+	switch {
+	case ch >= 'a' && ch <= 'z':
+		ch = ch - 'a' + 'A'
+	case ch == '\n':
+		ch = '\r'
+	}
+	code, ok := petsciiUnshiftedCodes[ch]
+	return code, ok
+}
+
+func encoderTable(table []rune) map[rune]uint8 {
+	codes := make(map[rune]uint8)
+	for code, ch := range table {
+		if ch == replacementChar {
+			continue
+		}
+		if _, exists := codes[ch]; !exists {
+			codes[ch] = uint8(code)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,294 @@
+package mach85
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Binary operators from the lowest to the highest precedence. Two
+// character operators are listed first so that they are matched before
+// the single character ones.
+var exprOps = []struct {
+	op   string
+	prec int
+}{
+	{"||", 1}, {"&&", 2},
+	{"==", 3}, {"!=", 3}, {"<=", 3}, {">=", 3},
+	{"<<", 7}, {">>", 7},
+	{"<", 3}, {">", 3},
+	{"|", 4}, {"^", 5}, {"&", 6},
+	{"+", 8}, {"-", 8},
+	{"*", 9}, {"/", 9}, {"%", 9},
+}
+
+// Expr evaluates expressions given as arguments in the monitor. Numbers
+// are hex as everywhere else in the monitor unless prefixed with + for
+// decimal or % for binary. A name that is also valid hex, such as a or
+// fa, is read as hex so that arguments mean what they did before names
+// were allowed. Other names are looked up as registers first and then as
+// symbols. A dot in front, as in .a or .fa, skips the hex. A value in
+// square brackets is the word stored at that address, and < and > in
+// front of a value are its low and high bytes.
+type Expr struct {
+	cpu    *CPU
+	mem    *Memory
+	lookup func(string) (uint16, bool)
+	src    string
+	pos    int
+	strict bool // refuse hex that is also the name of a register
+}
+
+func NewExpr(cpu *CPU, mem *Memory, lookup func(string) (uint16, bool)) *Expr {
+	return &Expr{cpu: cpu, mem: mem, lookup: lookup}
+}
+
+// Eval returns the value of an expression. It can be called from more
+// than one goroutine.
+func (e *Expr) Eval(src string) (int, error) {
+	p := &Expr{cpu: e.cpu, mem: e.mem, lookup: e.lookup, src: src}
+	return p.eval()
+}
+
+// Check evaluates a condition to see that it is valid. Hex that is also
+// the name of a register, such as a in a==10, is refused as the register
+// is almost certainly what was meant.
+func (e *Expr) Check(src string) error {
+	p := &Expr{cpu: e.cpu, mem: e.mem, lookup: e.lookup, src: src, strict: true}
+	_, err := p.eval()
+	return err
+}
+
+func (e *Expr) eval() (int, error) {
+	value, err := e.parse(1)
+	if err != nil {
+		return 0, err
+	}
+	e.skipSpace()
+	if e.pos < len(e.src) {
+		return 0, fmt.Errorf("invalid expression: %v", e.src)
+	}
+	return value, nil
+}
+
+// Register returns the value of a register by the name used in
+// expressions. The program counter is the address of the next
+// instruction.
+func (e *Expr) Register(name string) (int, bool) {
+	switch name {
+	case "pc":
+		return int(e.cpu.PC + 1), true
+	case "a":
+		return int(e.cpu.A), true
+	case "x":
+		return int(e.cpu.X), true
+	case "y":
+		return int(e.cpu.Y), true
+	case "sp":
+		return int(e.cpu.SP), true
+	case "sr":
+		return int(e.cpu.SR()), true
+	}
+	return 0, false
+}
+
+func (e *Expr) skipSpace() {
+	for e.pos < len(e.src) && (e.src[e.pos] == ' ' || e.src[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+func (e *Expr) parse(minPrec int) (int, error) {
+	left, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		e.skipSpace()
+		op, prec := e.peekOp()
+		if op == "" || prec < minPrec {
+			return left, nil
+		}
+		e.pos += len(op)
+		right, err := e.parse(prec + 1)
+		if err != nil {
+			return 0, err
+		}
+		left, err = applyOp(op, left, right)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (e *Expr) peekOp() (string, int) {
+	rest := e.src[e.pos:]
+	for _, o := range exprOps {
+		if strings.HasPrefix(rest, o.op) {
+			return o.op, o.prec
+		}
+	}
+	return "", 0
+}
+
+func exprBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func applyOp(op string, a int, b int) (int, error) {
+	switch op {
+	case "||":
+		return exprBool(a != 0 || b != 0), nil
+	case "&&":
+		return exprBool(a != 0 && b != 0), nil
+	case "==":
+		return exprBool(a == b), nil
+	case "!=":
+		return exprBool(a != b), nil
+	case "<":
+		return exprBool(a < b), nil
+	case ">":
+		return exprBool(a > b), nil
+	case "<=":
+		return exprBool(a <= b), nil
+	case ">=":
+		return exprBool(a >= b), nil
+	case "|":
+		return a | b, nil
+	case "^":
+		return a ^ b, nil
+	case "&":
+		return a & b, nil
+	case "<<":
+		return a << uint(b), nil
+	case ">>":
+		return a >> uint(b), nil
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	if op == "/" {
+		return a / b, nil
+	}
+	return a % b, nil
+}
+
+func (e *Expr) unary() (int, error) {
+	e.skipSpace()
+	if e.pos >= len(e.src) {
+		return 0, fmt.Errorf("invalid expression: %v", e.src)
+	}
+	ch := e.src[e.pos]
+	switch ch {
+	case '+':
+		if e.pos+1 < len(e.src) && isDigit(e.src[e.pos+1]) {
+			return e.number(1, 10, isDigit)
+		}
+	case '%':
+		return e.number(1, 2, func(c byte) bool { return c == '0' || c == '1' })
+	case '-', '~', '!', '<', '>':
+		e.pos++
+		value, err := e.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch ch {
+		case '-':
+			return -value, nil
+		case '~':
+			return ^value, nil
+		case '!':
+			return exprBool(value == 0), nil
+		case '<':
+			return value & 0xff, nil
+		}
+		return value >> 8 & 0xff, nil
+	}
+	return e.primary()
+}
+
+func (e *Expr) primary() (int, error) {
+	ch := e.src[e.pos]
+	switch {
+	case ch == '(' || ch == '[':
+		closing := map[byte]byte{'(': ')', '[': ']'}[ch]
+		e.pos++
+		value, err := e.parse(1)
+		if err != nil {
+			return 0, err
+		}
+		e.skipSpace()
+		if e.pos >= len(e.src) || e.src[e.pos] != closing {
+			return 0, fmt.Errorf("missing %c: %v", closing, e.src)
+		}
+		e.pos++
+		if ch == '[' {
+			return int(e.mem.Load16(uint16(value))), nil
+		}
+		return value, nil
+	case ch == '$':
+		return e.number(1, 16, isHexDigit)
+	case ch == '0' && strings.HasPrefix(e.src[e.pos:], "0x"):
+		return e.number(2, 16, isHexDigit)
+	case isNameChar(ch):
+		start := e.pos
+		for e.pos < len(e.src) && isNameChar(e.src[e.pos]) {
+			e.pos++
+		}
+		name := e.src[start:e.pos]
+		if value, err := strconv.ParseUint(name, 16, 32); err == nil {
+			if _, ok := e.Register(name); ok && e.strict {
+				return 0, fmt.Errorf("ambiguous: %v, use .%v or $%v", name, name, name)
+			}
+			return int(value), nil
+		}
+		if value, ok := e.Register(strings.TrimPrefix(name, ".")); ok {
+			return value, nil
+		}
+		if e.lookup != nil {
+			if value, ok := e.lookup(strings.TrimPrefix(name, ".")); ok {
+				return int(value), nil
+			}
+			if value, ok := e.lookup(name); ok {
+				return int(value), nil
+			}
+		}
+		return 0, fmt.Errorf("unknown symbol: %v", name)
+	}
+	return 0, fmt.Errorf("invalid expression: %v", e.src)
+}
+
+func (e *Expr) number(prefix int, base int, valid func(byte) bool) (int, error) {
+	e.pos += prefix
+	start := e.pos
+	for e.pos < len(e.src) && valid(e.src[e.pos]) {
+		e.pos++
+	}
+	value, err := strconv.ParseUint(e.src[start:e.pos], base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %v", e.src[start-prefix:e.pos])
+	}
+	return int(value), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isNameChar(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c == '_' || c == '.' || c == '@'
+}
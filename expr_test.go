@@ -0,0 +1,122 @@
+package mach85
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	mem := NewMemory(NewRAM(0x10000))
+	mem.StoreN(0xfffc, 0xe2, 0xfc)
+	cpu := New6510(mem)
+	cpu.PC = 0xc000 - 1
+	cpu.A = 0x10
+	cpu.X = 0x20
+	cpu.SP = 0xf0
+	symbols := map[string]uint16{"CHROUT": 0xffd2, "FA": 0xba}
+	lookup := func(name string) (uint16, bool) {
+		value, ok := symbols[name]
+		return value, ok
+	}
+	tests := []struct {
+		src   string
+		value int
+		err   string
+	}{
+		{"1234", 0x1234, ""},
+		{"$ff", 0xff, ""},
+		{"0x10", 0x10, ""},
+		{"+10", 10, ""},
+		{"%101", 5, ""},
+		{"ff+1", 0x100, ""},
+		{"sp+$100", 0x1f0, ""},
+		{"2+3*4", 14, ""},
+		{"(2+3)*4", 20, ""},
+		{"10-+10", 6, ""},
+		{"-1", -1, ""},
+		{"ff&f0|1", 0xf1, ""},
+		{"1<<4", 0x10, ""},
+		{"<1234", 0x34, ""},
+		{">1234", 0x12, ""},
+		{"~0&ff", 0xff, ""},
+		{"pc", 0xc000, ""},
+		{"a", 0x0a, ""},
+		{".a", 0x10, ""},
+		{"$a", 0x0a, ""},
+		{"c", 0x0c, ""},
+		{"x", 0x20, ""},
+		{".x", 0x20, ""},
+		{".a==10 && x>1f", 1, ""},
+		{".a!=10 || !x", 0, ""},
+		{"[fffc]", 0xfce2, ""},
+		{"[$fff0+c]+1", 0xfce3, ""},
+		{"CHROUT", 0xffd2, ""},
+		{">CHROUT", 0xff, ""},
+		{"FA", 0xfa, ""},
+		{".FA", 0xba, ""},
+		{"fa", 0xfa, ""},
+		{".CHROUT", 0xffd2, ""},
+		{"foo", 0, "unknown symbol: foo"},
+		{"1/0", 0, "division by zero"},
+		{"(1", 0, "missing ): (1"},
+		{"1 2", 0, "invalid expression: 1 2"},
+		{"", 0, "invalid expression: "},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			value, err := NewExpr(cpu, mem, lookup).Eval(test.src)
+			have := ""
+			if err != nil {
+				have = err.Error()
+			}
+			if test.err != have {
+				t.Fatalf("\n want: %v \n have: %v \n", test.err, have)
+			}
+			if test.value != value {
+				t.Errorf("\n want: %x \n have: %x \n", test.value, value)
+			}
+		})
+	}
+}
+
+func TestEvalCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.mach.Memory.StoreN(0xc000, 0x34, 0x12)
+	testMonitorParse(mon, "? 10 \n ? [c000] \n ? 0-1 \n ? foo \n p c000+1")
+	want := []string{
+		"$10 +16 %00010000",
+		"$1234 +4660 %0001001000110100",
+		"$ffff -1 %1111111111111111",
+		"unknown symbol: foo",
+		"$12 +18",
+	}
+	have := testLines(t, out, 5)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestHexArguments(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.Disassembler.LoadSource(&Source{Symbols: C64Symbols})
+	mon.cpu.A = 0x42
+	testMonitorParse(mon, "p c000 a \n p c001 .a \n p fa 1 \n p .FA 2 \n d a")
+	tests := []struct {
+		address uint16
+		want    uint8
+	}{
+		{0xc000, 0x0a},
+		{0xc001, 0x42},
+		{0x00fa, 0x01},
+		{C64Symbols["FA"], 0x02},
+	}
+	for _, test := range tests {
+		if have := mon.mem.Load(test.address); have != test.want {
+			t.Errorf("$%04x\n want: %02x \n have: %02x \n", test.address, test.want, have)
+		}
+	}
+	if have := out.String(); !strings.HasPrefix(have, "$000a:") {
+		t.Errorf("\n want: $000a: ... \n have: %v \n", have)
+	}
+}
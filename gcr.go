@@ -0,0 +1,143 @@
+package mach85
+
+// http://www.unusedino.de/ec64/technical/formats/g64.html
+
+// Group code recording for each nibble. No code has more than two zero
+// bits in a row so that the drive electronics can stay synchronized.
+var gcrCodes = [16]uint8{
+	0x0a, 0x0b, 0x12, 0x13, 0x0e, 0x0f, 0x16, 0x17,
+	0x09, 0x19, 0x1a, 0x1b, 0x0d, 0x1d, 0x1e, 0x15,
+}
+
+var gcrNibbles [32]int
+
+func init() {
+	for i := range gcrNibbles {
+		gcrNibbles[i] = -1
+	}
+	for nibble, code := range gcrCodes {
+		gcrNibbles[code] = nibble
+	}
+}
+
+const (
+	gcrSyncLen      = 5
+	gcrHeaderGapLen = 9
+	gcrSectorGapLen = 8
+	gcrGap          = 0x55
+	gcrSync         = 0xff
+	gcrHeaderID     = 0x08
+	gcrDataID       = 0x07
+	gcrHeaderLen    = 10  // 8 bytes encoded
+	gcrDataLen      = 325 // 260 bytes encoded
+)
+
+// gcrEncode converts each group of 4 bytes into 5 bytes of GCR.
+func gcrEncode(data []uint8) []uint8 {
+	out := make([]uint8, 0, len(data)*5/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		var bits uint64
+		for _, b := range data[i : i+4] {
+			bits = bits<<10 | uint64(gcrCodes[b>>4])<<5 | uint64(gcrCodes[b&0xf])
+		}
+		for shift := 32; shift >= 0; shift -= 8 {
+			out = append(out, uint8(bits>>uint(shift)))
+		}
+	}
+	return out
+}
+
+// gcrDecode converts each group of 5 GCR bytes back into 4 bytes. Returns
+// false if an invalid code is found.
+func gcrDecode(gcr []uint8) ([]uint8, bool) {
+	out := make([]uint8, 0, len(gcr)*4/5)
+	for i := 0; i+5 <= len(gcr); i += 5 {
+		var bits uint64
+		for _, b := range gcr[i : i+5] {
+			bits = bits<<8 | uint64(b)
+		}
+		for shift := 30; shift >= 0; shift -= 10 {
+			hi := gcrNibbles[bits>>uint(shift+5)&0x1f]
+			lo := gcrNibbles[bits>>uint(shift)&0x1f]
+			if hi < 0 || lo < 0 {
+				return nil, false
+			}
+			out = append(out, uint8(hi<<4|lo))
+		}
+	}
+	return out, true
+}
+
+func checksum(data []uint8) uint8 {
+	sum := uint8(0)
+	for _, b := range data {
+		sum ^= b
+	}
+	return sum
+}
+
+func repeat(value uint8, n int) []uint8 {
+	out := make([]uint8, n)
+	for i := range out {
+		out[i] = value
+	}
+	return out
+}
+
+// diskID returns the two ID bytes found in the header of each sector.
+func (d *DiskImage) diskID() (uint8, uint8) {
+	offset := d.Format.nameOffset + 0x12
+	return d.header()[offset], d.header()[offset+1]
+}
+
+// EncodeTrack returns the track as it is written on the disk surface. Each
+// sector has a sync mark followed by a header block, a gap, and another
+// sync mark followed by the data block.
+func (d *DiskImage) EncodeTrack(track int) []uint8 {
+	var out []uint8
+	id1, id2 := d.diskID()
+	for s := 0; s < d.Format.sectors(track); s++ {
+		data, _ := d.sector(track, s)
+		header := []uint8{gcrHeaderID, 0, uint8(s), uint8(track), id2, id1, 0x0f, 0x0f}
+		header[1] = checksum(header[2:6])
+		block := append([]uint8{gcrDataID}, data...)
+		block = append(block, checksum(data), 0, 0)
+
+		out = append(out, repeat(gcrSync, gcrSyncLen)...)
+		out = append(out, gcrEncode(header)...)
+		out = append(out, repeat(gcrGap, gcrHeaderGapLen)...)
+		out = append(out, repeat(gcrSync, gcrSyncLen)...)
+		out = append(out, gcrEncode(block)...)
+		out = append(out, repeat(gcrGap, gcrSectorGapLen)...)
+	}
+	return out
+}
+
+// DecodeTrack stores the sectors found in the track as written on the disk
+// surface back into the image. Blocks that cannot be decoded are skipped.
+func (d *DiskImage) DecodeTrack(track int, gcr []uint8) {
+	n := len(gcr)
+	// Sectors may wrap around the end of the track
+	gcr = append(append([]uint8{}, gcr...), gcr...)
+	sector := -1
+	for i := 1; i < n+1; i++ {
+		if gcr[i-1] != gcrSync || gcr[i] == gcrSync {
+			continue
+		}
+		header, ok := gcrDecode(gcr[i : i+gcrHeaderLen])
+		if ok && header[0] == gcrHeaderID && int(header[3]) == track {
+			sector = int(header[2])
+			continue
+		}
+		if sector < 0 || i+gcrDataLen > len(gcr) {
+			continue
+		}
+		block, ok := gcrDecode(gcr[i : i+gcrDataLen])
+		if ok && block[0] == gcrDataID {
+			if data, err := d.sector(track, sector); err == nil {
+				copy(data, block[1:sectorLen+1])
+			}
+		}
+		sector = -1
+	}
+}
@@ -0,0 +1,51 @@
+package mach85
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGCR(t *testing.T) {
+	data := []uint8{0x08, 0x00, 0xff, 0x5a}
+	gcr := gcrEncode(data)
+	want := []uint8{0x52, 0x54, 0xaa, 0xd5, 0xfa}
+	if !bytes.Equal(want, gcr) {
+		t.Errorf("\n want: %x \n have: %x \n", want, gcr)
+	}
+	have, ok := gcrDecode(gcr)
+	if !ok || !bytes.Equal(data, have) {
+		t.Errorf("\n want: %x \n have: %x \n", data, have)
+	}
+}
+
+func TestGCRInvalid(t *testing.T) {
+	if _, ok := gcrDecode([]uint8{0, 0, 0, 0, 0}); ok {
+		t.Errorf("expected invalid code")
+	}
+}
+
+func TestGCRTrack(t *testing.T) {
+	disk := NewDiskImage(FormatD64, "TEST", "01")
+	gcr := disk.EncodeTrack(18)
+	if gcr[0] != gcrSync || gcr[gcrSyncLen] != 0x52 {
+		t.Errorf("track does not start with sync and header: %x", gcr[:8])
+	}
+	other := NewDiskImage(FormatD64, "OTHER", "02")
+	other.DecodeTrack(18, gcr)
+	if other.Name() != "TEST" || other.ID() != "01" {
+		t.Errorf("\n want: %v %v \n have: %v %v \n", "TEST", "01", other.Name(), other.ID())
+	}
+}
+
+func TestGCRTrackWrapped(t *testing.T) {
+	disk := NewDiskImage(FormatD64, "TEST", "01")
+	gcr := disk.EncodeTrack(18)
+	// Start in the middle of the first data block
+	n := gcrSyncLen + gcrHeaderLen + gcrHeaderGapLen + gcrSyncLen + 100
+	gcr = append(gcr[n:], gcr[:n]...)
+	other := NewDiskImage(FormatD64, "OTHER", "02")
+	other.DecodeTrack(18, gcr)
+	if other.Name() != "TEST" {
+		t.Errorf("\n want: %v \n have: %v \n", "TEST", other.Name())
+	}
+}
@@ -0,0 +1,150 @@
+package mach85
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var hostExtensions = map[string]FileType{
+	".prg": FilePRG,
+	".seq": FileSEQ,
+	".usr": FileUSR,
+}
+
+// HostDrive serves files from a directory on the host. PETSCII names are
+// converted to lowercase with an extension for the file type, so that
+// loading "GAME" reads game.prg.
+type HostDrive struct {
+	Dir string
+}
+
+func NewHostDrive(dir string) *HostDrive {
+	return &HostDrive{Dir: dir}
+}
+
+// hostFile is a file in the directory with the name it is seen as on the
+// C64.
+type hostFile struct {
+	DirEntry
+	path string
+}
+
+func (d *HostDrive) files() ([]hostFile, error) {
+	infos, err := ioutil.ReadDir(d.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []hostFile
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		name := info.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		fileType, ok := hostExtensions[ext]
+		if ok {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		} else {
+			fileType = FilePRG
+		}
+		if len(name) > 16 {
+			name = name[:16]
+		}
+		blocks := int(info.Size()+sectorLen-3) / (sectorLen - 2)
+		files = append(files, hostFile{
+			DirEntry: DirEntry{
+				Name:   strings.ToUpper(name),
+				Type:   fileType,
+				Closed: true,
+				Blocks: blocks,
+			},
+			path: filepath.Join(d.Dir, info.Name()),
+		})
+	}
+	return files, nil
+}
+
+func (d *HostDrive) find(pattern string) (hostFile, error) {
+	files, err := d.files()
+	if err != nil {
+		return hostFile{}, err
+	}
+	for _, f := range files {
+		if matchName(pattern, f.Name) {
+			return f, nil
+		}
+	}
+	return hostFile{}, ErrFileNotFound
+}
+
+func (d *HostDrive) Load(name string) ([]uint8, error) {
+	if strings.HasPrefix(name, "$") {
+		pattern := ""
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			pattern = name[i+1:]
+		}
+		files, err := d.files()
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]DirEntry, len(files))
+		for i, f := range files {
+			entries[i] = f.DirEntry
+		}
+		dirName := strings.ToUpper(filepath.Base(d.Dir))
+		if len(dirName) > 16 {
+			dirName = dirName[:16]
+		}
+		return listing(dirName, "HD 2A", entries, pattern, 0), nil
+	}
+	f, err := d.find(parseFileSpec(name).name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(f.path)
+}
+
+func (d *HostDrive) Save(name string, data []uint8) error {
+	spec := parseFileSpec(name)
+	if spec.name == "" || strings.ContainsAny(spec.name, "/\\*?") {
+		return errors.New("invalid filename")
+	}
+	ext := ".prg"
+	for e, fileType := range hostExtensions {
+		if fileType == spec.fileType {
+			ext = e
+		}
+	}
+	path := filepath.Join(d.Dir, strings.ToLower(spec.name)+ext)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !spec.replace {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(path, flags, 0644)
+	if os.IsExist(err) {
+		return ErrFileExists
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (d *HostDrive) Scratch(pattern string) error {
+	f, err := d.find(pattern)
+	if err != nil {
+		return err
+	}
+	return os.Remove(f.path)
+}
+
+func (d *HostDrive) String() string {
+	return d.Dir
+}
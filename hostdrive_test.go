@@ -0,0 +1,103 @@
+package mach85
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestHostDrive(t *testing.T) (*Mach85, string) {
+	dir, err := ioutil.TempDir("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mach := New()
+	mach.StopOnBreak = true
+	mach.QuitOnStop = true
+	if err := mach.AttachDisk(8, dir); err != nil {
+		t.Fatal(err)
+	}
+	return mach, dir
+}
+
+func TestHostDriveLoad(t *testing.T) {
+	mach, dir := newTestHostDrive(t)
+	defer os.RemoveAll(dir)
+	prg := []uint8{0x00, 0xc0, 1, 2, 3}
+	ioutil.WriteFile(filepath.Join(dir, "game.prg"), prg, 0644)
+	testKernalCall(mach, AddrKernalLoad, "GAME", 1, 0)
+	if mach.cpu.C {
+		t.Fatalf("unexpected error: %v", mach.cpu.A)
+	}
+	if mach.Memory.Load(0xc002) != 3 {
+		t.Errorf("\n want: %v \n have: %v \n", 3, mach.Memory.Load(0xc002))
+	}
+}
+
+func TestHostDriveLoadNotFound(t *testing.T) {
+	mach, dir := newTestHostDrive(t)
+	defer os.RemoveAll(dir)
+	testKernalCall(mach, AddrKernalLoad, "GAME", 1, 0)
+	if !mach.cpu.C || mach.cpu.A != kernalErrFileNotFound {
+		t.Errorf("\n want: %v \n have: %v \n", kernalErrFileNotFound, mach.cpu.A)
+	}
+}
+
+func TestHostDriveSave(t *testing.T) {
+	mach, dir := newTestHostDrive(t)
+	defer os.RemoveAll(dir)
+	mach.Memory.StoreN(0xc000, 1, 2, 3)
+	mach.Memory.Store16(AddrStartAddress, 0xc000)
+	mach.Memory.Store16(AddrEndAddress, 0xc003)
+	testKernalCall(mach, AddrKernalSave, "GAME", 0, 0)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "game.prg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{0x00, 0xc0, 1, 2, 3}
+	if !bytes.Equal(want, data) {
+		t.Errorf("\n want: %v \n have: %v \n", want, data)
+	}
+}
+
+func TestHostDriveSaveExists(t *testing.T) {
+	mach, dir := newTestHostDrive(t)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "game.prg"), []uint8{0, 0}, 0644)
+	drive := mach.Drive(8)
+	if err := drive.Save("GAME", []uint8{1, 1}); err != ErrFileExists {
+		t.Errorf("\n want: %v \n have: %v \n", ErrFileExists, err)
+	}
+	if err := drive.Save("@0:GAME", []uint8{1, 1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHostDriveReadSEQ(t *testing.T) {
+	mach, dir := newTestHostDrive(t)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "notes.seq"), []uint8("HI"), 0644)
+	var calls [][2]uint16
+	calls = append(calls, testSerialOpen(8, 2, "NOTES,S,R")...)
+	calls = append(calls, testSerialRead(8, 2, 2)...)
+	testSerialCalls(mach, calls...)
+	have := []uint8{mach.Memory.Load(0xc000), mach.Memory.Load(0xc001)}
+	if !bytes.Equal([]uint8("HI"), have) {
+		t.Errorf("\n want: %q \n have: %q \n", "HI", have)
+	}
+}
+
+func TestHostDriveDirectory(t *testing.T) {
+	mach, dir := newTestHostDrive(t)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "game.prg"), make([]uint8, 300), 0644)
+	data, err := mach.Drive(8).Load("$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []uint8("\"GAME\"")) {
+		t.Errorf("game not in listing: %q", data)
+	}
+}
@@ -0,0 +1,85 @@
+package mach85
+
+// https://www.atarimagazines.com/compute/issue38/073_1_HOW_THE_VIC_64_SERIAL_BUS_WORKS.php
+
+// IECBus is the serial bus between the computer and emulated drives. The
+// ATN, CLK and DATA lines are open collector: a line is low if any device
+// on the bus is pulling it low.
+type IECBus struct {
+	atn    bool // pulled low by the computer
+	clk    bool
+	data   bool
+	drives []*TrueDrive
+}
+
+func NewIECBus() *IECBus {
+	return &IECBus{}
+}
+
+func (b *IECBus) add(d *TrueDrive) {
+	b.drives = append(b.drives, d)
+	d.bus = b
+	d.atnChanged()
+}
+
+func (b *IECBus) remove(d *TrueDrive) {
+	for i, drive := range b.drives {
+		if drive == d {
+			b.drives = append(b.drives[:i], b.drives[i+1:]...)
+			break
+		}
+	}
+	d.bus = nil
+}
+
+// ATN returns true if the line is low.
+func (b *IECBus) ATN() bool {
+	return b.atn
+}
+
+// CLK returns true if the line is low.
+func (b *IECBus) CLK() bool {
+	low := b.clk
+	for _, d := range b.drives {
+		low = low || d.clkOut
+	}
+	return low
+}
+
+// DATA returns true if the line is low. A drive pulls DATA low on its own
+// when ATN does not match its ATN acknowledge output, so that the computer
+// knows a device is present before the drive has responded.
+func (b *IECBus) DATA() bool {
+	low := b.data
+	for _, d := range b.drives {
+		low = low || d.dataOut || b.atn != d.atna
+	}
+	return low
+}
+
+// writeCIA is connected to port A of the second CIA. Bits 3 through 5
+// pull ATN, CLK and DATA low.
+func (b *IECBus) writeCIA(value uint8) {
+	atn := value&0x08 != 0
+	b.clk = value&0x10 != 0
+	b.data = value&0x20 != 0
+	if atn != b.atn {
+		b.atn = atn
+		for _, d := range b.drives {
+			d.atnChanged()
+		}
+	}
+}
+
+// readCIA is connected to port A of the second CIA. Bit 6 is the CLK line
+// and bit 7 is the DATA line, set when high.
+func (b *IECBus) readCIA() uint8 {
+	value := uint8(0x3f)
+	if !b.CLK() {
+		value |= 0x40
+	}
+	if !b.DATA() {
+		value |= 0x80
+	}
+	return value
+}
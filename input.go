@@ -0,0 +1,264 @@
+package mach85
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// InputType is the kind of input given to the machine.
+type InputType int
+
+const (
+	InputKey   InputType = iota // Value is the PETSCII code of the key
+	InputStop                   // Value is 1 when STOP is held and 0 when released
+	InputReset                  // The machine is reset
+	InputPoke                   // Value is stored at Address from the monitor
+)
+
+var inputNames = map[InputType]string{
+	InputKey:   "key",
+	InputStop:  "stop",
+	InputReset: "reset",
+	InputPoke:  "poke",
+}
+
+// InputEvent is input given to the machine when the CPU has executed the
+// number of cycles in Cycle.
+type InputEvent struct {
+	Cycle   uint64
+	Type    InputType
+	Address uint16
+	Value   uint8
+}
+
+// String formats the event as a line in an input file. The cycle is in
+// decimal and the rest is in hex as in the monitor.
+func (e InputEvent) String() string {
+	switch e.Type {
+	case InputReset:
+		return fmt.Sprintf("%v %v", e.Cycle, inputNames[e.Type])
+	case InputStop:
+		return fmt.Sprintf("%v %v %v", e.Cycle, inputNames[e.Type], e.Value)
+	case InputPoke:
+		return fmt.Sprintf("%v %v %04x %02x", e.Cycle, inputNames[e.Type], e.Address, e.Value)
+	}
+	return fmt.Sprintf("%v %v %02x", e.Cycle, inputNames[e.Type], e.Value)
+}
+
+func ParseInputEvent(line string) (InputEvent, error) {
+	var e InputEvent
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return e, fmt.Errorf("invalid input: %v", line)
+	}
+	cycle, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return e, fmt.Errorf("invalid cycle: %v", fields[0])
+	}
+	e.Cycle = cycle
+	found := false
+	for t, name := range inputNames {
+		if name == fields[1] {
+			e.Type, found = t, true
+		}
+	}
+	if !found {
+		return e, fmt.Errorf("invalid input: %v", fields[1])
+	}
+	args := fields[2:]
+	want := 1
+	switch e.Type {
+	case InputReset:
+		want = 0
+	case InputPoke:
+		want = 2
+	}
+	if len(args) != want {
+		return e, fmt.Errorf("invalid input: %v", line)
+	}
+	if e.Type == InputPoke {
+		address, err := strconv.ParseUint(args[0], 16, 16)
+		if err != nil {
+			return e, fmt.Errorf("invalid address: %v", args[0])
+		}
+		e.Address = uint16(address)
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		value, err := strconv.ParseUint(args[0], 16, 8)
+		if err != nil {
+			return e, fmt.Errorf("invalid value: %v", args[0])
+		}
+		e.Value = uint8(value)
+	}
+	return e, nil
+}
+
+// LoadInput reads an input file. Blank lines and lines starting with #
+// are ignored.
+func LoadInput(filename string) ([]InputEvent, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	events := []InputEvent{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := ParseInputEvent(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", n, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// inputRecorder writes each input event to a file.
+type inputRecorder struct {
+	file  *os.File
+	out   *bufio.Writer
+	mutex sync.Mutex
+}
+
+func (r *inputRecorder) write(e InputEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	fmt.Fprintln(r.out, e)
+}
+
+func (r *inputRecorder) close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := r.out.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// inputPlayer gives events to the machine when their cycle is reached.
+type inputPlayer struct {
+	events []InputEvent
+	pos    int
+}
+
+// seek skips to the first event after the cycle given.
+func (p *inputPlayer) seek(cycle uint64) {
+	p.pos = 0
+	for p.pos < len(p.events) && p.events[p.pos].Cycle <= cycle {
+		p.pos++
+	}
+}
+
+// Input gives input to the machine, which is ignored while input is being
+// played back from a file.
+func (m *Mach85) Input(e InputEvent) error {
+	if m.inputPlay != nil {
+		return errors.New("playing input")
+	}
+	m.applyInput(e)
+	return nil
+}
+
+func (m *Mach85) applyInput(e InputEvent) {
+	e.Cycle = m.cpu.Cycles
+	switch e.Type {
+	case InputKey:
+		m.Keyboard.push(e.Value)
+	case InputStop:
+		stopKey := uint16(m.Keyboard.Addrs.StopKey)
+		if e.Value != 0 {
+			m.Memory.Store(stopKey, 0x7f)
+		} else {
+			m.Memory.Store(stopKey, 0xff)
+		}
+	case InputReset:
+		m.hardReset()
+	case InputPoke:
+		m.Memory.Store(e.Address, e.Value)
+	}
+	if m.inputRec != nil {
+		m.inputRec.write(e)
+	}
+	if m.rewind != nil {
+		m.rewind.inputs = append(m.rewind.inputs, e)
+	}
+}
+
+// playInput is called before each instruction.
+func (m *Mach85) playInput() {
+	p := m.inputPlay
+	for p.pos < len(p.events) && p.events[p.pos].Cycle <= m.cpu.Cycles {
+		m.applyInput(p.events[p.pos])
+		p.pos++
+	}
+	if p.pos >= len(p.events) {
+		m.inputPlay = nil
+	}
+}
+
+// RecordInput writes all input given to the machine to a file until
+// StopInput is called. To reproduce a run, save a snapshot before
+// recording and load it before playing the input back.
+func (m *Mach85) RecordInput(filename string) error {
+	if m.inputRec != nil || m.inputPlay != nil {
+		return errors.New("input already recording or playing")
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(f)
+	fmt.Fprintf(out, "# mach85 input, starting at cycle %v\n", m.cpu.Cycles)
+	m.inputRec = &inputRecorder{file: f, out: out}
+	return nil
+}
+
+// PlayInput gives the machine the input in a file. Input from the
+// keyboard and the monitor is ignored until all events have been played.
+func (m *Mach85) PlayInput(filename string) error {
+	if m.inputRec != nil || m.inputPlay != nil {
+		return errors.New("input already recording or playing")
+	}
+	events, err := LoadInput(filename)
+	if err != nil {
+		return err
+	}
+	m.inputPlay = &inputPlayer{events: events}
+	return nil
+}
+
+func (m *Mach85) StopInput() error {
+	if m.inputPlay != nil {
+		m.inputPlay = nil
+		return nil
+	}
+	if m.inputRec != nil {
+		rec := m.inputRec
+		m.inputRec = nil
+		return rec.close()
+	}
+	return errors.New("input not recording or playing")
+}
+
+// InputStatus describes what is being done with the input.
+func (m *Mach85) InputStatus() string {
+	switch {
+	case m.inputRec != nil:
+		return fmt.Sprintf("recording input to %v", m.inputRec.file.Name())
+	case m.inputPlay != nil:
+		p := m.inputPlay
+		return fmt.Sprintf("playing input, %v/%v", p.pos, len(p.events))
+	}
+	return "input off"
+}
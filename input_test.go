@@ -0,0 +1,141 @@
+package mach85
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseInputEvent(t *testing.T) {
+	tests := []struct {
+		line string
+		want InputEvent
+		err  string
+	}{
+		{"100 key 41", InputEvent{Cycle: 100, Type: InputKey, Value: 0x41}, ""},
+		{"7 stop 1", InputEvent{Cycle: 7, Type: InputStop, Value: 1}, ""},
+		{"0 reset", InputEvent{Type: InputReset}, ""},
+		{"9 poke c000 ff", InputEvent{Cycle: 9, Type: InputPoke, Address: 0xc000, Value: 0xff}, ""},
+		{"x key 41", InputEvent{}, "invalid cycle: x"},
+		{"1 joy 1", InputEvent{}, "invalid input: joy"},
+		{"1 poke c000", InputEvent{}, "invalid input: 1 poke c000"},
+		{"1 key 100", InputEvent{}, "invalid value: 100"},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			have, err := ParseInputEvent(test.line)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("\n want: %v \n have: %v \n", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != test.want {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+			if have.String() != test.line {
+				t.Errorf("\n want: %v \n have: %v \n", test.line, have.String())
+			}
+		})
+	}
+}
+
+// newTestInput runs a loop that copies the length of the keyboard buffer
+// to $c000 and counts in X.
+func newTestInput() *Mach85 {
+	mach := New()
+	mach.Memory.StoreN(0x0800,
+		0xa5, 0xc6, // lda $c6
+		0x8d, 0x00, 0xc0, // sta $c000
+		0xe8,             // inx
+		0x4c, 0x00, 0x08, // jmp $0800
+	)
+	mach.cpu.PC = 0x0800 - 1
+	return mach
+}
+
+func TestInputRecordPlay(t *testing.T) {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	mach := newTestInput()
+	if err := mach.RecordInput(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		switch i {
+		case 10:
+			mach.Input(InputEvent{Type: InputKey, Value: 0x41})
+		case 50:
+			mach.Input(InputEvent{Type: InputPoke, Address: 0xc001, Value: 0x42})
+		}
+		mach.Step()
+	}
+	if err := mach.StopInput(); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestInput()
+	if err := other.PlayInput(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Input(InputEvent{Type: InputKey, Value: 0x43}); err == nil {
+		t.Errorf("expected input to be ignored")
+	}
+	for i := 0; i < 100; i++ {
+		other.Step()
+	}
+	tests := []struct {
+		name string
+		want interface{}
+		have interface{}
+	}{
+		{"buffer", mach.Memory.Load(AddrKeyboardBuffer), other.Memory.Load(AddrKeyboardBuffer)},
+		{"len", mach.Memory.Load(0xc000), other.Memory.Load(0xc000)},
+		{"poke", uint8(0x42), other.Memory.Load(0xc001)},
+		{"x", mach.cpu.X, other.cpu.X},
+		{"status", "input off", other.InputStatus()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.want, test.have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, test.have)
+			}
+		})
+	}
+}
+
+func TestRewindInput(t *testing.T) {
+	mach := newTestInput()
+	mach.EnableRewind(2)
+	for i := 0; i < 30; i++ {
+		if i == 10 {
+			mach.Input(InputEvent{Type: InputKey, Value: 0x41})
+		}
+		mach.Step()
+	}
+	if err := mach.StepBack(5); err != nil {
+		t.Fatal(err)
+	}
+	if have := mach.Memory.Load(AddrKeyboardBufferLen); have != 1 {
+		t.Errorf("\n want: %v \n have: %v \n", 1, have)
+	}
+}
+
+func TestInputCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "input \n input foo \n input off")
+	want := []string{"input off", "invalid input command: foo", "input not recording or playing"}
+	have := testLines(t, out, 3)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
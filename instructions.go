@@ -119,8 +119,10 @@ func jmpIndirect(c *CPU) {
 
 func jsr(c *CPU) {
 	address := c.fetch16()
+	from := c.PC - 2
 	c.push16(c.PC)
 	c.PC = address - 1
+	c.call(CallJsr, from, address)
 }
 
 func lda(c *CPU, load loader) {
@@ -192,6 +194,7 @@ func ror(c *CPU, load loader) {
 func rti(c *CPU) {
 	c.SetSR(c.pull())
 	c.PC = c.pull16() - 1
+	c.unwind()
 }
 
 func sbc(c *CPU, load loader) {
@@ -0,0 +1,48 @@
+package mach85
+
+// IOMemory is the chunk banked in at $d000 - $dfff for the I/O area.
+// Devices are mapped to pages in the area and any page without a device
+// acts as RAM. Devices are given the full address being accessed.
+type IOMemory struct {
+	ram   *RAM
+	pages [0x10]MemoryChunk
+}
+
+func NewIOMemory() *IOMemory {
+	return &IOMemory{ram: NewRAM(0x1000)}
+}
+
+// Map attaches the device to the pages that contain the start through end
+// addresses. A nil device returns the pages to RAM.
+func (m *IOMemory) Map(start uint16, end uint16, device MemoryChunk) {
+	for page := start >> 8 & 0xf; page <= end>>8&0xf; page++ {
+		m.pages[page] = device
+	}
+}
+
+func (m *IOMemory) Load(address uint16) uint8 {
+	if device := m.pages[address>>8]; device != nil {
+		return device.Load(0xd000 + address)
+	}
+	return m.ram.Load(address)
+}
+
+func (m *IOMemory) Peek(address uint16) uint8 {
+	if device := m.pages[address>>8]; device != nil {
+		return peek(device, 0xd000+address)
+	}
+	return m.ram.Load(address)
+}
+
+func (m *IOMemory) Store(address uint16, value uint8) {
+	if device := m.pages[address>>8]; device != nil {
+		device.Store(0xd000+address, value)
+		return
+	}
+	m.ram.Store(address, value)
+}
+
+// Reset clears the RAM but keeps the devices mapped.
+func (m *IOMemory) Reset() {
+	m.ram = NewRAM(0x1000)
+}
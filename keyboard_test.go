@@ -0,0 +1,77 @@
+package mach85
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testDrainKeyboard(mach *Mach85) []uint8 {
+	typed := []uint8{}
+	for i := 0; i < 100; i++ {
+		mach.Keyboard.Service()
+		len := mach.Memory.Load(AddrKeyboardBufferLen)
+		for j := uint16(0); j < uint16(len); j++ {
+			typed = append(typed, mach.Memory.Load(AddrKeyboardBuffer+j))
+		}
+		mach.Memory.Store(AddrKeyboardBufferLen, 0)
+	}
+	return typed
+}
+
+func TestKeyboardType(t *testing.T) {
+	mach := New()
+	if err := mach.Keyboard.Type("load\"*\",8,1\n"); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{
+		0x4c, 0x4f, 0x41, 0x44, 0x22, 0x2a, 0x22, 0x2c, 0x38, 0x2c, 0x31, 0x0d,
+	}
+	have := testDrainKeyboard(mach)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %x \n have: %x \n", want, have)
+	}
+}
+
+func TestKeyboardTypeWaitsForBuffer(t *testing.T) {
+	mach := New()
+	mach.Keyboard.Type("ab")
+	mach.Keyboard.Service()
+	mach.Keyboard.Service()
+	want := uint8(1)
+	have := mach.Memory.Load(AddrKeyboardBufferLen)
+	if want != have {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+	if mach.Keyboard.Typing() != 1 {
+		t.Errorf("expected one character to be pending")
+	}
+}
+
+func TestKeyboardTypeCarriageReturn(t *testing.T) {
+	mach := New()
+	mach.Keyboard.Type("10 rem\r\n20 end\r\n")
+	want := []uint8{
+		0x31, 0x30, 0x20, 0x52, 0x45, 0x4d, 0x0d,
+		0x32, 0x30, 0x20, 0x45, 0x4e, 0x44, 0x0d,
+	}
+	have := testDrainKeyboard(mach)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %x \n have: %x \n", want, have)
+	}
+}
+
+func TestKeyboardTypeInvalid(t *testing.T) {
+	mach := New()
+	err := mach.Keyboard.Type("a{b")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	want := "unable to type character: '{'"
+	have := err.Error()
+	if want != have {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+	if mach.Keyboard.Typing() != 0 {
+		t.Errorf("expected nothing to be typed")
+	}
+}
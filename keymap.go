@@ -0,0 +1,337 @@
+package mach85
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// KeyMod is the set of modifier keys held down on the host keyboard.
+type KeyMod uint8
+
+const (
+	ModShift KeyMod = 1 << iota
+	ModCtrl
+	ModAlt
+	ModGUI
+)
+
+var modNames = map[string]KeyMod{
+	"shift": ModShift,
+	"ctrl":  ModCtrl,
+	"alt":   ModAlt,
+	"gui":   ModGUI,
+}
+
+type KeyAction int
+
+const (
+	KeyPetscii KeyAction = iota // place Code in the keyboard buffer
+	KeyStop                     // hold down RUN/STOP
+	KeyReset                    // reset the machine
+)
+
+type KeyBinding struct {
+	Action KeyAction
+	Code   uint8
+}
+
+var keyNames = map[string]KeyBinding{
+	"stop":       {Action: KeyStop},
+	"reset":      {Action: KeyReset},
+	"return":     {Code: 0x0d},
+	"space":      {Code: 0x20},
+	"home":       {Code: 0x13},
+	"clr":        {Code: 0x93},
+	"del":        {Code: 0x14},
+	"inst":       {Code: 0x94},
+	"crsr-up":    {Code: KeyCursorUp},
+	"crsr-down":  {Code: KeyCursorDown},
+	"crsr-left":  {Code: KeyCursorLeft},
+	"crsr-right": {Code: KeyCursorRight},
+	"f1":         {Code: 0x85},
+	"f3":         {Code: 0x86},
+	"f5":         {Code: 0x87},
+	"f7":         {Code: 0x88},
+	"f2":         {Code: 0x89},
+	"f4":         {Code: 0x8a},
+	"f6":         {Code: 0x8b},
+	"f8":         {Code: 0x8c},
+	"rvs-on":     {Code: 0x12},
+	"rvs-off":    {Code: 0x92},
+	"lower":      {Code: 0x0e},
+	"upper":      {Code: 0x8e},
+	"blk":        {Code: 0x90},
+	"wht":        {Code: 0x05},
+	"red":        {Code: 0x1c},
+	"cyn":        {Code: 0x9f},
+	"pur":        {Code: 0x9c},
+	"grn":        {Code: 0x1e},
+	"blu":        {Code: 0x1f},
+	"yel":        {Code: 0x9e},
+	"orng":       {Code: 0x81},
+	"brn":        {Code: 0x95},
+	"lred":       {Code: 0x96},
+	"gry1":       {Code: 0x97},
+	"gry2":       {Code: 0x98},
+	"lgrn":       {Code: 0x99},
+	"lblu":       {Code: 0x9a},
+	"gry3":       {Code: 0x9b},
+}
+
+// https://wiki.libsdl.org/SDLKeycodeLookup
+var keycodeNames = map[string]sdl.Keycode{
+	"backspace": sdl.K_BACKSPACE,
+	"delete":    sdl.K_DELETE,
+	"down":      sdl.K_DOWN,
+	"end":       sdl.K_END,
+	"escape":    sdl.K_ESCAPE,
+	"f1":        sdl.K_F1,
+	"f2":        sdl.K_F2,
+	"f3":        sdl.K_F3,
+	"f4":        sdl.K_F4,
+	"f5":        sdl.K_F5,
+	"f6":        sdl.K_F6,
+	"f7":        sdl.K_F7,
+	"f8":        sdl.K_F8,
+	"home":      sdl.K_HOME,
+	"insert":    sdl.K_INSERT,
+	"left":      sdl.K_LEFT,
+	"pagedown":  sdl.K_PAGEDOWN,
+	"pageup":    sdl.K_PAGEUP,
+	"return":    sdl.K_RETURN,
+	"right":     sdl.K_RIGHT,
+	"space":     sdl.K_SPACE,
+	"tab":       sdl.K_TAB,
+	"up":        sdl.K_UP,
+}
+
+// https://wiki.libsdl.org/SDLScancodeLookup
+//
+// Positions are named by the key found there on a US keyboard.
+var scancodeNames = map[string]sdl.Scancode{
+	"a":         sdl.SCANCODE_A,
+	"b":         sdl.SCANCODE_B,
+	"c":         sdl.SCANCODE_C,
+	"d":         sdl.SCANCODE_D,
+	"e":         sdl.SCANCODE_E,
+	"f":         sdl.SCANCODE_F,
+	"g":         sdl.SCANCODE_G,
+	"h":         sdl.SCANCODE_H,
+	"i":         sdl.SCANCODE_I,
+	"j":         sdl.SCANCODE_J,
+	"k":         sdl.SCANCODE_K,
+	"l":         sdl.SCANCODE_L,
+	"m":         sdl.SCANCODE_M,
+	"n":         sdl.SCANCODE_N,
+	"o":         sdl.SCANCODE_O,
+	"p":         sdl.SCANCODE_P,
+	"q":         sdl.SCANCODE_Q,
+	"r":         sdl.SCANCODE_R,
+	"s":         sdl.SCANCODE_S,
+	"t":         sdl.SCANCODE_T,
+	"u":         sdl.SCANCODE_U,
+	"v":         sdl.SCANCODE_V,
+	"w":         sdl.SCANCODE_W,
+	"x":         sdl.SCANCODE_X,
+	"y":         sdl.SCANCODE_Y,
+	"z":         sdl.SCANCODE_Z,
+	"1":         sdl.SCANCODE_1,
+	"2":         sdl.SCANCODE_2,
+	"3":         sdl.SCANCODE_3,
+	"4":         sdl.SCANCODE_4,
+	"5":         sdl.SCANCODE_5,
+	"6":         sdl.SCANCODE_6,
+	"7":         sdl.SCANCODE_7,
+	"8":         sdl.SCANCODE_8,
+	"9":         sdl.SCANCODE_9,
+	"0":         sdl.SCANCODE_0,
+	"`":         sdl.SCANCODE_GRAVE,
+	"-":         sdl.SCANCODE_MINUS,
+	"=":         sdl.SCANCODE_EQUALS,
+	"[":         sdl.SCANCODE_LEFTBRACKET,
+	"]":         sdl.SCANCODE_RIGHTBRACKET,
+	"\\":        sdl.SCANCODE_BACKSLASH,
+	";":         sdl.SCANCODE_SEMICOLON,
+	"'":         sdl.SCANCODE_APOSTROPHE,
+	",":         sdl.SCANCODE_COMMA,
+	".":         sdl.SCANCODE_PERIOD,
+	"/":         sdl.SCANCODE_SLASH,
+	"backspace": sdl.SCANCODE_BACKSPACE,
+	"delete":    sdl.SCANCODE_DELETE,
+	"down":      sdl.SCANCODE_DOWN,
+	"end":       sdl.SCANCODE_END,
+	"escape":    sdl.SCANCODE_ESCAPE,
+	"f1":        sdl.SCANCODE_F1,
+	"f2":        sdl.SCANCODE_F2,
+	"f3":        sdl.SCANCODE_F3,
+	"f4":        sdl.SCANCODE_F4,
+	"f5":        sdl.SCANCODE_F5,
+	"f6":        sdl.SCANCODE_F6,
+	"f7":        sdl.SCANCODE_F7,
+	"f8":        sdl.SCANCODE_F8,
+	"home":      sdl.SCANCODE_HOME,
+	"insert":    sdl.SCANCODE_INSERT,
+	"left":      sdl.SCANCODE_LEFT,
+	"pagedown":  sdl.SCANCODE_PAGEDOWN,
+	"pageup":    sdl.SCANCODE_PAGEUP,
+	"return":    sdl.SCANCODE_RETURN,
+	"right":     sdl.SCANCODE_RIGHT,
+	"space":     sdl.SCANCODE_SPACE,
+	"tab":       sdl.SCANCODE_TAB,
+	"up":        sdl.SCANCODE_UP,
+}
+
+type hostKey struct {
+	mod  KeyMod
+	code uint32
+}
+
+// Keymap maps keys pressed on the host to keys on the C64. A symbolic keymap
+// matches on the character printed on the host key and a positional keymap
+// matches on the location of the key.
+type Keymap struct {
+	Positional bool
+	bindings   map[hostKey]KeyBinding
+}
+
+func NewKeymap(positional bool) *Keymap {
+	return &Keymap{
+		Positional: positional,
+		bindings:   make(map[hostKey]KeyBinding),
+	}
+}
+
+func (k *Keymap) Bind(mod KeyMod, code uint32, binding KeyBinding) {
+	k.bindings[hostKey{mod: mod, code: code}] = binding
+}
+
+// Lookup finds the binding for the key in the event. If there is no binding
+// with the modifiers held down, the binding for the key by itself is used.
+func (k *Keymap) Lookup(keysym sdl.Keysym) (KeyBinding, bool) {
+	mod := keyMod(keysym.Mod)
+	code := uint32(keysym.Sym)
+	if k.Positional {
+		code = uint32(keysym.Scancode)
+	}
+	binding, ok := k.bindings[hostKey{mod: mod, code: code}]
+	if !ok {
+		binding, ok = k.bindings[hostKey{code: code}]
+	}
+	return binding, ok
+}
+
+func keyMod(mod uint16) KeyMod {
+	result := KeyMod(0)
+	if mod&sdl.KMOD_SHIFT != 0 {
+		result |= ModShift
+	}
+	if mod&sdl.KMOD_CTRL != 0 {
+		result |= ModCtrl
+	}
+	if mod&sdl.KMOD_ALT != 0 {
+		result |= ModAlt
+	}
+	if mod&sdl.KMOD_GUI != 0 {
+		result |= ModGUI
+	}
+	return result
+}
+
+func LoadKeymap(filename string) (*Keymap, error) {
+	in, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return ParseKeymap(in)
+}
+
+// ParseKeymap reads a keymap with one binding per line in the form of:
+//
+//	[modifier+...]key value
+//
+// Modifiers are shift, ctrl, alt and gui. The value is either a PETSCII
+// code or the name of a C64 key. Lines starting with a "#" are comments.
+// The directive "positional" on a line by itself before the bindings
+// creates a positional keymap.
+func ParseKeymap(r io.Reader) (*Keymap, error) {
+	k := NewKeymap(false)
+	s := bufio.NewScanner(r)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 1 && fields[0] == "positional" {
+			k.Positional = true
+			continue
+		}
+		if len(fields) < 2 || (len(fields) > 2 && !strings.HasPrefix(fields[2], "#")) {
+			return nil, fmt.Errorf("line %v: invalid binding: %v", lineNum, line)
+		}
+		mod, code, err := k.parseHostKey(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNum, err)
+		}
+		binding, err := parseKeyBinding(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNum, err)
+		}
+		k.Bind(mod, code, binding)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keymap) parseHostKey(str string) (KeyMod, uint32, error) {
+	mod := KeyMod(0)
+	name := str
+	// The plus key itself can appear at the end, as in "shift++"
+	for i := strings.Index(name, "+"); i > 0 && i < len(name)-1; i = strings.Index(name, "+") {
+		m, ok := modNames[name[:i]]
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown modifier: %v", name[:i])
+		}
+		mod |= m
+		name = name[i+1:]
+	}
+	if k.Positional {
+		code, ok := scancodeNames[name]
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown key: %v", name)
+		}
+		return mod, uint32(code), nil
+	}
+	if code, ok := keycodeNames[name]; ok {
+		return mod, uint32(code), nil
+	}
+	// Keycodes for printable keys are the characters themselves
+	ch, size := utf8.DecodeRuneInString(name)
+	if size != len(name) {
+		return 0, 0, fmt.Errorf("unknown key: %v", name)
+	}
+	return mod, uint32(sdl.Keycode(unicode.ToLower(ch))), nil
+}
+
+func parseKeyBinding(str string) (KeyBinding, error) {
+	if binding, ok := keyNames[str]; ok {
+		return binding, nil
+	}
+	code, err := parseValue(str)
+	if err != nil {
+		return KeyBinding{}, fmt.Errorf("invalid key: %v", str)
+	}
+	return KeyBinding{Code: code}, nil
+}
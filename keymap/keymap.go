@@ -0,0 +1,26 @@
+package keymap
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	Path string
+	Name string
+)
+
+func init() {
+	flag.StringVar(&Path, "keymap-path", "keymap", "path to keymap files")
+	flag.StringVar(&Name, "keymap", "symbolic", "keymap name or file")
+}
+
+// File returns the path to the selected keymap. A name without a directory
+// or extension refers to one of the keymaps found in Path.
+func File() string {
+	if strings.ContainsRune(Name, filepath.Separator) || filepath.Ext(Name) != "" {
+		return Name
+	}
+	return filepath.Join(Path, Name+".keymap")
+}
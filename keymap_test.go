@@ -0,0 +1,93 @@
+package mach85
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func TestKeymapLookup(t *testing.T) {
+	kmap, err := LoadKeymap("keymap/symbolic.keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name   string
+		keysym sdl.Keysym
+		want   KeyBinding
+	}{
+		{"letter", sdl.Keysym{Sym: 'a'}, KeyBinding{Code: 0x41}},
+		{"shifted", sdl.Keysym{Sym: 'a', Mod: sdl.KMOD_LSHIFT}, KeyBinding{Code: 0xc1}},
+		{"commodore", sdl.Keysym{Sym: 'a', Mod: sdl.KMOD_LALT}, KeyBinding{Code: 0xb0}},
+		{"color", sdl.Keysym{Sym: '1', Mod: sdl.KMOD_RCTRL}, KeyBinding{Code: 0x90}},
+		{"caps lock ignored", sdl.Keysym{Sym: 'a', Mod: sdl.KMOD_CAPS}, KeyBinding{Code: 0x41}},
+		{"unmapped modifier", sdl.Keysym{Sym: '.', Mod: sdl.KMOD_ALT}, KeyBinding{Code: 0x2e}},
+		{"named", sdl.Keysym{Sym: sdl.K_F2}, KeyBinding{Code: 0x89}},
+		{"action", sdl.Keysym{Sym: sdl.K_ESCAPE, Mod: sdl.KMOD_CTRL}, KeyBinding{Action: KeyReset}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			have, ok := kmap.Lookup(test.keysym)
+			if !ok {
+				t.Fatalf("no binding")
+			}
+			if test.want != have {
+				t.Errorf("\n want: %+v \n have: %+v \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestKeymapPositional(t *testing.T) {
+	kmap, err := LoadKeymap("keymap/positional.keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !kmap.Positional {
+		t.Fatalf("expected positional keymap")
+	}
+	keysym := sdl.Keysym{Sym: '=', Scancode: sdl.SCANCODE_MINUS}
+	want := KeyBinding{Code: 0x2b}
+	have, _ := kmap.Lookup(keysym)
+	if want != have {
+		t.Errorf("\n want: %+v \n have: %+v \n", want, have)
+	}
+}
+
+func TestKeymapPlusKey(t *testing.T) {
+	kmap, err := ParseKeymap(strings.NewReader("shift++ $db\n+ $2b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KeyBinding{Code: 0xdb}
+	have, _ := kmap.Lookup(sdl.Keysym{Sym: '+', Mod: sdl.KMOD_SHIFT})
+	if want != have {
+		t.Errorf("\n want: %+v \n have: %+v \n", want, have)
+	}
+}
+
+func TestKeymapErrors(t *testing.T) {
+	var tests = []struct {
+		name string
+		text string
+		want string
+	}{
+		{"modifier", "# comment\nmeta+a $41", "line 2: unknown modifier: meta"},
+		{"key", "pgup $41", "line 1: unknown key: pgup"},
+		{"value", "a foo", "line 1: invalid key: foo"},
+		{"fields", "a $41 $42", "line 1: invalid binding: a $41 $42"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseKeymap(strings.NewReader(test.text))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			have := err.Error()
+			if test.want != have {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
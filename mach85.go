@@ -1,10 +1,16 @@
 package mach85
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/blackchip-org/mach85/keymap"
+	"github.com/blackchip-org/mach85/rom"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
@@ -25,6 +31,7 @@ const (
 	Break
 	Breakpoint
 	Trap
+	Watchpoint
 )
 
 func (s Status) String() string {
@@ -41,58 +48,179 @@ func (s Status) String() string {
 		return "breakpoint"
 	case Trap:
 		return "trap"
+	case Watchpoint:
+		return "watchpoint"
 	}
 	return "???"
 }
 
 type Mach85 struct {
 	Trace       func(op Operation)
-	Breakpoints map[uint16]bool
+	Breakpoints map[uint16]*BreakpointInfo
+	Expr        *Expr // evaluates breakpoint conditions
+	Watches     *Watches
 	Memory      *Memory
+	Keyboard    *Keyboard
+	SID         *SID
 	Status      Status
 	Err         error
 	StopOnBreak bool
 	QuitOnStop  bool
 	OnStop      func()
-	cpu         *CPU
-	devices     []Device
-	inputs      []SDLInput
-	dasm        *Disassembler
-	start       chan bool
-	stop        chan bool
-	reset       chan bool
+	RealTime    bool // run no faster than the original
+	// EmulateDrives inserts D64 images into an emulated 1541 instead of
+	// replacing the KERNAL routines.
+	EmulateDrives bool
+	profile       *Profile
+	cpu           *CPU
+	devices       []Device
+	audio         *Audio
+	video         *Video
+	recorder      *SIDRecorder
+	until         func() bool
+	inputs        []SDLInput
+	drives        map[int]Drive
+	bus           *serialBus
+	iec           *IECBus
+	cia1          *CIA
+	cia2          *CIA
+	clock         *JiffyClock
+	tape          *Datasette
+	cart          *Cartridge
+	reu           *REU
+	trueDrives    map[int]*TrueDrive
+	rewind        *Rewind
+	inputRec      *inputRecorder
+	inputPlay     *inputPlayer
+	pacer         pacer
+	traps         map[uint16]func() bool
+	dasm          *Disassembler
+	start         chan bool
+	stop          chan bool
+	reset         chan bool
 }
 
+// New creates a C64.
 func New() *Mach85 {
-	mem := NewMemory(NewMemory64())
+	m := newMachine(Profiles["c64"], NewMemory(NewMemory64()))
+	m.traps = map[uint16]func() bool{
+		AddrKernalTalk:     m.trapTalk,
+		AddrKernalListen:   m.trapListen,
+		AddrKernalSecond:   m.trapSecond,
+		AddrKernalTalkSA:   m.trapTalkSA,
+		AddrKernalCIOUT:    m.trapCIOUT,
+		AddrKernalUntalk:   m.trapUntalk,
+		AddrKernalUnlisten: m.trapUnlisten,
+		AddrKernalACPTR:    m.trapACPTR,
+		AddrKernalLoad:     m.trapLoad,
+		AddrKernalSave:     m.trapSave,
+	}
+	return m
+}
+
+// NewMachine creates the machine described by the profile. ROMs are
+// loaded when Init is called.
+func NewMachine(p *Profile) (*Mach85, error) {
+	if p.Regions == nil {
+		return New(), nil
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	mem := NewMemory(nil)
+	m := newMachine(p, mem)
+	mapped := NewMappedMemory(p.Regions, m.cpu)
+	mem.Base = mapped
+	for _, d := range mapped.Devices() {
+		m.AddDevice(d)
+	}
+	return m, nil
+}
+
+func newMachine(p *Profile, mem *Memory) *Mach85 {
 	cpu := New6510(mem)
 	m := &Mach85{
+		profile:     p,
 		Memory:      mem,
 		cpu:         cpu,
 		dasm:        NewDisassembler(mem),
-		Breakpoints: map[uint16]bool{},
+		Breakpoints: map[uint16]*BreakpointInfo{},
+		Expr:        NewExpr(cpu, mem, nil),
+		Watches:     NewWatches(),
 		OnStop:      func() {},
 		devices:     []Device{},
+		drives:      map[int]Drive{},
+		bus:         newSerialBus(),
+		trueDrives:  map[int]*TrueDrive{},
 		start:       make(chan bool, 10),
 		stop:        make(chan bool, 10),
 		reset:       make(chan bool, 10),
 	}
+	mem.watches = m.Watches
+	m.Keyboard = NewKeyboard(m)
+	if p.Keyboard != nil {
+		m.Keyboard.Addrs = *p.Keyboard
+	}
 	return m
 }
 
 func (m *Mach85) Init() error {
-	mem64 := m.Memory.Base.(*Memory64)
-	if err := mem64.Init(); err != nil {
-		log.Fatal(err)
+	var screen Screen
+	switch mem := m.Memory.Base.(type) {
+	case *Memory64:
+		if err := mem.Init(); err != nil {
+			log.Fatal(err)
+		}
+		screen = c64Screen{mem}
+	case *MappedMemory:
+		if err := mem.Init(rom.Path); err != nil {
+			log.Fatal(err)
+		}
+		s, err := m.profileScreen(mem)
+		if err != nil {
+			log.Fatal(err)
+		}
+		screen = s
 	}
 
-	video, err := NewVideo(m.Memory)
-	if err != nil {
-		log.Fatalf("unable to create window: %v", err)
+	if screen != nil {
+		video, err := NewVideo(screen, m.cpu)
+		if err != nil {
+			log.Fatalf("unable to create window: %v", err)
+		}
+		m.video = video
+		m.AddDevice(video)
+	}
+	if m.profile.Jiffy {
+		m.clock = NewJiffyClock(m.cpu)
+		m.AddDevice(m.clock)
+	}
+
+	if _, ok := m.Memory.Base.(*Memory64); ok {
+		model, err := ParseSIDModel(sidModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		m.InitSID(model)
+		audio, err := NewAudio(m.SID)
+		if err != nil {
+			log.Printf("unable to open audio, sound disabled: %v", err)
+		} else {
+			audio.cpu = m.cpu
+			audio.lastCycles = m.cpu.Cycles
+			m.audio = audio
+		}
+	}
+
+	if m.profile.Keyboard != nil {
+		kmap, err := LoadKeymap(keymap.File())
+		if err != nil {
+			log.Fatalf("unable to load keymap: %v", err)
+		}
+		m.Keyboard.Keymap = kmap
+		m.AddDevice(m.Keyboard)
+		m.AddInput(m.Keyboard)
 	}
-	m.AddDevice(video)
-	m.AddDevice(NewJiffyClock(m.cpu))
-	m.AddInput(NewKeyboard(m))
 
 	m.cpu.PC = m.Memory.Load16(AddrResetVector) - 1
 	return nil
@@ -101,23 +229,34 @@ func (m *Mach85) Init() error {
 func (m *Mach85) Run() {
 	m.Status = Init
 	lastUpdate := time.Now()
+	resumed := false
 	for {
 		if m.Status != Init && m.Status != Run && m.QuitOnStop {
 			return
 		}
 		if m.Status != Run {
 			if m.Status != Init {
+				m.until = nil
 				m.OnStop()
 			}
 			<-m.start
 			m.cpu.B = false
 			m.Err = nil
+			m.pacer.restart(m.cpu.Cycles)
+			m.Watches.hits = nil
+			resumed = true
 		}
 		m.Status = Run
-		if _, ok := m.Breakpoints[m.cpu.PC+1]; ok {
+		// Do not stop again at the breakpoint the machine was resumed from
+		if !resumed && m.breakpoint() {
 			m.Status = Breakpoint
 			continue
 		}
+		if m.until != nil && m.until() && !resumed {
+			m.Status = Halt
+			continue
+		}
+		resumed = false
 		if m.cpu.B {
 			if m.StopOnBreak {
 				m.Status = Break
@@ -130,16 +269,21 @@ func (m *Mach85) Run() {
 			m.Status = Halt
 			continue
 		case <-m.reset:
-			m.cpu.Reset()
-			mem64 := m.Memory.Base.(*Memory64)
-			mem64.Reset()
+			m.Input(InputEvent{Type: InputReset})
 		default:
 			m.cycle()
 		}
+		if m.Status == Run && len(m.Watches.hits) > 0 {
+			m.Status = Watchpoint
+			continue
+		}
 
 		now := time.Now()
 		if now.Sub(lastUpdate) > time.Millisecond {
 			lastUpdate = now
+			if m.RealTime {
+				m.pacer.wait(m.cpu.Cycles)
+			}
 			for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 				if _, ok := event.(*sdl.QuitEvent); ok {
 					os.Exit(0)
@@ -152,12 +296,64 @@ func (m *Mach85) Run() {
 	}
 }
 
+// hardReset resets the CPU, memory and the devices that have a reset
+// line.
+func (m *Mach85) hardReset() {
+	m.cpu.Reset()
+	switch mem := m.Memory.Base.(type) {
+	case *Memory64:
+		mem.Reset()
+	case *MappedMemory:
+		mem.Reset()
+	}
+	if m.cart != nil {
+		m.cart.Reset()
+	}
+	if m.reu != nil {
+		m.reu.Reset()
+	}
+	if m.SID != nil {
+		m.SID.Reset()
+	}
+}
+
 func (m *Mach85) cycle() {
 	if m.Trace != nil && !m.cpu.inISR {
 		m.dasm.PC = m.cpu.PC
 		m.Trace(m.dasm.Next())
 	}
-	err := m.cpu.Next()
+	m.execute(true)
+	if m.Status == Trap {
+		return
+	}
+	if err := m.serviceSound(); err != nil {
+		m.Err = err
+		m.Status = Trap
+	}
+}
+
+// execute runs the next instruction and services the devices. When watch
+// is set, the memory accesses made by the instruction are checked against
+// the watchpoints.
+func (m *Mach85) execute(watch bool) {
+	if m.inputPlay != nil {
+		m.playInput()
+	}
+	if m.rewind != nil {
+		if err := m.rewind.record(m); err != nil {
+			m.Err = err
+			m.Status = Trap
+			return
+		}
+	}
+	if watch {
+		m.Watches.begin(m.cpu.PC + 1)
+	}
+	var err error
+	if !m.trap() {
+		err = m.cpu.Next()
+	}
+	m.Watches.end()
 	if err != nil {
 		m.Err = err
 		m.Status = Trap
@@ -173,10 +369,113 @@ func (m *Mach85) cycle() {
 	}
 }
 
+// Step executes the next instruction while the machine is stopped. The
+// watchpoint hits are those of the instruction.
+func (m *Mach85) Step() error {
+	m.Watches.hits = nil
+	m.execute(true)
+	if m.Status == Trap {
+		return m.Err
+	}
+	return nil
+}
+
+// The SID is clocked by either the recorder or the audio output, but
+// not both.
+func (m *Mach85) serviceSound() error {
+	if m.recorder != nil {
+		return m.recorder.Service()
+	}
+	if m.audio != nil {
+		return m.audio.Service()
+	}
+	return nil
+}
+
+// InitSID creates a SID of the given model and maps it into the I/O area
+// of the C64.
+func (m *Mach85) InitSID(model SIDModel) {
+	m.SID = NewSID(model)
+	mem64 := m.Memory.Base.(*Memory64)
+	mem64.MapIO(0xd400, 0xd7ff, m.SID)
+}
+
+// RecordSID renders the SID output to a WAV file at the sample rate given
+// until StopRecording is called. Audio output is paused while recording.
+func (m *Mach85) RecordSID(filename string, sampleRate int) error {
+	if m.SID == nil {
+		return errors.New("no SID")
+	}
+	if m.recorder != nil {
+		return errors.New("already recording")
+	}
+	recorder, err := NewSIDRecorder(m.SID, m.cpu, filename, sampleRate)
+	if err != nil {
+		return err
+	}
+	m.recorder = recorder
+	return nil
+}
+
+func (m *Mach85) StopRecording() error {
+	if m.recorder == nil {
+		return errors.New("not recording")
+	}
+	recorder := m.recorder
+	m.recorder = nil
+	return recorder.Close()
+}
+
+func (m *Mach85) Recording() bool {
+	return m.recorder != nil
+}
+
+// Profile returns the description of the machine.
+func (m *Mach85) Profile() *Profile {
+	return m.profile
+}
+
+// mem64 returns the memory of the C64 for the features that only exist
+// there.
+func (m *Mach85) mem64() (*Memory64, error) {
+	mem64, ok := m.Memory.Base.(*Memory64)
+	if !ok {
+		return nil, fmt.Errorf("not available on the %v", m.profile.Name)
+	}
+	return mem64, nil
+}
+
+// profileScreen returns the display for the video chip in the profile.
+func (m *Mach85) profileScreen(mem *MappedMemory) (Screen, error) {
+	switch m.profile.Video {
+	case "pet":
+		data, err := ioutil.ReadFile(filepath.Join(rom.Path, m.profile.CharROM))
+		if err != nil {
+			return nil, err
+		}
+		return petScreen{mem: m.Memory, charROM: NewROM(data)}, nil
+	case "vic-i":
+		vic, ok := mem.chip(RegionVICI).(*VICI)
+		if !ok {
+			return nil, errors.New("no vic-i in the memory map")
+		}
+		return vicScreen{mem: m.Memory, vic: vic}, nil
+	}
+	return nil, nil
+}
+
 func (m *Mach85) Start() {
 	m.start <- true
 }
 
+// RunUntil starts the machine and stops it when done returns true. It is
+// called before each instruction, including the first, but does not stop
+// the machine before the first instruction is run.
+func (m *Mach85) RunUntil(done func() bool) {
+	m.until = done
+	m.Start()
+}
+
 func (m *Mach85) Stop() {
 	m.stop <- true
 }
@@ -189,6 +488,15 @@ func (m *Mach85) AddDevice(d Device) {
 	m.devices = append(m.devices, d)
 }
 
+func (m *Mach85) RemoveDevice(d Device) {
+	for i, device := range m.devices {
+		if device == d {
+			m.devices = append(m.devices[:i], m.devices[i+1:]...)
+			return
+		}
+	}
+}
+
 func (m *Mach85) AddInput(i SDLInput) {
 	m.inputs = append(m.inputs, i)
 }
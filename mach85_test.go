@@ -1,6 +1,9 @@
 package mach85
 
 import (
+	"io/ioutil"
+	"os"
+	"reflect"
 	"testing"
 
 	"github.com/blackchip-org/mach85/rom"
@@ -24,3 +27,88 @@ func BenchmarkMach(b *testing.B) {
 		}
 	})
 }
+
+func testRecordSID(t *testing.T, sampleRate int) (*Mach85, []int16) {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	mach := New()
+	mach.StopOnBreak = true
+	mach.QuitOnStop = true
+	mach.InitSID(SID8580)
+	mach.Memory.StoreN(0x0800,
+		0xa9, 0x0f, // lda #$0f
+		0x8d, 0x18, 0xd4, // sta $d418 ; volume
+		0xa9, 0x1c, // lda #$1c
+		0x8d, 0x01, 0xd4, // sta $d401 ; frequency
+		0xa9, 0x08, // lda #$08
+		0x8d, 0x03, 0xd4, // sta $d403 ; pulse width
+		0xa9, 0xf0, // lda #$f0
+		0x8d, 0x06, 0xd4, // sta $d406 ; sustain
+		0xa9, 0x41, // lda #$41
+		0x8d, 0x04, 0xd4, // sta $d404 ; pulse, gate on
+		0xa2, 0x00, // ldx #$00
+		0xa0, 0x40, // ldy #$40
+		0xca,       // dex
+		0xd0, 0xfd, // bne -3
+		0x88,       // dey
+		0xd0, 0xfa, // bne -6
+		0x00, // brk
+	)
+	mach.cpu.PC = 0x0800 - 1
+	if err := mach.RecordSID(file.Name(), sampleRate); err != nil {
+		t.Fatal(err)
+	}
+	mach.Start()
+	mach.Run()
+	if err := mach.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := os.Open(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	rate, samples, err := ReadWAV(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != sampleRate {
+		t.Errorf("\n want: %v \n have: %v \n", sampleRate, rate)
+	}
+	return mach, samples
+}
+
+func TestRecordSID(t *testing.T) {
+	mach, samples := testRecordSID(t, 22050)
+	want := int(mach.cpu.Cycles * 22050 / ClockRateNTSC)
+	have := len(samples)
+	if want != have {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+	min, max := int16(0), int16(0)
+	for _, s := range samples {
+		if s < min {
+			min = s
+		}
+		if s > max {
+			max = s
+		}
+	}
+	if min > -8000 || max < 8000 {
+		t.Errorf("expected square wave, have range %v to %v", min, max)
+	}
+}
+
+func TestRecordSIDDeterministic(t *testing.T) {
+	_, samples1 := testRecordSID(t, 8000)
+	_, samples2 := testRecordSID(t, 8000)
+	if !reflect.DeepEqual(samples1, samples2) {
+		t.Errorf("recordings are not the same")
+	}
+}
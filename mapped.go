@@ -0,0 +1,208 @@
+package mach85
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// MappedMemory is the address space of a machine described by the
+// regions in a profile. Regions are mapped in blocks of 16 bytes and
+// addresses outside of a region read as $ff.
+type MappedMemory struct {
+	regions []*mappedRegion
+	blocks  [0x1000]*mappedRegion
+}
+
+type mappedRegion struct {
+	Region
+	chunk  MemoryChunk
+	size   int
+	device bool // devices are given the full address
+}
+
+func (r *mappedRegion) offset(address uint16) uint16 {
+	if r.device {
+		return address
+	}
+	return uint16((int(address) - int(r.Start)) % r.size)
+}
+
+// NewMappedMemory creates the chips for each region. ROMs are empty until
+// Init is called.
+func NewMappedMemory(regions []Region, cpu *CPU) *MappedMemory {
+	m := &MappedMemory{}
+	for _, r := range regions {
+		mr := &mappedRegion{Region: r, size: r.len()}
+		if r.Size > 0 {
+			mr.size = r.Size
+		}
+		switch r.Type {
+		case RegionRAM:
+			mr.chunk = NewRAM(mr.size)
+		case RegionROM:
+			mr.chunk = NullMemory{}
+		case RegionVIA:
+			mr.chunk = &viaChip{VIA: NewVIA(), cpu: cpu, line: interruptLine{IRQ: r.IRQ, NMI: r.NMI}}
+			mr.device = true
+		case RegionPIA:
+			mr.chunk = &piaChip{PIA: NewPIA(), cpu: cpu, line: interruptLine{IRQ: r.IRQ, NMI: r.NMI}}
+			mr.device = true
+		case RegionVICI:
+			mr.chunk = NewVICI(cpu)
+			mr.device = true
+		}
+		m.regions = append(m.regions, mr)
+		for b := int(r.Start) >> 4; b <= int(r.End)>>4; b++ {
+			m.blocks[b] = mr
+		}
+	}
+	return m
+}
+
+// Init loads the ROM files from the ROM path.
+func (m *MappedMemory) Init(romPath string) error {
+	for _, r := range m.regions {
+		if r.Type != RegionROM {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(romPath, r.File))
+		if err != nil {
+			return err
+		}
+		if r.Checksum != "" && fmt.Sprintf("%x", sha1.Sum(data)) != r.Checksum {
+			return fmt.Errorf("%v: invalid checksum", r.File)
+		}
+		if len(data) == 0 || len(data) > r.len() {
+			return fmt.Errorf("%v: invalid size for $%04x-$%04x", r.File, r.Start, r.End)
+		}
+		r.chunk = NewROM(data)
+		r.size = len(data)
+	}
+	return nil
+}
+
+// Reset clears the RAM and resets the chips.
+func (m *MappedMemory) Reset() {
+	for _, r := range m.regions {
+		switch chunk := r.chunk.(type) {
+		case *RAM:
+			r.chunk = NewRAM(r.size)
+		case interface{ Reset() }:
+			chunk.Reset()
+		}
+	}
+}
+
+func (m *MappedMemory) Load(address uint16) uint8 {
+	r := m.blocks[address>>4]
+	if r == nil {
+		return 0xff
+	}
+	return r.chunk.Load(r.offset(address))
+}
+
+func (m *MappedMemory) Peek(address uint16) uint8 {
+	r := m.blocks[address>>4]
+	if r == nil {
+		return 0xff
+	}
+	return peek(r.chunk, r.offset(address))
+}
+
+func (m *MappedMemory) Store(address uint16, value uint8) {
+	r := m.blocks[address>>4]
+	if r == nil {
+		return
+	}
+	r.chunk.Store(r.offset(address), value)
+}
+
+// Devices returns the chips that need to be serviced after each
+// instruction.
+func (m *MappedMemory) Devices() []Device {
+	devices := []Device{}
+	for _, r := range m.regions {
+		if d, ok := r.chunk.(Device); ok {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// chip returns the first chip of the type given.
+func (m *MappedMemory) chip(regionType string) MemoryChunk {
+	for _, r := range m.regions {
+		if r.Type == regionType {
+			return r.chunk
+		}
+	}
+	return nil
+}
+
+func (m *MappedMemory) state(s *stateCodec) {
+	for _, r := range m.regions {
+		switch chunk := r.chunk.(type) {
+		case *RAM:
+			s.fields(chunk.bytes)
+		case interface{ state(*stateCodec) }:
+			chunk.state(s)
+		}
+	}
+}
+
+// interruptLine connects the interrupt output of a chip to the IRQ or the
+// NMI input of the CPU.
+type interruptLine struct {
+	IRQ    bool
+	NMI    bool
+	active bool
+}
+
+func (l *interruptLine) set(cpu *CPU, active bool) {
+	if l.IRQ && active && cpu.acceptsIRQ() {
+		cpu.IRQ()
+	}
+	// NMI is edge triggered
+	if l.NMI && active && !l.active {
+		cpu.NMI()
+	}
+	l.active = active
+}
+
+// viaChip is a VIA clocked by the CPU.
+type viaChip struct {
+	*VIA
+	cpu    *CPU
+	line   interruptLine
+	cycles uint64
+}
+
+func (c *viaChip) Service() error {
+	c.VIA.Clock(int(c.cpu.Cycles - c.cycles))
+	c.cycles = c.cpu.Cycles
+	c.line.set(c.cpu, c.VIA.IRQ())
+	return nil
+}
+
+func (c *viaChip) state(s *stateCodec) {
+	c.VIA.state(s)
+	s.fields(&c.cycles, &c.line.active)
+}
+
+type piaChip struct {
+	*PIA
+	cpu  *CPU
+	line interruptLine
+}
+
+func (c *piaChip) Service() error {
+	c.line.set(c.cpu, c.PIA.IRQ())
+	return nil
+}
+
+func (c *piaChip) state(s *stateCodec) {
+	c.PIA.state(s)
+	s.fields(&c.line.active)
+}
@@ -11,19 +11,52 @@ type MemoryChunk interface {
 }
 
 type Memory struct {
-	Base MemoryChunk
+	Base    MemoryChunk
+	watches *Watches
 }
 
 func NewMemory(base MemoryChunk) *Memory {
 	return &Memory{Base: base}
 }
 
+// Peeker is implemented by chunks that change state when loaded, such as
+// chips that acknowledge interrupts when a register is read. Peek returns
+// what Load would without changing anything.
+type Peeker interface {
+	Peek(address uint16) uint8
+}
+
+// peek loads a value from the chunk without side effects.
+func peek(chunk MemoryChunk, address uint16) uint8 {
+	if p, ok := chunk.(Peeker); ok {
+		return p.Peek(address)
+	}
+	return chunk.Load(address)
+}
+
 func (m *Memory) Load(address uint16) uint8 {
-	return m.Base.Load(address)
+	value := m.Base.Load(address)
+	if w := m.watches; w != nil && w.active && w.types[address]&WatchRead != 0 {
+		w.load(address, value)
+	}
+	return value
 }
 
+// Store checks for watchpoints when the machine is running. The old value
+// is only needed for addresses watched for a change and is peeked so that
+// I/O registers are not disturbed.
 func (m *Memory) Store(address uint16, value uint8) {
+	w := m.watches
+	if w == nil || !w.active || w.types[address]&(WatchWrite|WatchChange) == 0 {
+		m.Base.Store(address, value)
+		return
+	}
+	old := value
+	if w.types[address]&WatchChange != 0 {
+		old = peek(m.Base, address)
+	}
 	m.Base.Store(address, value)
+	w.store(address, old, value)
 }
 
 func (m *Memory) StoreN(address uint16, values ...uint8) {
@@ -41,7 +74,7 @@ func (m *Memory) Load16(address uint16) uint16 {
 func (m *Memory) Load16Z(address uint8) uint16 {
 	lo := m.Load(uint16(address))
 	hi := m.Load(uint16(address + 1))
-	return uint16(hi<<8) + uint16(lo)
+	return uint16(hi)<<8 + uint16(lo)
 }
 
 func (m *Memory) Store16(address uint16, value uint16) {
@@ -100,10 +100,14 @@ type Memory64 struct {
 	Chunks [14]MemoryChunk
 	Game   bool // pin 8
 	ExROM  bool // pin 9
+	// StoreHook, if set, is called after each store for devices that
+	// watch the bus.
+	StoreHook func(address uint16, value uint8)
+	io        *IOMemory
 }
 
 func NewMemory64() *Memory64 {
-	m := &Memory64{}
+	m := &Memory64{io: NewIOMemory()}
 
 	m.Chunks[BasicROM] = NullMemory{}
 	m.Chunks[KernalROM] = NullMemory{}
@@ -125,10 +129,17 @@ func (m *Memory64) Reset() {
 	m.Chunks[RAM5] = NewRAM(0x1000) // $d000 - $dfff
 	m.Chunks[RAM6] = NewRAM(0x2000) // $e000 - $ffff
 
-	m.Chunks[IO] = NewRAM(0x1000) // $d000 - $dfff
+	m.io.Reset()
+	m.Chunks[IO] = m.io // $d000 - $dfff
 	m.SetMode(31)
 }
 
+// MapIO attaches a device to the I/O area from start to end. Devices are
+// mapped by page.
+func (m *Memory64) MapIO(start uint16, end uint16, device MemoryChunk) {
+	m.io.Map(start, end, device)
+}
+
 func (m *Memory64) Mode() uint8 {
 	mode := m.Chunks[RAM0].Load(AddrProcessorPort) & 0x7 // bits 0 - 2
 	if m.Game {
@@ -149,6 +160,18 @@ func (m *Memory64) SetMode(value uint8) uint8 {
 	return prev
 }
 
+func (m *Memory64) state(s *stateCodec) {
+	for chunk := RAM0; chunk <= RAM6; chunk++ {
+		s.fields(m.Chunks[chunk].(*RAM).bytes)
+	}
+	s.fields(m.io.ram.bytes, &m.Game, &m.ExROM)
+}
+
+// Mapped returns the chunk that is banked in at the address.
+func (m *Memory64) Mapped(address uint16) Chunk {
+	return modes[m.Mode()][zoneMap[address>>12]]
+}
+
 func (m *Memory64) Load(address uint16) uint8 {
 	zones := modes[m.Mode()]
 	zone := zoneMap[address>>12]
@@ -156,10 +179,21 @@ func (m *Memory64) Load(address uint16) uint8 {
 	return chunk.Load(address - addrZones[zone])
 }
 
+func (m *Memory64) Peek(address uint16) uint8 {
+	zones := modes[m.Mode()]
+	zone := zoneMap[address>>12]
+	chunk := m.Chunks[zones[zone]]
+	return peek(chunk, address-addrZones[zone])
+}
+
 func (m *Memory64) Store(address uint16, value uint8) {
 	zones := modes[m.Mode()]
 	zone := zoneMap[address>>12]
 	chunkIndex := zones[zone]
+	// Cartridges can have RAM where their ROM is mapped
+	if chunkIndex == CartLoROM || chunkIndex == CartHiROM {
+		m.Chunks[chunkIndex].Store(address-addrZones[zone], value)
+	}
 	// If a ROM chunk is mapped in, write the the RAM underneath
 	if chunkIndex >= BasicROM {
 		zones = modes[0]
@@ -167,6 +201,9 @@ func (m *Memory64) Store(address uint16, value uint8) {
 	}
 	chunk := m.Chunks[zones[zone]]
 	chunk.Store(address-addrZones[zone], value)
+	if m.StoreHook != nil {
+		m.StoreHook(address, value)
+	}
 }
 
 var roms = []struct {
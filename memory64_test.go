@@ -364,3 +364,23 @@ func TestMemoryStoreThroughROM(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryMapIO(t *testing.T) {
+	mem := NewMemory64()
+	sid := NewSID(SID8580)
+	mem.MapIO(0xd400, 0xd7ff, sid)
+	mem.Store(0xd412, ctrlGate)
+	if !sid.voices[2].envelope.gateActive {
+		t.Errorf("store not sent to device")
+	}
+	mem.Store(0xd800, 0xab) // color RAM
+	want := uint8(0xab)
+	have := mem.Load(0xd800)
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x \n", want, have)
+	}
+	mem.Reset()
+	if mem.Chunks[IO].Load(0x419) != 0xff {
+		t.Errorf("device not mapped after reset")
+	}
+}
@@ -16,6 +16,17 @@ func TestLoad16(t *testing.T) {
 	}
 }
 
+func TestLoad16Z(t *testing.T) {
+	m := NewMemory(NewRAM(0x10000))
+	m.Store(0xff, 0xcd)
+	m.Store(0x00, 0xab)
+	want := uint16(0xabcd)
+	have := m.Load16Z(0xff)
+	if want != have {
+		t.Errorf("\n want: %x \n have: %x \n", want, have)
+	}
+}
+
 func TestStore16(t *testing.T) {
 	m := NewMemory(NewRAM(0x10000))
 	m.Store16(0x00, 0xabcd)
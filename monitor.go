@@ -17,25 +17,47 @@ import (
 )
 
 const (
+	CmdAssemble            = "a"
 	CmdBreakpoint          = "b"
+	CmdBreakpointList      = "bl"
+	CmdBacktrace           = "bt"
 	CmdDisassemble         = "d"
+	CmdCartridge           = "cart"
+	CmdDisk                = "disk"
+	CmdEval                = "?"
 	CmdGo                  = "g"
+	CmdGoBack              = "gb"
 	CmdHalt                = "h"
+	CmdHistory             = "hist"
+	CmdInput               = "input"
 	CmdLoad                = "l"
 	CmdLoadProgram         = "lp"
 	CmdLoadBasic           = "lb"
 	CmdMemory              = "m"
 	CmdMemoryShifted       = "M"
 	CmdNext                = "n"
+	CmdPaste               = "paste"
 	CmdScreenMemory        = "sm"
 	CmdScreenMemoryShifted = "SM"
+	CmdSnapshot            = "snap"
 	CmdPokePeek            = "p"
 	CmdPokePeekWord        = "pw"
 	CmdStep                = "s"
+	CmdStepBack            = "sb"
+	CmdStepOut             = "out"
+	CmdStepOver            = "so"
+	CmdSymbol              = "sym"
 	CmdQuit                = "q"
 	CmdQuitLong            = "quit"
+	CmdRecord              = "rec"
 	CmdRegisters           = "r"
+	CmdREU                 = "reu"
+	CmdRewind              = "rw"
+	CmdTape                = "tape"
 	CmdTrace               = "t"
+	CmdType                = "type"
+	CmdUntil               = "until"
+	CmdWatch               = "w"
 	CmdZap                 = "z"
 )
 
@@ -56,6 +78,9 @@ type Monitor struct {
 	lastCmd      string
 	memPtr       uint16
 	dasmPtr      uint16
+	asmPtr       uint16
+	assembling   bool
+	expr         *Expr
 }
 
 func NewMonitor(mach *Mach85) *Monitor {
@@ -68,9 +93,13 @@ func NewMonitor(mach *Mach85) *Monitor {
 		out:          log.New(os.Stdout, "", 0),
 		Disassembler: NewDisassembler(mach.Memory),
 	}
+	mon.expr = NewExpr(mach.cpu, mach.Memory, mon.Disassembler.Lookup)
+	mach.Expr = mon.expr
 	mach.OnStop = func() {
 		mon.out.Println()
 		mon.registers([]string{})
+		mon.watchHits()
+		mon.breakpointCommands()
 		mon.rl.Refresh()
 	}
 	return mon
@@ -107,6 +136,10 @@ func (m *Monitor) Go() {
 }
 
 func (m *Monitor) parse(line string) {
+	if m.assembling {
+		m.assembleNext(line)
+		return
+	}
 	line = strings.TrimSpace(line)
 	if line == "" {
 		return
@@ -121,10 +154,22 @@ func (m *Monitor) parse(line string) {
 	args := fields[1:]
 	var err error
 	switch cmd {
+	case CmdAssemble:
+		err = m.assemble(args)
 	case CmdBreakpoint:
 		err = m.breakpoint(args)
+	case CmdBreakpointList:
+		err = m.breakpointList(args)
+	case CmdBacktrace:
+		err = m.backtrace(args)
 	case CmdDisassemble:
 		err = m.disassemble(args)
+	case CmdCartridge:
+		err = m.cartridge(args)
+	case CmdDisk:
+		err = m.disk(args)
+	case CmdEval:
+		err = m.eval(args)
 	case CmdLoad:
 		err = m.load(args)
 	case CmdLoadBasic:
@@ -133,8 +178,14 @@ func (m *Monitor) parse(line string) {
 		err = m.loadProgram(args, false)
 	case CmdGo:
 		err = m.goCmd(args)
+	case CmdGoBack:
+		err = m.goBack(args)
 	case CmdHalt:
 		err = m.halt(args)
+	case CmdHistory:
+		err = m.history(args)
+	case CmdInput:
+		err = m.input(args)
 	case CmdMemory:
 		err = m.memory(args, PetsciiUnshiftedDecoder)
 	case CmdMemoryShifted:
@@ -145,18 +196,44 @@ func (m *Monitor) parse(line string) {
 		err = m.memory(args, ScreenShiftedDecoder)
 	case CmdNext:
 		err = m.next(args)
+	case CmdPaste:
+		err = m.paste(args)
+	case CmdSnapshot:
+		err = m.snapshot(args)
 	case CmdStep:
 		err = m.step(args)
+	case CmdStepBack:
+		err = m.stepBack(args)
+	case CmdStepOut:
+		err = m.stepOut(args)
+	case CmdStepOver:
+		err = m.stepOver(args)
+	case CmdSymbol:
+		err = m.symbol(args)
 	case CmdPokePeek:
 		err = m.pokePeek(args)
 	case CmdPokePeekWord:
 		err = m.pokePeekWord(args)
 	case CmdQuit, CmdQuitLong:
 		os.Exit(0)
+	case CmdRecord:
+		err = m.record(args)
+	case CmdREU:
+		err = m.reu(args)
+	case CmdRewind:
+		err = m.rewind(args)
 	case CmdRegisters:
 		err = m.registers(args)
 	case CmdTrace:
 		err = m.trace(args)
+	case CmdTape:
+		err = m.tape(args)
+	case CmdType:
+		err = m.typeCmd(args)
+	case CmdUntil:
+		err = m.until(args)
+	case CmdWatch:
+		err = m.watch(args)
 	case CmdZap:
 		err = m.zap(args)
 	default:
@@ -169,33 +246,318 @@ func (m *Monitor) parse(line string) {
 	}
 }
 
+// assemble writes one instruction at the address, or starts reading
+// instructions one per line until a blank line is entered.
+func (m *Monitor) assemble(args []string) error {
+	if err := checkLen(args, 1, maxArgs); err != nil {
+		return err
+	}
+	address, err := m.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return m.assembleLine(address, strings.Join(args[1:], " "))
+	}
+	m.asmPtr = address
+	m.assembling = true
+	m.setPrompt(fmt.Sprintf("$%04x: ", m.asmPtr))
+	return nil
+}
+
+func (m *Monitor) assembleNext(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		m.assembling = false
+		m.setPrompt(m.Prompt)
+		return
+	}
+	if err := m.assembleLine(m.asmPtr, line); err != nil {
+		m.out.Println(err)
+	}
+	m.setPrompt(fmt.Sprintf("$%04x: ", m.asmPtr))
+}
+
+func (m *Monitor) assembleLine(address uint16, line string) error {
+	code, err := Assemble(address, line)
+	if err != nil {
+		return err
+	}
+	for i, value := range code {
+		if err := m.poke(address+uint16(i), value); err != nil {
+			return err
+		}
+	}
+	m.Disassembler.PC = address - 1
+	m.out.Println(m.Disassembler.Next())
+	m.asmPtr = address + uint16(len(code))
+	return nil
+}
+
+func (m *Monitor) setPrompt(prompt string) {
+	if m.rl != nil {
+		m.rl.SetPrompt(prompt)
+	}
+}
+
+// breakpoint shows, sets or removes a breakpoint and changes its settings:
+//
+//	b <addr> on|off|enable|disable
+//	b <addr> if <expr>
+//	b <addr> ignore <count>
+//	b <addr> do <cmd>; <cmd>
+//	b <addr> continue on|off
+//
+// Leaving out the value after if or do removes the condition or commands.
 func (m *Monitor) breakpoint(args []string) error {
-	if err := checkLen(args, 1, 2); err != nil {
+	if err := checkLen(args, 1, maxArgs); err != nil {
 		return err
 	}
-	address, err := parseAddress(args[0])
+	address, err := m.parseAddress(args[0])
 	if err != nil {
 		return err
 	}
+	b, exists := m.mach.Breakpoints[address]
 	if len(args) == 1 {
-		if !m.mach.Breakpoints[address] {
+		if !exists {
 			m.out.Println("breakpoint off")
 		} else {
-			m.out.Println("breakpoint on")
+			m.out.Println(b)
 		}
 		return nil
 	}
+	if !exists {
+		b = NewBreakpointInfo(address)
+	}
 	switch args[1] {
-	case "on":
-		m.mach.Breakpoints[address] = true
+	case "on", "off", "enable", "disable":
+		err = checkLen(args, 2, 2)
+	case "ignore", "continue":
+		err = checkLen(args, 3, 3)
+	}
+	if err != nil {
+		return err
+	}
+	rest := strings.Join(args[2:], " ")
+	switch args[1] {
+	case "on", "enable":
+		b.Enabled = true
 	case "off":
 		delete(m.mach.Breakpoints, address)
+		return nil
+	case "disable":
+		b.Enabled = false
+	case "if":
+		if rest != "" {
+			if err := m.expr.Check(rest); err != nil {
+				return err
+			}
+		}
+		b.Condition = rest
+	case "ignore":
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid count: %v", args[2])
+		}
+		b.Ignore = n
+		b.Hits = 0
+	case "do":
+		b.Commands = nil
+		for _, cmd := range strings.Split(rest, ";") {
+			if cmd = strings.TrimSpace(cmd); cmd != "" {
+				b.Commands = append(b.Commands, cmd)
+			}
+		}
+	case "continue":
+		switch args[2] {
+		case "on":
+			b.Continue = true
+		case "off":
+			b.Continue = false
+		default:
+			return fmt.Errorf("invalid: %v", args[2])
+		}
 	default:
 		return fmt.Errorf("invalid: %v", args[1])
 	}
+	m.mach.Breakpoints[address] = b
+	return nil
+}
+
+func (m *Monitor) breakpointList(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	list := m.mach.SortedBreakpoints()
+	if len(list) == 0 {
+		m.out.Println("no breakpoints")
+	}
+	for _, b := range list {
+		m.out.Println(b)
+	}
+	return nil
+}
+
+// breakpointCommands runs the commands of the breakpoint the machine
+// stopped at and starts it again if the breakpoint continues.
+func (m *Monitor) breakpointCommands() {
+	if m.mach.Status != Breakpoint || m.mach.Err != nil {
+		return
+	}
+	b, ok := m.mach.Breakpoints[m.cpu.PC+1]
+	if !ok {
+		return
+	}
+	for _, cmd := range b.Commands {
+		m.parse(cmd)
+	}
+	if b.Continue && m.mach.Status == Breakpoint {
+		m.mach.Start()
+	}
+}
+
+// watchHits prints the accesses that matched a watchpoint and reports if
+// there were any.
+func (m *Monitor) watchHits() bool {
+	hits := m.mach.Watches.Hits()
+	for _, hit := range hits {
+		m.out.Println(hit)
+	}
+	return len(hits) > 0
+}
+
+// watch lists the watchpoints, or adds or removes one:
+//
+//	w <start> [<end>] read|write|change
+//	w <start> off
+//
+// Types can be combined as in read,write.
+func (m *Monitor) watch(args []string) error {
+	if err := checkLen(args, 0, 3); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		list := m.mach.Watches.List()
+		if len(list) == 0 {
+			m.out.Println("no watchpoints")
+		}
+		for _, w := range list {
+			m.out.Println(w)
+		}
+		return nil
+	}
+	if err := checkLen(args, 2, 3); err != nil {
+		return err
+	}
+	start, err := m.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	end := start
+	if len(args) == 3 {
+		if end, err = m.parseAddress(args[1]); err != nil {
+			return err
+		}
+		if end < start {
+			return fmt.Errorf("invalid range: %v %v", args[0], args[1])
+		}
+	}
+	types := args[len(args)-1]
+	if types == "off" {
+		if len(args) > 2 {
+			return errors.New("too many arguments")
+		}
+		if !m.mach.Watches.Remove(start) {
+			return fmt.Errorf("no watchpoint at $%04x", start)
+		}
+		return nil
+	}
+	var t WatchType
+	for _, name := range strings.Split(types, ",") {
+		switch name {
+		case "read":
+			t |= WatchRead
+		case "write":
+			t |= WatchWrite
+		case "change":
+			t |= WatchChange
+		default:
+			return fmt.Errorf("invalid: %v", name)
+		}
+	}
+	m.mach.Watches.Add(start, end, t)
+	return nil
+}
+
+// backtrace shows the calls that led to the current instruction, the most
+// recent first. The call stack kept by the CPU is used when there is one.
+// Otherwise return addresses on the hardware stack that follow a jsr are
+// used, which finds subroutine calls but not interrupts.
+func (m *Monitor) backtrace(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	calls := m.cpu.Calls()
+	if len(calls) == 0 {
+		calls = m.stackCalls()
+		if len(calls) > 0 {
+			m.out.Println("no call history, from the stack:")
+		}
+	}
+	if len(calls) == 0 {
+		m.out.Println("no calls")
+	}
+	for i := range calls {
+		c := calls[len(calls)-1-i]
+		line := fmt.Sprintf("#%-2d $%04x %v $%04x", i, AddrStack+uint16(c.SP)+1, c.Type, c.To)
+		if name := m.Disassembler.Name(c.To); name != "" {
+			line += " " + name
+		}
+		line += fmt.Sprintf(" from $%04x", c.From)
+		if name := m.Disassembler.Name(c.From); name != "" {
+			line += " " + name
+		}
+		if comment := m.Disassembler.source.Comments[c.From]; comment != "" {
+			line += "  " + strings.Split(comment, "\n")[0]
+		}
+		m.out.Println(line)
+	}
 	return nil
 }
 
+// stackCalls finds the frames on the hardware stack. A return address
+// that comes after a jsr instruction is a subroutine call. Otherwise a
+// status register with the unused bit set, followed by a return address
+// that does not come after a jsr, is taken as an interrupt or a brk.
+func (m *Monitor) stackCalls() []Call {
+	var calls []Call
+	for sp := int(m.cpu.SP) + 1; sp < 0xff; sp++ {
+		ret := m.mem.Load16(AddrStack + uint16(sp))
+		if m.mem.Load(ret-2) == 0x20 { // jsr
+			call := Call{Type: CallJsr, From: ret - 2, To: m.mem.Load16(ret - 1), SP: uint8(sp - 1)}
+			calls = append([]Call{call}, calls...)
+			sp++
+			continue
+		}
+		if sp > 0xfd {
+			continue
+		}
+		sr := m.mem.Load(AddrStack + uint16(sp))
+		ret = m.mem.Load16(AddrStack + uint16(sp) + 1)
+		if sr&0x20 == 0 || m.mem.Load(ret-3) == 0x20 {
+			continue
+		}
+		// Unlike a jsr, the actual address to return to is pushed
+		call := Call{Type: CallIRQ, From: ret, To: m.mem.Load16(AddrIrqVector), SP: uint8(sp - 1)}
+		if sr&0x10 != 0 && m.mem.Load(ret-2) == 0x00 {
+			call.Type, call.From = CallBrk, ret-2
+		}
+		calls = append([]Call{call}, calls...)
+		sp += 2
+	}
+	return calls
+}
+
 func (m *Monitor) disassemble(args []string) error {
 	if err := checkLen(args, 0, 2); err != nil {
 		return err
@@ -207,7 +569,7 @@ func (m *Monitor) disassemble(args []string) error {
 		}
 	}
 	if len(args) > 0 {
-		addr, err := parseAddress(args[0])
+		addr, err := m.parseAddress(args[0])
 		if err != nil {
 			return err
 		}
@@ -215,7 +577,7 @@ func (m *Monitor) disassemble(args []string) error {
 	}
 	addrEnd := addrStart + uint16(dasmPageLen)
 	if len(args) > 1 {
-		addr, err := parseAddress(args[1])
+		addr, err := m.parseAddress(args[1])
 		if err != nil {
 			return err
 		}
@@ -228,6 +590,222 @@ func (m *Monitor) disassemble(args []string) error {
 	return nil
 }
 
+func (m *Monitor) cartridge(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	cart := m.mach.Cartridge()
+	if len(args) == 0 {
+		if cart != nil {
+			m.out.Println(cart)
+		} else {
+			m.out.Println("no cartridge attached")
+		}
+		return nil
+	}
+	switch args[0] {
+	case "off":
+		return m.mach.DetachCartridge()
+	case "freeze":
+		if cart == nil {
+			return errors.New("no cartridge attached")
+		}
+		return cart.Freeze()
+	}
+	return m.mach.AttachCartridge(args[0])
+}
+
+// eval prints the value of an expression in hex, decimal and binary.
+func (m *Monitor) eval(args []string) error {
+	if err := checkLen(args, 1, maxArgs); err != nil {
+		return err
+	}
+	value, err := m.expr.Eval(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	switch {
+	case value >= 0 && value <= 0xff:
+		m.out.Printf("$%02x %+d %%%08b\n", value, value, value)
+	case value >= -0x8000 && value <= 0xffff:
+		m.out.Printf("$%04x %+d %%%016b\n", uint16(value), value, uint16(value))
+	default:
+		m.out.Printf("$%x %+d %%%b\n", uint32(value), value, uint32(value))
+	}
+	return nil
+}
+
+func (m *Monitor) disk(args []string) error {
+	if err := checkLen(args, 0, 2); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		attached := false
+		for device := minDriveDevice; device <= maxDriveDevice; device++ {
+			if drive := m.mach.Drive(device); drive != nil {
+				m.out.Printf("%v: %v\n", device, drive)
+				attached = true
+			}
+			if drive := m.mach.TrueDrive(device); drive != nil {
+				m.out.Printf("%v: %v\n", device, drive)
+				attached = true
+			}
+		}
+		if !attached {
+			m.out.Println("no disks attached")
+		}
+		return nil
+	}
+	device := 8
+	if len(args) == 2 {
+		value, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid device: %v", args[0])
+		}
+		device = value
+	}
+	target := args[len(args)-1]
+	if target == "off" {
+		return m.mach.Detach(device)
+	}
+	return m.mach.AttachDisk(device, target)
+}
+
+func (m *Monitor) reu(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		if reu := m.mach.REU(); reu != nil {
+			m.out.Println(reu)
+		} else {
+			m.out.Println("no REU attached")
+		}
+		return nil
+	}
+	if args[0] == "off" {
+		return m.mach.DetachREU()
+	}
+	size, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid size: %v", args[0])
+	}
+	return m.mach.AttachREU(size)
+}
+
+func (m *Monitor) tape(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		if tape := m.mach.Tape(); tape != nil {
+			m.out.Println(tape)
+		} else {
+			m.out.Println("no tape attached")
+		}
+		return nil
+	}
+	switch args[0] {
+	case "off":
+		return m.mach.DetachTape()
+	case "play", "stop", "rewind":
+	default:
+		return m.mach.AttachTape(args[0])
+	}
+	tape := m.mach.Tape()
+	if tape == nil {
+		return errors.New("no tape attached")
+	}
+	switch args[0] {
+	case "play":
+		tape.Play()
+	case "stop":
+		tape.Stop()
+	case "rewind":
+		tape.Rewind()
+	}
+	return nil
+}
+
+func (m *Monitor) snapshot(args []string) error {
+	if err := checkLen(args, 2, 2); err != nil {
+		return err
+	}
+	if m.mach.Status == Run {
+		return errors.New("machine is running")
+	}
+	switch args[0] {
+	case "save":
+		return m.mach.SaveSnapshot(args[1])
+	case "load":
+		return m.mach.LoadSnapshot(args[1])
+	}
+	return fmt.Errorf("invalid snapshot command: %v", args[0])
+}
+
+// symbol loads a symbol file, or shows the address of a name or the name
+// of an address.
+func (m *Monitor) symbol(args []string) error {
+	if err := checkLen(args, 1, 2); err != nil {
+		return err
+	}
+	if args[0] == "load" {
+		if len(args) < 2 {
+			return errors.New("not enough arguments")
+		}
+		source, err := LoadSymbols(args[1])
+		if err != nil {
+			return err
+		}
+		m.Disassembler.LoadSource(source)
+		m.out.Printf("loaded %v symbols\n", len(source.Symbols))
+		return nil
+	}
+	if err := checkLen(args, 1, 1); err != nil {
+		return err
+	}
+	if address, ok := m.Disassembler.Lookup(args[0]); ok {
+		m.out.Printf("$%04x\n", address)
+		return nil
+	}
+	address, err := m.parseAddress(args[0])
+	if err != nil {
+		return fmt.Errorf("unknown symbol: %v", args[0])
+	}
+	name := m.Disassembler.Name(address)
+	if name == "" {
+		return fmt.Errorf("no symbol for $%04x", address)
+	}
+	m.out.Println(name)
+	return nil
+}
+
+func (m *Monitor) input(args []string) error {
+	if err := checkLen(args, 0, 2); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		m.out.Println(m.mach.InputStatus())
+		return nil
+	}
+	switch args[0] {
+	case "off":
+		if len(args) > 1 {
+			return errors.New("too many arguments")
+		}
+		return m.mach.StopInput()
+	case "rec", "play":
+		if len(args) < 2 {
+			return errors.New("not enough arguments")
+		}
+		if args[0] == "rec" {
+			return m.mach.RecordInput(args[1])
+		}
+		return m.mach.PlayInput(args[1])
+	}
+	return fmt.Errorf("invalid input command: %v", args[0])
+}
+
 func (m *Monitor) halt(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
@@ -240,7 +818,7 @@ func (m *Monitor) load(args []string) error {
 	if err := checkLen(args, 2, 2); err != nil {
 		return err
 	}
-	addr, err := parseAddress(args[0])
+	addr, err := m.parseAddress(args[0])
 	if err != nil {
 		return err
 	}
@@ -285,7 +863,7 @@ func (m *Monitor) memory(args []string, decoder Decoder) error {
 		}
 	}
 	if len(args) > 0 {
-		addr, err := parseAddress(args[0])
+		addr, err := m.parseAddress(args[0])
 		if err != nil {
 			return err
 		}
@@ -293,17 +871,40 @@ func (m *Monitor) memory(args []string, decoder Decoder) error {
 	}
 	addrEnd := addrStart + uint16(memPageLen)
 	if len(args) > 1 {
-		addr, err := parseAddress(args[1])
+		addr, err := m.parseAddress(args[1])
 		if err != nil {
 			return err
 		}
 		addrEnd = addr
 	}
-	m.out.Println(m.mem.Dump(addrStart, addrEnd, decoder))
+	m.out.Println(m.symbolDump(addrStart, addrEnd, decoder))
 	m.memPtr = addrEnd
 	return nil
 }
 
+// symbolDump adds the names of the symbols found in each row of a dump to
+// the end of the row.
+func (m *Monitor) symbolDump(start uint16, end uint16, decoder Decoder) string {
+	lines := strings.Split(m.mem.Dump(start, end, decoder), "\n")
+	row := int(start) / 0x10 * 0x10
+	for i := range lines {
+		var names []string
+		for addr := row; addr < row+0x10; addr++ {
+			if addr < int(start) || addr > int(end) {
+				continue
+			}
+			if name, ok := m.Disassembler.names[uint16(addr)]; ok {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			lines[i] += "  " + strings.Join(names, " ")
+		}
+		row += 0x10
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (m *Monitor) next(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
@@ -313,11 +914,22 @@ func (m *Monitor) next(args []string) error {
 	return nil
 }
 
+func (m *Monitor) paste(args []string) error {
+	if err := checkLen(args, 1, 1); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	return m.mach.Keyboard.Type(string(data))
+}
+
 func (m *Monitor) pokePeek(args []string) error {
 	if err := checkLen(args, 1, maxArgs); err != nil {
 		return err
 	}
-	address, err := parseAddress(args[0])
+	address, err := m.parseAddress(args[0])
 	if err != nil {
 		return err
 	}
@@ -330,14 +942,16 @@ func (m *Monitor) pokePeek(args []string) error {
 	// poke
 	values := []uint8{}
 	for _, str := range args[1:] {
-		v, err := parseValue(str)
+		v, err := m.parseValue(str)
 		if err != nil {
 			return err
 		}
 		values = append(values, v)
 	}
 	for offset, v := range values {
-		m.mem.Store(address+uint16(offset), v)
+		if err := m.poke(address+uint16(offset), v); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -346,7 +960,7 @@ func (m *Monitor) pokePeekWord(args []string) error {
 	if err := checkLen(args, 1, maxArgs); err != nil {
 		return err
 	}
-	address, err := parseAddress(args[0])
+	address, err := m.parseAddress(args[0])
 	if err != nil {
 		return err
 	}
@@ -359,32 +973,254 @@ func (m *Monitor) pokePeekWord(args []string) error {
 	// poke
 	values := []uint16{}
 	for _, str := range args[1:] {
-		v, err := parseValue16(str)
+		v, err := m.parseValue16(str)
 		if err != nil {
 			return err
 		}
 		values = append(values, v)
 	}
 	for offset, v := range values {
-		m.mem.Store16(address+uint16(offset), v)
+		a := address + uint16(offset)
+		if err := m.poke(a, uint8(v)); err != nil {
+			return err
+		}
+		if err := m.poke(a+1, uint8(v>>8)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// poke stores a value as input to the machine so that it can be recorded.
+func (m *Monitor) poke(address uint16, value uint8) error {
+	return m.mach.Input(InputEvent{Type: InputPoke, Address: address, Value: value})
+}
+
 func (m *Monitor) step(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count: %v", args[0])
+		}
+	}
+	for i := 0; i < n; i++ {
+		m.Disassembler.PC = m.cpu.PC
+		m.out.Println(m.Disassembler.Next())
+		if err := m.mach.Step(); err != nil {
+			return err
+		}
+		// Stop early at a watchpoint as when running
+		if m.watchHits() {
+			break
+		}
+	}
+	return nil
+}
+
+// stepOver runs a subroutine called with jsr until it returns. Other
+// instructions are stepped.
+func (m *Monitor) stepOver(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
+	if m.mach.Status == Run {
+		return errors.New("machine is running")
+	}
+	m.Disassembler.PC = m.cpu.PC
+	op := m.Disassembler.Next()
+	m.out.Println(op)
+	if op.Instruction != Jsr {
+		err := m.mach.Step()
+		m.watchHits()
+		return err
+	}
+	// Stop at the return address only at the same level so that a
+	// recursive call does not stop early. The stack pointer can wrap.
+	ret, sp := op.Address+3, m.cpu.SP
+	m.mach.RunUntil(func() bool {
+		return m.cpu.PC+1 == ret && int8(m.cpu.SP-sp) >= 0
+	})
+	return nil
+}
+
+// stepOut runs until an rts or rti returns from the current subroutine or
+// interrupt.
+func (m *Monitor) stepOut(args []string) error {
+	if err := checkLen(args, 0, 0); err != nil {
+		return err
+	}
+	if m.mach.Status == Run {
+		return errors.New("machine is running")
+	}
 	m.Disassembler.PC = m.cpu.PC
 	m.out.Println(m.Disassembler.Next())
-	m.cpu.Next()
+	sp := m.cpu.SP
+	returned := false
+	m.mach.RunUntil(func() bool {
+		if returned && int8(m.cpu.SP-sp) > 0 {
+			return true
+		}
+		opcode := m.mem.Load(m.cpu.PC + 1)
+		returned = opcode == 0x60 || opcode == 0x40 // rts, rti
+		return false
+	})
 	return nil
 }
 
-func (m *Monitor) registers(args []string) error {
+// until runs until the instruction at the address is reached.
+func (m *Monitor) until(args []string) error {
+	if err := checkLen(args, 1, 1); err != nil {
+		return err
+	}
+	if m.mach.Status == Run {
+		return errors.New("machine is running")
+	}
+	address, err := m.parseAddress(args[0])
+	if err != nil {
+		return err
+	}
+	m.Disassembler.PC = m.cpu.PC
+	m.out.Println(m.Disassembler.Next())
+	m.mach.RunUntil(func() bool {
+		return m.cpu.PC+1 == address
+	})
+	return nil
+}
+
+func (m *Monitor) stepBack(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count: %v", args[0])
+		}
+	}
+	if err := m.mach.StepBack(n); err != nil {
+		return err
+	}
+	m.Disassembler.PC = m.cpu.PC
+	m.out.Println(m.Disassembler.Next())
+	return nil
+}
+
+func (m *Monitor) goBack(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
 	}
+	found, err := m.mach.RunBack()
+	if err != nil {
+		return err
+	}
+	if !found {
+		m.out.Println("no breakpoint in history")
+	}
+	m.Disassembler.PC = m.cpu.PC
+	m.out.Println(m.Disassembler.Next())
+	return nil
+}
+
+func (m *Monitor) rewind(args []string) error {
+	if err := checkLen(args, 0, 2); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		if r := m.mach.Rewind(); r != nil {
+			m.out.Printf("rewind on, %v frames\n", r.Frames())
+		} else {
+			m.out.Println("rewind off")
+		}
+		return nil
+	}
+	switch args[0] {
+	case "on":
+		frames := defaultRewindFrames
+		if len(args) > 1 {
+			var err error
+			if frames, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid number of frames: %v", args[1])
+			}
+		}
+		return m.mach.EnableRewind(frames)
+	case "off":
+		return m.mach.DisableRewind()
+	}
+	if len(args) > 1 {
+		return errors.New("too many arguments")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid number of frames: %v", args[0])
+	}
+	if err := m.mach.RewindFrames(n); err != nil {
+		return err
+	}
+	m.Disassembler.PC = m.cpu.PC
+	m.out.Println(m.Disassembler.Next())
+	return nil
+}
+
+func (m *Monitor) history(args []string) error {
+	if err := checkLen(args, 0, 1); err != nil {
+		return err
+	}
+	r := m.mach.Rewind()
+	if r == nil {
+		return errors.New("rewind not enabled")
+	}
+	n := 16
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count: %v", args[0])
+		}
+	}
+	for _, address := range r.History(n) {
+		m.Disassembler.PC = address - 1
+		m.out.Println(m.Disassembler.Next())
+	}
+	return nil
+}
+
+func (m *Monitor) record(args []string) error {
+	if err := checkLen(args, 0, 2); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		if m.mach.Recording() {
+			m.out.Println("recording on")
+		} else {
+			m.out.Println("recording off")
+		}
+		return nil
+	}
+	if args[0] == "off" {
+		if len(args) > 1 {
+			return errors.New("too many arguments")
+		}
+		return m.mach.StopRecording()
+	}
+	sampleRate := 44100
+	if len(args) > 1 {
+		rate, err := strconv.Atoi(args[1])
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("invalid sample rate: %v", args[1])
+		}
+		sampleRate = rate
+	}
+	return m.mach.RecordSID(args[0], sampleRate)
+}
+
+func (m *Monitor) registers(args []string) error {
+	if len(args) > 0 {
+		return m.setRegisters(args)
+	}
 	reason := ""
 	if m.mach.Err != nil {
 		reason = fmt.Sprintf(": %v", m.mach.Err)
@@ -395,12 +1231,85 @@ func (m *Monitor) registers(args []string) error {
 	return nil
 }
 
+// setRegisters assigns registers and flags such as pc=c000 a=10 c=1. All
+// assignments are checked before any is made. The b flag cannot be set as
+// the machine takes it to mean that a brk is waiting to be handled.
+func (m *Monitor) setRegisters(args []string) error {
+	if m.mach.Status == Run {
+		return errors.New("machine is running")
+	}
+	var sets []func()
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return fmt.Errorf("invalid assignment: %v", arg)
+		}
+		name, expr := strings.ToLower(kv[0]), kv[1]
+		if name == "pc" {
+			address, err := m.parseAddress(expr)
+			if err != nil {
+				return err
+			}
+			sets = append(sets, func() { m.cpu.PC = address - 1 })
+			continue
+		}
+		value, err := m.parseValue(expr)
+		if err != nil {
+			return err
+		}
+		var reg *uint8
+		var flag *bool
+		switch name {
+		case "a":
+			reg = &m.cpu.A
+		case "x":
+			reg = &m.cpu.X
+		case "y":
+			reg = &m.cpu.Y
+		case "sp":
+			reg = &m.cpu.SP
+		case "sr":
+			sets = append(sets, func() { m.cpu.SetSR(value) })
+			continue
+		case "n":
+			flag = &m.cpu.N
+		case "v":
+			flag = &m.cpu.V
+		case "b":
+			return errors.New("b flag cannot be set")
+		case "d":
+			flag = &m.cpu.D
+		case "i":
+			flag = &m.cpu.I
+		case "z":
+			flag = &m.cpu.Z
+		case "c":
+			flag = &m.cpu.C
+		default:
+			return fmt.Errorf("invalid register: %v", name)
+		}
+		if reg != nil {
+			sets = append(sets, func() { *reg = value })
+			continue
+		}
+		if value > 1 {
+			return fmt.Errorf("invalid flag value: %v", expr)
+		}
+		sets = append(sets, func() { *flag = value == 1 })
+	}
+	for _, set := range sets {
+		set()
+	}
+	m.out.Println(m.cpu.String())
+	return nil
+}
+
 func (m *Monitor) goCmd(args []string) error {
 	if err := checkLen(args, 0, 1); err != nil {
 		return err
 	}
 	if len(args) > 0 {
-		address, err := parseAddress(args[0])
+		address, err := m.parseAddress(args[0])
 		if err != nil {
 			return err
 		}
@@ -433,6 +1342,16 @@ func (m *Monitor) trace(args []string) error {
 	return nil
 }
 
+func (m *Monitor) typeCmd(args []string) error {
+	if err := checkLen(args, 1, maxArgs); err != nil {
+		return err
+	}
+	// Arguments are split on single spaces so joining them back together
+	// restores the original text
+	text := unescape(strings.Join(args, " "))
+	return m.mach.Keyboard.Type(text)
+}
+
 func (m *Monitor) zap(args []string) error {
 	if err := checkLen(args, 0, 0); err != nil {
 		return err
@@ -471,6 +1390,28 @@ func checkLen(args []string, min int, max int) error {
 	return nil
 }
 
+// unescape replaces "\n" with a newline and "\\" with a backslash so that
+// RETURN can be entered on the command line.
+func unescape(str string) string {
+	var buf strings.Builder
+	escaped := false
+	for _, ch := range str {
+		switch {
+		case escaped && ch == 'n':
+			buf.WriteRune('\n')
+		case escaped:
+			buf.WriteRune(ch)
+		case ch == '\\':
+			escaped = true
+			continue
+		default:
+			buf.WriteRune(ch)
+		}
+		escaped = false
+	}
+	return buf.String()
+}
+
 func parseUint(str string, bitSize int) (uint64, error) {
 	base := 16
 	switch {
@@ -485,26 +1426,36 @@ func parseUint(str string, bitSize int) (uint64, error) {
 	return strconv.ParseUint(str, base, bitSize)
 }
 
-func parseAddress(str string) (uint16, error) {
-	value, err := parseUint(str, 16)
-	if err != nil {
+// parseAddress, parseValue and parseValue16 accept an expression. See
+// Expr for the syntax.
+func (m *Monitor) parseAddress(str string) (uint16, error) {
+	value, err := m.expr.Eval(str)
+	if err != nil || value < 0 || value > 0xffff {
 		return 0, fmt.Errorf("invalid address: %v", str)
 	}
 	return uint16(value), nil
 }
 
-func parseValue(str string) (uint8, error) {
-	value, err := parseUint(str, 8)
-	if err != nil {
+func (m *Monitor) parseValue(str string) (uint8, error) {
+	value, err := m.expr.Eval(str)
+	if err != nil || value < 0 || value > 0xff {
 		return 0, fmt.Errorf("invalid value: %v", str)
 	}
 	return uint8(value), nil
 }
 
-func parseValue16(str string) (uint16, error) {
-	value, err := parseUint(str, 16)
-	if err != nil {
+func (m *Monitor) parseValue16(str string) (uint16, error) {
+	value, err := m.expr.Eval(str)
+	if err != nil || value < 0 || value > 0xffff {
 		return 0, fmt.Errorf("invalid value: %v", str)
 	}
 	return uint16(value), nil
 }
+
+func parseValue(str string) (uint8, error) {
+	value, err := parseUint(str, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value: %v", str)
+	}
+	return uint8(value), nil
+}
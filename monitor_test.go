@@ -34,6 +34,24 @@ func testMonitorInput(s string) io.ReadCloser {
 	return ioutil.NopCloser(strings.NewReader(s))
 }
 
+// testMonitorParse runs the commands in order without reading input or
+// starting the machine, so all output has been written when it returns.
+func testMonitorParse(mon *Monitor, cmds string) {
+	for _, line := range strings.Split(cmds, "\n") {
+		mon.parse(line)
+	}
+}
+
+// testLines returns the first n lines of output.
+func testLines(t *testing.T, out *bytes.Buffer, n int) []string {
+	t.Helper()
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < n {
+		t.Fatalf("\n want: %v lines \n have: %q \n", n, out.String())
+	}
+	return lines[:n]
+}
+
 func TestBreakpointOn(t *testing.T) {
 	mon, _ := newTestMonitor()
 	mon.mach.Memory.StoreN(0x0800, 0xea, 0xea, 0xea) // nop
@@ -560,3 +578,122 @@ func TestTraceTooManyArguments(t *testing.T) {
 		t.Errorf("\n want: %v \n have: %v \n", want, have)
 	}
 }
+
+func TestType(t *testing.T) {
+	mon, _ := newTestMonitor()
+	testMonitorParse(mon, "type 10 print \"hi\"\\n\ng")
+	mon.mach.Start()
+	mon.mach.Run()
+	want := []uint8{
+		0x31, 0x30, 0x20, 0x50, 0x52, 0x49, 0x4e, 0x54, 0x20, 0x22, 0x48, 0x49,
+		0x22, 0x0d,
+	}
+	have := testDrainKeyboard(mon.mach)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %x \n have: %x \n", want, have)
+	}
+}
+
+func TestRecordNoSID(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "rec \n rec sound.wav")
+	want := []string{"recording off", "no SID"}
+	have := testLines(t, out, 2)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "disk \n disk 7 test.d64 \n disk 9 off")
+	want := []string{"no disks attached", "invalid device: 7", "no drive attached: 9"}
+	have := testLines(t, out, 3)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestTape(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "tape \n tape play \n tape off")
+	want := []string{"no tape attached", "no tape attached", "no tape attached"}
+	have := testLines(t, out, 3)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestCartridgeCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "cart \n cart freeze \n cart off")
+	want := []string{"no cartridge attached", "no cartridge attached", "no cartridge attached"}
+	have := testLines(t, out, 3)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestREUCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "reu \n reu 100 \n reu 256 \n reu")
+	want := []string{"no REU attached", "invalid REU size: 100K", "256K"}
+	have := testLines(t, out, 3)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestRegistersSet(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		want []string
+	}{
+		{"registers", "r pc=$c000 a=10 x=.a+1 y=+10 sp=f0", []string{
+			" pc  sr ac xr yr sp  n v - b d i z c",
+			"bfff 20 10 01 0a f0  . . * . . . . .",
+		}},
+		{"status", "r sr=$c3", []string{
+			" pc  sr ac xr yr sp  n v - b d i z c",
+			"07ff e3 00 00 00 00  * * * . . . * *",
+		}},
+		{"flags", "r N=1 d=1 c=1", []string{
+			" pc  sr ac xr yr sp  n v - b d i z c",
+			"07ff a9 00 00 00 00  * . * . * . . *",
+		}},
+		{"break flag", "r b=1", []string{"b flag cannot be set"}},
+		{"invalid register", "r a=10 q=1 \n r x=0", []string{
+			"invalid register: q",
+			" pc  sr ac xr yr sp  n v - b d i z c",
+			"07ff 20 00 00 00 00  . . * . . . . .",
+		}},
+		{"invalid flag", "r c=2", []string{"invalid flag value: 2"}},
+		{"invalid value", "r a=100", []string{"invalid value: 100"}},
+		{"invalid assignment", "r a", []string{"invalid assignment: a"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mon, out := newTestMonitor()
+			testMonitorParse(mon, test.cmd)
+			have := testLines(t, out, len(test.want))
+			if !reflect.DeepEqual(test.want, have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestRegistersSetRunning(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.mach.Status = Run
+	testMonitorParse(mon, "r a=10")
+	want := []string{"machine is running"}
+	have := testLines(t, out, 1)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+	if mon.cpu.A != 0 {
+		t.Errorf("\n want: %v \n have: %v \n", 0, mon.cpu.A)
+	}
+}
@@ -128,177 +128,178 @@ func (i Instruction) String() string {
 }
 
 type op struct {
-	inst Instruction
-	mode Mode
+	inst   Instruction
+	mode   Mode
+	cycles int // not including page crossing or branch penalties
 }
 
 var opcodes = map[uint8]op{
-	0x00: op{Brk, Implied},
-	0x01: op{Ora, IndirectX},
-	0x05: op{Ora, ZeroPage},
-	0x06: op{Asl, ZeroPage},
-	0x08: op{Php, Implied},
-	0x09: op{Ora, Immediate},
-	0x0a: op{Asl, Accumulator},
-	0x0d: op{Ora, Absolute},
-	0x0e: op{Asl, Absolute},
-
-	0x10: op{Bpl, Relative},
-	0x11: op{Ora, IndirectY},
-	0x15: op{Ora, ZeroPageX},
-	0x16: op{Asl, ZeroPageX},
-	0x18: op{Clc, Implied},
-	0x19: op{Ora, AbsoluteY},
-	0x1d: op{Ora, AbsoluteX},
-	0x1e: op{Asl, AbsoluteX},
-
-	0x20: op{Jsr, Absolute},
-	0x21: op{And, IndirectX},
-	0x24: op{Bit, ZeroPage},
-	0x25: op{And, ZeroPage},
-	0x26: op{Rol, ZeroPage},
-	0x28: op{Plp, Implied},
-	0x29: op{And, Immediate},
-	0x2a: op{Rol, Accumulator},
-	0x2c: op{Bit, Absolute},
-	0x2d: op{And, Absolute},
-	0x2e: op{Rol, Absolute},
-
-	0x30: op{Bmi, Relative},
-	0x31: op{And, IndirectY},
-	0x35: op{And, ZeroPageX},
-	0x36: op{Rol, ZeroPageX},
-	0x38: op{Sec, Implied},
-	0x39: op{And, AbsoluteY},
-	0x3d: op{And, AbsoluteX},
-	0x3e: op{Rol, AbsoluteX},
-
-	0x40: op{Rti, Implied},
-	0x41: op{Eor, IndirectX},
-	0x45: op{Eor, ZeroPage},
-	0x46: op{Lsr, ZeroPage},
-	0x48: op{Pha, Implied},
-	0x49: op{Eor, Immediate},
-	0x4a: op{Lsr, Accumulator},
-	0x4c: op{Jmp, Absolute},
-	0x4d: op{Eor, Absolute},
-	0x4e: op{Lsr, Absolute},
-
-	0x50: op{Bvc, Relative},
-	0x51: op{Eor, IndirectY},
-	0x55: op{Eor, ZeroPageX},
-	0x56: op{Lsr, ZeroPageX},
-	0x58: op{Cli, Implied},
-	0x59: op{Eor, AbsoluteY},
-	0x5d: op{Eor, AbsoluteX},
-	0x5e: op{Lsr, AbsoluteX},
-
-	0x60: op{Rts, Implied},
-	0x61: op{Adc, IndirectX},
-	0x65: op{Adc, ZeroPage},
-	0x66: op{Ror, ZeroPage},
-	0x68: op{Pla, Implied},
-	0x69: op{Adc, Immediate},
-	0x6a: op{Ror, Accumulator},
-	0x6c: op{Jmp, Indirect},
-	0x6d: op{Adc, Absolute},
-	0x6e: op{Ror, Absolute},
-
-	0x70: op{Bvs, Relative},
-	0x71: op{Adc, IndirectY},
-	0x75: op{Adc, ZeroPageX},
-	0x76: op{Ror, ZeroPageX},
-	0x78: op{Sei, Implied},
-	0x79: op{Adc, AbsoluteY},
-	0x7d: op{Adc, AbsoluteX},
-	0x7e: op{Ror, AbsoluteX},
-
-	0x81: op{Sta, IndirectX},
-	0x84: op{Sty, ZeroPage},
-	0x85: op{Sta, ZeroPage},
-	0x86: op{Stx, ZeroPage},
-	0x88: op{Dey, Implied},
-	0x8a: op{Txa, Implied},
-	0x8c: op{Sty, Absolute},
-	0x8d: op{Sta, Absolute},
-	0x8e: op{Stx, Absolute},
-
-	0x90: op{Bcc, Relative},
-	0x91: op{Sta, IndirectY},
-	0x94: op{Sty, ZeroPageX},
-	0x95: op{Sta, ZeroPageX},
-	0x96: op{Stx, ZeroPageY},
-	0x98: op{Tya, Implied},
-	0x99: op{Sta, AbsoluteY},
-	0x9a: op{Txs, Implied},
-	0x9d: op{Sta, AbsoluteX},
-
-	0xa0: op{Ldy, Immediate},
-	0xa1: op{Lda, IndirectX},
-	0xa2: op{Ldx, Immediate},
-	0xa4: op{Ldy, ZeroPage},
-	0xa5: op{Lda, ZeroPage},
-	0xa6: op{Ldx, ZeroPage},
-	0xa8: op{Tay, Implied},
-	0xa9: op{Lda, Immediate},
-	0xaa: op{Tax, Implied},
-	0xac: op{Ldy, Absolute},
-	0xad: op{Lda, Absolute},
-	0xae: op{Ldx, Absolute},
-
-	0xb0: op{Bcs, Relative},
-	0xb1: op{Lda, IndirectY},
-	0xb4: op{Ldy, ZeroPageX},
-	0xb5: op{Lda, ZeroPageX},
-	0xb6: op{Ldx, ZeroPageY},
-	0xb8: op{Clv, Implied},
-	0xb9: op{Lda, AbsoluteY},
-	0xba: op{Tsx, Implied},
-	0xbd: op{Lda, AbsoluteX},
-	0xbc: op{Ldy, AbsoluteX},
-	0xbe: op{Ldx, AbsoluteY},
-
-	0xc0: op{Cpy, Immediate},
-	0xc1: op{Cmp, IndirectX},
-	0xc4: op{Cpy, ZeroPage},
-	0xc5: op{Cmp, ZeroPage},
-	0xc6: op{Dec, ZeroPage},
-	0xc8: op{Iny, Implied},
-	0xc9: op{Cmp, Immediate},
-	0xca: op{Dex, Implied},
-	0xcc: op{Cpy, Absolute},
-	0xcd: op{Cmp, Absolute},
-	0xce: op{Dec, Absolute},
-
-	0xd0: op{Bne, Relative},
-	0xd1: op{Cmp, IndirectY},
-	0xd5: op{Cmp, ZeroPageX},
-	0xd6: op{Dec, ZeroPageX},
-	0xd8: op{Cld, Implied},
-	0xd9: op{Cmp, AbsoluteY},
-	0xdd: op{Cmp, AbsoluteX},
-	0xde: op{Dec, AbsoluteX},
-
-	0xe0: op{Cpx, Immediate},
-	0xe1: op{Sbc, IndirectX},
-	0xe4: op{Cpx, ZeroPage},
-	0xe5: op{Sbc, ZeroPage},
-	0xe6: op{Inc, ZeroPage},
-	0xe8: op{Inx, Implied},
-	0xe9: op{Sbc, Immediate},
-	0xea: op{Nop, Implied},
-	0xec: op{Cpx, Absolute},
-	0xed: op{Sbc, Absolute},
-	0xee: op{Inc, Absolute},
-
-	0xf0: op{Beq, Relative},
-	0xf1: op{Sbc, IndirectY},
-	0xf5: op{Sbc, ZeroPageX},
-	0xf6: op{Inc, ZeroPageX},
-	0xf8: op{Sed, Implied},
-	0xf9: op{Sbc, AbsoluteY},
-	0xfd: op{Sbc, AbsoluteX},
-	0xfe: op{Inc, AbsoluteX},
+	0x00: op{Brk, Implied, 7},
+	0x01: op{Ora, IndirectX, 6},
+	0x05: op{Ora, ZeroPage, 3},
+	0x06: op{Asl, ZeroPage, 5},
+	0x08: op{Php, Implied, 3},
+	0x09: op{Ora, Immediate, 2},
+	0x0a: op{Asl, Accumulator, 2},
+	0x0d: op{Ora, Absolute, 4},
+	0x0e: op{Asl, Absolute, 6},
+
+	0x10: op{Bpl, Relative, 2},
+	0x11: op{Ora, IndirectY, 5},
+	0x15: op{Ora, ZeroPageX, 4},
+	0x16: op{Asl, ZeroPageX, 6},
+	0x18: op{Clc, Implied, 2},
+	0x19: op{Ora, AbsoluteY, 4},
+	0x1d: op{Ora, AbsoluteX, 4},
+	0x1e: op{Asl, AbsoluteX, 7},
+
+	0x20: op{Jsr, Absolute, 6},
+	0x21: op{And, IndirectX, 6},
+	0x24: op{Bit, ZeroPage, 3},
+	0x25: op{And, ZeroPage, 3},
+	0x26: op{Rol, ZeroPage, 5},
+	0x28: op{Plp, Implied, 4},
+	0x29: op{And, Immediate, 2},
+	0x2a: op{Rol, Accumulator, 2},
+	0x2c: op{Bit, Absolute, 4},
+	0x2d: op{And, Absolute, 4},
+	0x2e: op{Rol, Absolute, 6},
+
+	0x30: op{Bmi, Relative, 2},
+	0x31: op{And, IndirectY, 5},
+	0x35: op{And, ZeroPageX, 4},
+	0x36: op{Rol, ZeroPageX, 6},
+	0x38: op{Sec, Implied, 2},
+	0x39: op{And, AbsoluteY, 4},
+	0x3d: op{And, AbsoluteX, 4},
+	0x3e: op{Rol, AbsoluteX, 7},
+
+	0x40: op{Rti, Implied, 6},
+	0x41: op{Eor, IndirectX, 6},
+	0x45: op{Eor, ZeroPage, 3},
+	0x46: op{Lsr, ZeroPage, 5},
+	0x48: op{Pha, Implied, 3},
+	0x49: op{Eor, Immediate, 2},
+	0x4a: op{Lsr, Accumulator, 2},
+	0x4c: op{Jmp, Absolute, 3},
+	0x4d: op{Eor, Absolute, 4},
+	0x4e: op{Lsr, Absolute, 6},
+
+	0x50: op{Bvc, Relative, 2},
+	0x51: op{Eor, IndirectY, 5},
+	0x55: op{Eor, ZeroPageX, 4},
+	0x56: op{Lsr, ZeroPageX, 6},
+	0x58: op{Cli, Implied, 2},
+	0x59: op{Eor, AbsoluteY, 4},
+	0x5d: op{Eor, AbsoluteX, 4},
+	0x5e: op{Lsr, AbsoluteX, 7},
+
+	0x60: op{Rts, Implied, 6},
+	0x61: op{Adc, IndirectX, 6},
+	0x65: op{Adc, ZeroPage, 3},
+	0x66: op{Ror, ZeroPage, 5},
+	0x68: op{Pla, Implied, 4},
+	0x69: op{Adc, Immediate, 2},
+	0x6a: op{Ror, Accumulator, 2},
+	0x6c: op{Jmp, Indirect, 5},
+	0x6d: op{Adc, Absolute, 4},
+	0x6e: op{Ror, Absolute, 6},
+
+	0x70: op{Bvs, Relative, 2},
+	0x71: op{Adc, IndirectY, 5},
+	0x75: op{Adc, ZeroPageX, 4},
+	0x76: op{Ror, ZeroPageX, 6},
+	0x78: op{Sei, Implied, 2},
+	0x79: op{Adc, AbsoluteY, 4},
+	0x7d: op{Adc, AbsoluteX, 4},
+	0x7e: op{Ror, AbsoluteX, 7},
+
+	0x81: op{Sta, IndirectX, 6},
+	0x84: op{Sty, ZeroPage, 3},
+	0x85: op{Sta, ZeroPage, 3},
+	0x86: op{Stx, ZeroPage, 3},
+	0x88: op{Dey, Implied, 2},
+	0x8a: op{Txa, Implied, 2},
+	0x8c: op{Sty, Absolute, 4},
+	0x8d: op{Sta, Absolute, 4},
+	0x8e: op{Stx, Absolute, 4},
+
+	0x90: op{Bcc, Relative, 2},
+	0x91: op{Sta, IndirectY, 6},
+	0x94: op{Sty, ZeroPageX, 4},
+	0x95: op{Sta, ZeroPageX, 4},
+	0x96: op{Stx, ZeroPageY, 4},
+	0x98: op{Tya, Implied, 2},
+	0x99: op{Sta, AbsoluteY, 5},
+	0x9a: op{Txs, Implied, 2},
+	0x9d: op{Sta, AbsoluteX, 5},
+
+	0xa0: op{Ldy, Immediate, 2},
+	0xa1: op{Lda, IndirectX, 6},
+	0xa2: op{Ldx, Immediate, 2},
+	0xa4: op{Ldy, ZeroPage, 3},
+	0xa5: op{Lda, ZeroPage, 3},
+	0xa6: op{Ldx, ZeroPage, 3},
+	0xa8: op{Tay, Implied, 2},
+	0xa9: op{Lda, Immediate, 2},
+	0xaa: op{Tax, Implied, 2},
+	0xac: op{Ldy, Absolute, 4},
+	0xad: op{Lda, Absolute, 4},
+	0xae: op{Ldx, Absolute, 4},
+
+	0xb0: op{Bcs, Relative, 2},
+	0xb1: op{Lda, IndirectY, 5},
+	0xb4: op{Ldy, ZeroPageX, 4},
+	0xb5: op{Lda, ZeroPageX, 4},
+	0xb6: op{Ldx, ZeroPageY, 4},
+	0xb8: op{Clv, Implied, 2},
+	0xb9: op{Lda, AbsoluteY, 4},
+	0xba: op{Tsx, Implied, 2},
+	0xbd: op{Lda, AbsoluteX, 4},
+	0xbc: op{Ldy, AbsoluteX, 4},
+	0xbe: op{Ldx, AbsoluteY, 4},
+
+	0xc0: op{Cpy, Immediate, 2},
+	0xc1: op{Cmp, IndirectX, 6},
+	0xc4: op{Cpy, ZeroPage, 3},
+	0xc5: op{Cmp, ZeroPage, 3},
+	0xc6: op{Dec, ZeroPage, 5},
+	0xc8: op{Iny, Implied, 2},
+	0xc9: op{Cmp, Immediate, 2},
+	0xca: op{Dex, Implied, 2},
+	0xcc: op{Cpy, Absolute, 4},
+	0xcd: op{Cmp, Absolute, 4},
+	0xce: op{Dec, Absolute, 6},
+
+	0xd0: op{Bne, Relative, 2},
+	0xd1: op{Cmp, IndirectY, 5},
+	0xd5: op{Cmp, ZeroPageX, 4},
+	0xd6: op{Dec, ZeroPageX, 6},
+	0xd8: op{Cld, Implied, 2},
+	0xd9: op{Cmp, AbsoluteY, 4},
+	0xdd: op{Cmp, AbsoluteX, 4},
+	0xde: op{Dec, AbsoluteX, 7},
+
+	0xe0: op{Cpx, Immediate, 2},
+	0xe1: op{Sbc, IndirectX, 6},
+	0xe4: op{Cpx, ZeroPage, 3},
+	0xe5: op{Sbc, ZeroPage, 3},
+	0xe6: op{Inc, ZeroPage, 5},
+	0xe8: op{Inx, Implied, 2},
+	0xe9: op{Sbc, Immediate, 2},
+	0xea: op{Nop, Implied, 2},
+	0xec: op{Cpx, Absolute, 4},
+	0xed: op{Sbc, Absolute, 4},
+	0xee: op{Inc, Absolute, 6},
+
+	0xf0: op{Beq, Relative, 2},
+	0xf1: op{Sbc, IndirectY, 5},
+	0xf5: op{Sbc, ZeroPageX, 4},
+	0xf6: op{Inc, ZeroPageX, 6},
+	0xf8: op{Sed, Implied, 2},
+	0xf9: op{Sbc, AbsoluteY, 4},
+	0xfd: op{Sbc, AbsoluteX, 4},
+	0xfe: op{Inc, AbsoluteX, 7},
 }
 
 var executors = map[uint8]func(c *CPU){
@@ -362,7 +363,7 @@ var executors = map[uint8]func(c *CPU){
 	0x5d: func(c *CPU) { eor(c, c.loadAbsoluteX) },
 	0x5e: func(c *CPU) { lsr(c, c.loadAbsoluteX) },
 
-	0x60: func(c *CPU) { c.PC = c.pull16() }, // rts
+	0x60: func(c *CPU) { c.PC = c.pull16(); c.unwind() }, // rts
 	0x61: func(c *CPU) { adc(c, c.loadIndirectX) },
 	0x65: func(c *CPU) { adc(c, c.loadZeroPage) },
 	0x66: func(c *CPU) { ror(c, c.loadZeroPage) },
@@ -399,7 +400,7 @@ var executors = map[uint8]func(c *CPU){
 	0x96: func(c *CPU) { stx(c, c.storeZeroPageY) },
 	0x98: func(c *CPU) { transfer(c, c.Y, &c.A) },
 	0x99: func(c *CPU) { sta(c, c.storeAbsoluteY) },
-	0x9a: func(c *CPU) { c.SP = c.X }, // txs
+	0x9a: func(c *CPU) { c.SP = c.X; c.unwind() }, // txs
 	0x9d: func(c *CPU) { sta(c, c.storeAbsoluteX) },
 
 	0xa0: func(c *CPU) { ldy(c, c.loadImmediate) },
@@ -0,0 +1,142 @@
+package mach85
+
+// http://archive.6502.org/datasheets/mos_6520.pdf
+
+// PIA registers. The data direction register is selected in place of the
+// port when bit 2 of the control register is clear.
+const (
+	piaPortA = iota
+	piaCRA
+	piaPortB
+	piaCRB
+)
+
+// PIA control register bits
+const (
+	piaIRQ1Enable = 0x01
+	piaIRQ1Edge   = 0x02
+	piaPortSelect = 0x04
+	piaIRQ1       = 0x80
+)
+
+// PIA is the MOS Technology 6520 Peripheral Interface Adapter used in the
+// PET. The ports are connected in the same way as the VIA. Only the
+// interrupts from CA1 and CB1 are emulated.
+type PIA struct {
+	ReadA  func() uint8
+	ReadB  func() uint8
+	WriteA func(uint8)
+	WriteB func(uint8)
+
+	ora  uint8
+	orb  uint8
+	ddra uint8
+	ddrb uint8
+	cra  uint8
+	crb  uint8
+	ca1  bool
+	cb1  bool
+}
+
+func NewPIA() *PIA {
+	return &PIA{}
+}
+
+func (p *PIA) Reset() {
+	*p = PIA{ReadA: p.ReadA, ReadB: p.ReadB, WriteA: p.WriteA, WriteB: p.WriteB}
+}
+
+func (p *PIA) Load(address uint16) uint8 {
+	switch address & 0x3 {
+	case piaPortA:
+		if p.cra&piaPortSelect == 0 {
+			return p.ddra
+		}
+		p.cra &^= piaIRQ1
+		in := uint8(0xff)
+		if p.ReadA != nil {
+			in = p.ReadA()
+		}
+		return p.ora&p.ddra | in&^p.ddra
+	case piaCRA:
+		return p.cra
+	case piaPortB:
+		if p.crb&piaPortSelect == 0 {
+			return p.ddrb
+		}
+		p.crb &^= piaIRQ1
+		in := uint8(0xff)
+		if p.ReadB != nil {
+			in = p.ReadB()
+		}
+		return p.orb&p.ddrb | in&^p.ddrb
+	}
+	return p.crb // piaCRB
+}
+
+// Peek reads a register without clearing the interrupt flags.
+func (p *PIA) Peek(address uint16) uint8 {
+	cra, crb := p.cra, p.crb
+	value := p.Load(address)
+	p.cra, p.crb = cra, crb
+	return value
+}
+
+func (p *PIA) Store(address uint16, value uint8) {
+	switch address & 0x3 {
+	case piaPortA:
+		if p.cra&piaPortSelect == 0 {
+			p.ddra = value
+		} else {
+			p.ora = value
+		}
+		if p.WriteA != nil {
+			p.WriteA(p.ora&p.ddra | ^p.ddra)
+		}
+	case piaCRA:
+		p.cra = p.cra&piaIRQ1 | value&0x3f
+	case piaPortB:
+		if p.crb&piaPortSelect == 0 {
+			p.ddrb = value
+		} else {
+			p.orb = value
+		}
+		if p.WriteB != nil {
+			p.WriteB(p.orb&p.ddrb | ^p.ddrb)
+		}
+	case piaCRB:
+		p.crb = p.crb&piaIRQ1 | value&0x3f
+	}
+}
+
+// SetCA1 sets the level of the CA1 input. The interrupt flag is set on
+// the edge selected in the control register.
+func (p *PIA) SetCA1(level bool) {
+	p.cra = p.edge(p.cra, p.ca1, level)
+	p.ca1 = level
+}
+
+// SetCB1 sets the level of the CB1 input, which is connected to the
+// vertical retrace on the PET.
+func (p *PIA) SetCB1(level bool) {
+	p.crb = p.edge(p.crb, p.cb1, level)
+	p.cb1 = level
+}
+
+func (p *PIA) edge(cr uint8, prev bool, level bool) uint8 {
+	positive := cr&piaIRQ1Edge != 0
+	if level != prev && level == positive {
+		cr |= piaIRQ1
+	}
+	return cr
+}
+
+// IRQ returns true if an enabled interrupt is pending.
+func (p *PIA) IRQ() bool {
+	return p.cra&(piaIRQ1|piaIRQ1Enable) == piaIRQ1|piaIRQ1Enable ||
+		p.crb&(piaIRQ1|piaIRQ1Enable) == piaIRQ1|piaIRQ1Enable
+}
+
+func (p *PIA) state(s *stateCodec) {
+	s.fields(&p.ora, &p.orb, &p.ddra, &p.ddrb, &p.cra, &p.crb, &p.ca1, &p.cb1)
+}
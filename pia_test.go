@@ -0,0 +1,47 @@
+package mach85
+
+import "testing"
+
+func TestPIAPorts(t *testing.T) {
+	p := NewPIA()
+	var out uint8
+	p.ReadB = func() uint8 { return 0x81 }
+	p.WriteB = func(value uint8) { out = value }
+	p.Store(piaPortB, 0x0f) // ddrb
+	p.Store(piaCRB, piaPortSelect)
+	p.Store(piaPortB, 0x0a)
+	if out != 0xfa {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0xfa, out)
+	}
+	if have := p.Load(piaPortB); have != 0x8a {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x8a, have)
+	}
+}
+
+func TestPIAInterrupt(t *testing.T) {
+	tests := []struct {
+		name  string
+		cr    uint8
+		level bool
+		want  bool
+	}{
+		{"negative edge", piaIRQ1Enable, false, true},
+		{"positive edge", piaIRQ1Enable | piaIRQ1Edge, false, false},
+		{"disabled", 0, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPIA()
+			p.SetCB1(true)
+			p.Store(piaCRB, test.cr|piaPortSelect)
+			p.SetCB1(test.level)
+			if have := p.IRQ(); have != test.want {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+			p.Load(piaPortB)
+			if p.IRQ() {
+				t.Errorf("interrupt not cleared by reading the port")
+			}
+		})
+	}
+}
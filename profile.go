@@ -0,0 +1,215 @@
+package mach85
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile describes a machine that can be built around the CPU. The C64
+// has no regions and uses Memory64 with all of its devices. Other
+// machines are put together from the regions in the memory map.
+type Profile struct {
+	Name    string   `json:"name"`
+	Regions []Region `json:"regions"`
+	// Video is "vic-ii", "pet", "vic-i" or empty for no display.
+	Video string `json:"video"`
+	// CharROM is the file with the character shapes for the PET video,
+	// which are not visible to the CPU.
+	CharROM  string         `json:"charROM"`
+	Keyboard *KeyboardAddrs `json:"keyboard"`
+	Jiffy    bool           `json:"jiffy"` // 60 Hz interrupt
+}
+
+// Region types
+const (
+	RegionRAM  = "ram"
+	RegionROM  = "rom"
+	RegionVIA  = "via"
+	RegionPIA  = "pia"
+	RegionVICI = "vic-i"
+)
+
+// Region is a range of the address space. Regions must start and end on
+// a 16 byte boundary. RAM and ROM smaller than the range given by Size
+// are mirrored through the range.
+type Region struct {
+	Type     string  `json:"type"`
+	Start    hexAddr `json:"start"`
+	End      hexAddr `json:"end"`
+	Size     int     `json:"size"`
+	File     string  `json:"file"`
+	Checksum string  `json:"checksum"` // SHA-1 of the ROM file
+	IRQ      bool    `json:"irq"`
+	NMI      bool    `json:"nmi"`
+}
+
+// KeyboardAddrs are the locations in the KERNAL work area used to give
+// keys to the machine.
+type KeyboardAddrs struct {
+	Buffer    hexAddr `json:"buffer"`
+	BufferLen hexAddr `json:"bufferLen"`
+	StopKey   hexAddr `json:"stopKey"`
+}
+
+// hexAddr is an address written as a hex string such as "$c000" in a
+// profile.
+type hexAddr uint16
+
+func (h *hexAddr) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid address: %s", data)
+	}
+	value, err := strconv.ParseUint(strings.TrimPrefix(s, "$"), 16, 16)
+	if err != nil {
+		return fmt.Errorf("invalid address: %v", s)
+	}
+	*h = hexAddr(value)
+	return nil
+}
+
+var Profiles = map[string]*Profile{
+	"c64": {
+		Name:     "c64",
+		Video:    "vic-ii",
+		Keyboard: &c64Keyboard,
+		Jiffy:    true,
+	},
+	"pet": {
+		Name: "pet",
+		Regions: []Region{
+			{Type: RegionRAM, Start: 0x0000, End: 0x1fff},
+			{Type: RegionRAM, Start: 0x8000, End: 0x8fff, Size: 0x400},
+			{Type: RegionROM, Start: 0xc000, End: 0xdfff, File: "pet/basic2.rom"},
+			{Type: RegionROM, Start: 0xe000, End: 0xe7ff, File: "pet/edit2.rom"},
+			{Type: RegionPIA, Start: 0xe810, End: 0xe81f},
+			{Type: RegionPIA, Start: 0xe820, End: 0xe82f},
+			{Type: RegionVIA, Start: 0xe840, End: 0xe84f},
+			{Type: RegionROM, Start: 0xf000, End: 0xffff, File: "pet/kernal2.rom"},
+		},
+		Video:    "pet",
+		CharROM:  "pet/chargen.rom",
+		Keyboard: &KeyboardAddrs{Buffer: 0x026f, BufferLen: 0x9e, StopKey: 0x9b},
+		Jiffy:    true,
+	},
+	"vic20": {
+		Name: "vic20",
+		Regions: []Region{
+			{Type: RegionRAM, Start: 0x0000, End: 0x03ff},
+			{Type: RegionRAM, Start: 0x1000, End: 0x1fff},
+			{Type: RegionROM, Start: 0x8000, End: 0x8fff, File: "vic20/chargen.rom"},
+			{Type: RegionVICI, Start: 0x9000, End: 0x900f},
+			{Type: RegionVIA, Start: 0x9110, End: 0x911f, NMI: true},
+			{Type: RegionVIA, Start: 0x9120, End: 0x912f, IRQ: true},
+			{Type: RegionRAM, Start: 0x9400, End: 0x97ff},
+			{Type: RegionROM, Start: 0xc000, End: 0xdfff, File: "vic20/basic.rom"},
+			{Type: RegionROM, Start: 0xe000, End: 0xffff, File: "vic20/kernal.rom"},
+		},
+		Video:    "vic-i",
+		Keyboard: &c64Keyboard,
+	},
+	"6502": {
+		Name: "6502",
+		Regions: []Region{
+			{Type: RegionRAM, Start: 0x0000, End: 0xffff},
+		},
+	},
+}
+
+var c64Keyboard = KeyboardAddrs{
+	Buffer:    hexAddr(AddrKeyboardBuffer),
+	BufferLen: hexAddr(AddrKeyboardBufferLen),
+	StopKey:   hexAddr(AddrStopKey),
+}
+
+// LookupProfile returns the built-in profile with the name given or loads
+// the profile from a file.
+func LookupProfile(name string) (*Profile, error) {
+	if p, ok := Profiles[name]; ok {
+		return p, nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		names := []string{}
+		for n := range Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown machine %v, expected one of %v or a file",
+			name, strings.Join(names, ", "))
+	}
+	return LoadProfile(name)
+}
+
+// LoadProfile reads a profile from a JSON file.
+func LoadProfile(filename string) (*Profile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return p, nil
+}
+
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	if len(p.Regions) == 0 {
+		return fmt.Errorf("profile has no regions")
+	}
+	switch p.Video {
+	case "", "pet", "vic-i":
+	default:
+		return fmt.Errorf("invalid video: %v", p.Video)
+	}
+	if p.Video == "pet" && p.CharROM == "" {
+		return fmt.Errorf("pet video needs a charROM")
+	}
+	var used [0x1000]bool
+	for _, r := range p.Regions {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("region $%04x: %v", r.Start, err)
+		}
+		for b := int(r.Start) >> 4; b <= int(r.End)>>4; b++ {
+			if used[b] {
+				return fmt.Errorf("region $%04x: overlaps $%04x", r.Start, b<<4)
+			}
+			used[b] = true
+		}
+	}
+	return nil
+}
+
+func (r Region) validate() error {
+	if r.Start&0xf != 0 || r.End&0xf != 0xf || r.End < r.Start {
+		return fmt.Errorf("invalid range $%04x-$%04x", r.Start, r.End)
+	}
+	switch r.Type {
+	case RegionRAM, RegionVIA, RegionPIA, RegionVICI:
+	case RegionROM:
+		if r.File == "" {
+			return fmt.Errorf("rom has no file")
+		}
+	default:
+		return fmt.Errorf("invalid type: %v", r.Type)
+	}
+	if r.Size < 0 || r.Size > r.len() {
+		return fmt.Errorf("invalid size: %v", r.Size)
+	}
+	return nil
+}
+
+func (r Region) len() int {
+	return int(r.End) - int(r.Start) + 1
+}
@@ -0,0 +1,253 @@
+package mach85
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{"ok", `{"name": "sbc", "regions": [
+			{"type": "ram", "start": "$0000", "end": "$7fff"},
+			{"type": "via", "start": "$8000", "end": "$800f", "irq": true},
+			{"type": "rom", "start": "$e000", "end": "$ffff", "file": "sbc.rom"}
+		]}`, ""},
+		{"no name", `{"regions": [{"type": "ram", "start": "$0000", "end": "$ffff"}]}`,
+			"profile has no name"},
+		{"no regions", `{"name": "sbc"}`, "profile has no regions"},
+		{"address", `{"name": "sbc", "regions": [{"type": "ram", "start": "$xyz", "end": "$ffff"}]}`,
+			"invalid address: $xyz"},
+		{"range", `{"name": "sbc", "regions": [{"type": "ram", "start": "$0001", "end": "$ffff"}]}`,
+			"region $0001: invalid range $0001-$ffff"},
+		{"type", `{"name": "sbc", "regions": [{"type": "sid", "start": "$d400", "end": "$d7ff"}]}`,
+			"region $d400: invalid type: sid"},
+		{"rom", `{"name": "sbc", "regions": [{"type": "rom", "start": "$e000", "end": "$ffff"}]}`,
+			"region $e000: rom has no file"},
+		{"overlap", `{"name": "sbc", "regions": [
+			{"type": "ram", "start": "$0000", "end": "$7fff"},
+			{"type": "via", "start": "$7ff0", "end": "$7fff"}
+		]}`, "region $7ff0: overlaps $7ff0"},
+		{"video", `{"name": "sbc", "video": "vic-ii", "regions": [{"type": "ram", "start": "$0000", "end": "$ffff"}]}`,
+			"invalid video: vic-ii"},
+	}
+	dir, err := ioutil.TempDir("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, "profile.json")
+			if err := ioutil.WriteFile(file, []uint8(test.json), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadProfile(file)
+			have := ""
+			if err != nil {
+				have = err.Error()
+			}
+			want := ""
+			if test.err != "" {
+				want = file + ": " + test.err
+			}
+			if want != have {
+				t.Errorf("\n want: %v \n have: %v \n", want, have)
+			}
+		})
+	}
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	for name, p := range Profiles {
+		t.Run(name, func(t *testing.T) {
+			if p.Name != name {
+				t.Errorf("\n want: %v \n have: %v \n", name, p.Name)
+			}
+			if p.Regions == nil {
+				return
+			}
+			if err := p.validate(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMappedMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.rom"), []uint8{0xaa, 0xbb}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMappedMemory([]Region{
+		{Type: RegionRAM, Start: 0x0000, End: 0x0fff},
+		{Type: RegionRAM, Start: 0x8000, End: 0x8fff, Size: 0x400},
+		{Type: RegionVICI, Start: 0x9000, End: 0x900f},
+		{Type: RegionROM, Start: 0xf000, End: 0xffff, File: "test.rom"},
+	}, New6510(nil))
+	if err := mem.Init(dir); err != nil {
+		t.Fatal(err)
+	}
+	mem.Store(0x0010, 0x11)
+	mem.Store(0x8001, 0x22)
+	mem.Store(0x9005, 0x33)
+	mem.Store(0xf000, 0x44)
+	tests := []struct {
+		name    string
+		address uint16
+		want    uint8
+	}{
+		{"ram", 0x0010, 0x11},
+		{"mirror", 0x8c01, 0x22},
+		{"device", 0x9005, 0x33},
+		{"rom", 0xf000, 0xaa},
+		{"rom mirror", 0xfff1, 0xbb},
+		{"open", 0x4000, 0xff},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			have := mem.Load(test.address)
+			if test.want != have {
+				t.Errorf("\n want: %02x \n have: %02x \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestMappedVIAInterrupt(t *testing.T) {
+	mach, err := NewMachine(&Profile{
+		Name: "sbc",
+		Regions: []Region{
+			{Type: RegionRAM, Start: 0x0000, End: 0x7fff},
+			{Type: RegionVIA, Start: 0x8000, End: 0x800f, IRQ: true},
+			{Type: RegionRAM, Start: 0xf000, End: 0xffff},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mach.Memory.StoreN(0x0200,
+		0xa9, 0xc0, // lda #$c0
+		0x8d, 0x0e, 0x80, // sta $800e ; enable timer 1 interrupt
+		0xa9, 0x10, // lda #$10
+		0x8d, 0x04, 0x80, // sta $8004
+		0x8d, 0x05, 0x80, // sta $8005 ; start timer 1
+		0x58,             // cli
+		0x4c, 0x0e, 0x02, // jmp $020e
+	)
+	mach.Memory.StoreN(0x0300, 0xe8, 0x40) // inx, rti
+	mach.Memory.Store16(AddrIrqVector, 0x0300)
+	mach.cpu.PC = 0x0200 - 1
+	for i := 0; i < 2000; i++ {
+		if err := mach.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if mach.cpu.X > 0 {
+			return
+		}
+	}
+	t.Errorf("expected interrupt from VIA")
+}
+
+// The handler takes longer than the timer period and acknowledges the
+// interrupt last, as the VIC-20 KERNAL does with the VIA at $9120.
+func TestMappedVIAInterruptNotNested(t *testing.T) {
+	mach, err := NewMachine(&Profile{
+		Name: "sbc",
+		Regions: []Region{
+			{Type: RegionRAM, Start: 0x0000, End: 0x7fff},
+			{Type: RegionVIA, Start: 0x9120, End: 0x912f, IRQ: true},
+			{Type: RegionRAM, Start: 0xf000, End: 0xffff},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mach.Memory.StoreN(0x0200,
+		0xa9, 0xc0, // lda #$c0
+		0x8d, 0x2e, 0x91, // sta $912e ; enable timer 1 interrupt
+		0xa9, 0x10, // lda #$10
+		0x8d, 0x24, 0x91, // sta $9124
+		0xa9, 0x00, // lda #$00
+		0x8d, 0x25, 0x91, // sta $9125 ; start timer 1
+		0x58,             // cli
+		0x4c, 0x10, 0x02, // jmp $0210
+	)
+	mach.Memory.StoreN(0x0300,
+		0xea, 0xea, 0xea, 0xea, 0xea, // nop
+		0xe8,             // inx
+		0x8d, 0x25, 0x91, // sta $9125 ; acknowledge and restart
+		0x40, // rti
+	)
+	mach.Memory.Store16(AddrIrqVector, 0x0300)
+	mach.cpu.PC = 0x0200 - 1
+	mach.cpu.SP = 0xff
+	for i := 0; i < 2000; i++ {
+		if err := mach.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if mach.cpu.SP < 0xfc {
+			t.Fatalf("interrupts nested: sp $%02x", mach.cpu.SP)
+		}
+	}
+	if mach.cpu.X < 2 {
+		t.Errorf("\n want: >= 2 \n have: %v \n", mach.cpu.X)
+	}
+}
+
+func TestC64Only(t *testing.T) {
+	mach, err := NewMachine(Profiles["6502"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		err  func() error
+		want string
+	}{
+		{"cart", func() error { return mach.AttachCartridge("x.crt") }, "not available on the 6502"},
+		{"reu", func() error { return mach.AttachREU(128) }, "not available on the 6502"},
+		{"tape", func() error { return mach.AttachTape("x.t64") }, "not available on the 6502"},
+		{"disk", func() error { return mach.AttachDisk(8, "x.d64") }, "not available on the 6502"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.err()
+			if err == nil || err.Error() != test.want {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, err)
+			}
+		})
+	}
+}
+
+func TestProfileSnapshot(t *testing.T) {
+	sbc, err := NewMachine(Profiles["6502"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbc.Memory.Store(0xd000, 0x42)
+	data, err := sbc.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewMachine(Profiles["6502"])
+	if err := other.restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if have := other.Memory.Load(0xd000); have != 0x42 {
+		t.Errorf("\n want: %v \n have: %v \n", 0x42, have)
+	}
+	want := "snapshot is for the 6502"
+	if err := New().restore(data); err == nil || err.Error() != want {
+		t.Errorf("\n want: %v \n have: %v \n", want, err)
+	}
+}
@@ -0,0 +1,332 @@
+package mach85
+
+// https://www.hvsc.c64.org/download/C64Music/DOCUMENTS/SID_file_format.txt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+type psidHeader struct {
+	MagicID     [4]byte
+	Version     uint16
+	DataOffset  uint16
+	LoadAddress uint16
+	InitAddress uint16
+	PlayAddress uint16
+	Songs       uint16
+	StartSong   uint16
+	Speed       uint32
+	Name        [32]byte
+	Author      [32]byte
+	Released    [32]byte
+}
+
+// PSID flags found in version 2 and later
+const (
+	psidClockPAL  = 1 << 2
+	psidClockNTSC = 1 << 3
+	psidSID6581   = 1 << 4
+	psidSID8580   = 1 << 5
+)
+
+// PSID is a tune in the PSID or RSID file format.
+type PSID struct {
+	Type        string
+	Version     int
+	LoadAddress uint16
+	InitAddress uint16
+	PlayAddress uint16
+	Songs       int
+	StartSong   int
+	Speed       uint32
+	Name        string
+	Author      string
+	Released    string
+	Flags       uint16
+	Data        []uint8
+}
+
+func LoadPSID(filename string) (*PSID, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePSID(data)
+}
+
+func ParsePSID(data []uint8) (*PSID, error) {
+	var h psidHeader
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &h); err != nil {
+		return nil, errors.New("invalid PSID header")
+	}
+	magic := string(h.MagicID[:])
+	if magic != "PSID" && magic != "RSID" {
+		return nil, errors.New("not a PSID or RSID file")
+	}
+	if int(h.DataOffset) > len(data) {
+		return nil, errors.New("invalid data offset")
+	}
+	t := &PSID{
+		Type:        magic,
+		Version:     int(h.Version),
+		LoadAddress: h.LoadAddress,
+		InitAddress: h.InitAddress,
+		PlayAddress: h.PlayAddress,
+		Songs:       int(h.Songs),
+		StartSong:   int(h.StartSong),
+		Speed:       h.Speed,
+		Name:        psidString(h.Name),
+		Author:      psidString(h.Author),
+		Released:    psidString(h.Released),
+		Data:        data[h.DataOffset:],
+	}
+	if t.Version >= 2 && len(data) >= 0x78 {
+		t.Flags = binary.BigEndian.Uint16(data[0x76:])
+	}
+	// A load address of zero means the address is in the first two bytes
+	// of the data, as in a PRG file
+	if t.LoadAddress == 0 {
+		if len(t.Data) < 2 {
+			return nil, errors.New("missing load address")
+		}
+		t.LoadAddress = uint16(t.Data[0]) | uint16(t.Data[1])<<8
+		t.Data = t.Data[2:]
+	}
+	if t.InitAddress == 0 {
+		t.InitAddress = t.LoadAddress
+	}
+	if t.StartSong == 0 {
+		t.StartSong = 1
+	}
+	return t, nil
+}
+
+func psidString(b [32]byte) string {
+	return string(bytes.TrimRight(b[:], "\x00"))
+}
+
+// CIATimer returns true if the song is timed by CIA #1 instead of the
+// vertical blank.
+func (t *PSID) CIATimer(song int) bool {
+	bit := uint(song - 1)
+	if bit > 31 {
+		bit = 31
+	}
+	return t.Speed&(1<<bit) != 0
+}
+
+// PAL returns true if the tune was written for a PAL machine.
+func (t *PSID) PAL() bool {
+	return t.Flags&psidClockNTSC == 0 || t.Flags&psidClockPAL != 0
+}
+
+// Model returns the SID model the tune was written for.
+func (t *PSID) Model() SIDModel {
+	if t.Flags&psidSID8580 != 0 && t.Flags&psidSID6581 == 0 {
+		return SID8580
+	}
+	return SID6581
+}
+
+const (
+	playerReturn    = uint16(0xfff0) // sentinel return address
+	playerMaxInit   = 10000000       // cycles
+	frameCyclesPAL  = 312 * 63
+	frameCyclesNTSC = 263 * 65
+	// Default CIA timer values set by the KERNAL for 60 Hz
+	timerPAL  = 0x4025
+	timerNTSC = 0x4295
+)
+
+// SIDPlayer plays a tune by calling its play routine once per frame on a
+// machine that has only RAM, the I/O area and a SID.
+type SIDPlayer struct {
+	Tune        *PSID
+	SID         *SID
+	Song        int
+	cpu         *CPU
+	mem         *Memory
+	mem64       *Memory64
+	frameCycles int
+	irq         bool
+}
+
+func NewSIDPlayer(tune *PSID, model SIDModel) *SIDPlayer {
+	mem64 := NewMemory64()
+	mem := NewMemory(mem64)
+	sid := NewSID(model)
+	if tune.PAL() {
+		sid.ClockRate = ClockRatePAL
+	}
+	mem64.MapIO(0xd400, 0xd7ff, sid)
+	return &SIDPlayer{
+		Tune:  tune,
+		SID:   sid,
+		cpu:   New6510(mem),
+		mem:   mem,
+		mem64: mem64,
+	}
+}
+
+// Init loads the tune and calls the init routine for the song, numbered
+// starting at one.
+func (p *SIDPlayer) Init(song int) error {
+	if song < 1 || song > p.Tune.Songs {
+		return fmt.Errorf("invalid song: %v", song)
+	}
+	p.Song = song
+	p.mem64.Reset()
+	p.SID.Reset()
+	p.mem64.SetMode(29) // RAM everywhere except for I/O
+	p.mem.Import(p.Tune.LoadAddress, p.Tune.Data)
+	p.installKernalReturn()
+
+	p.cpu.SetSR(0)
+	p.cpu.B = false
+	p.cpu.I = true
+	p.cpu.A = uint8(song - 1)
+	p.cpu.X = 0
+	p.cpu.Y = 0
+	p.irq = false
+	if err := p.call(p.Tune.InitAddress, playerMaxInit); err != nil {
+		return fmt.Errorf("init: %v", err)
+	}
+
+	p.irq = p.Tune.PlayAddress == 0
+	p.frameCycles = p.defaultFrameCycles()
+	if p.Tune.CIATimer(song) {
+		if timer := p.mem.Load16(0xdc04); timer != 0 {
+			p.frameCycles = int(timer) + 1
+		}
+	}
+	return nil
+}
+
+func (p *SIDPlayer) defaultFrameCycles() int {
+	pal := p.Tune.PAL()
+	switch {
+	case p.Tune.CIATimer(p.Song) && pal:
+		return timerPAL + 1
+	case p.Tune.CIATimer(p.Song):
+		return timerNTSC + 1
+	case pal:
+		return frameCyclesPAL
+	}
+	return frameCyclesNTSC
+}
+
+// Tunes that install an interrupt handler at $0314 end it by jumping back
+// into the KERNAL which restores the registers. Provide the end of that
+// routine if it doesn't overlap the tune.
+func (p *SIDPlayer) installKernalReturn() {
+	end := int(p.Tune.LoadAddress) + len(p.Tune.Data)
+	if end > 0xea31 && int(p.Tune.LoadAddress) < 0xea87 {
+		return
+	}
+	restore := []uint8{
+		0x68, // pla
+		0xa8, // tay
+		0x68, // pla
+		0xaa, // tax
+		0x68, // pla
+		0x40, // rti
+	}
+	p.mem.Import(0xea31, restore)
+	p.mem.Import(0xea81, restore)
+}
+
+// Frame calls the play routine and then runs the SID for the rest of the
+// frame. Samples generated are appended to out.
+func (p *SIDPlayer) Frame(out []int16) ([]int16, error) {
+	start := p.cpu.Cycles
+	var err error
+	if p.irq {
+		out, err = p.interrupt(out)
+	} else {
+		out, err = p.callFrame(p.Tune.PlayAddress, false, out)
+	}
+	if err != nil {
+		return out, fmt.Errorf("play: %v", err)
+	}
+	elapsed := int(p.cpu.Cycles - start)
+	if elapsed < p.frameCycles {
+		out = p.SID.Step(p.frameCycles-elapsed, out)
+	}
+	return out, nil
+}
+
+// interrupt runs the handler installed by the init routine, either
+// through the KERNAL vector at $0314 or the hardware vector at $fffe.
+func (p *SIDPlayer) interrupt(out []int16) ([]int16, error) {
+	vector := p.mem.Load16(0x0314)
+	kernal := vector != 0
+	if !kernal {
+		vector = p.mem.Load16(AddrIrqVector)
+	}
+	if vector == 0 {
+		return out, errors.New("no play address or interrupt handler")
+	}
+	return p.callFrame(vector, kernal, out)
+}
+
+func (p *SIDPlayer) callFrame(address uint16, kernal bool, out []int16) ([]int16, error) {
+	p.pushReturn(address, kernal)
+	for i := 0; i < p.frameCycles; {
+		before := p.cpu.Cycles
+		if err := p.cpu.Next(); err != nil {
+			return out, err
+		}
+		if p.cpu.B {
+			return out, fmt.Errorf("break at $%04x", p.cpu.PC)
+		}
+		cycles := int(p.cpu.Cycles - before)
+		out = p.SID.Step(cycles, out)
+		i += cycles
+		if p.cpu.PC == playerReturn {
+			return out, nil
+		}
+	}
+	return out, errors.New("did not return within a frame")
+}
+
+func (p *SIDPlayer) call(address uint16, maxCycles int) error {
+	p.pushReturn(address, false)
+	start := p.cpu.Cycles
+	for int(p.cpu.Cycles-start) < maxCycles {
+		if err := p.cpu.Next(); err != nil {
+			return err
+		}
+		if p.cpu.B {
+			return fmt.Errorf("break at $%04x", p.cpu.PC)
+		}
+		if p.cpu.PC == playerReturn {
+			return nil
+		}
+	}
+	return errors.New("did not return")
+}
+
+// pushReturn sets up the stack so that the routine at the address returns
+// to the sentinel address. Interrupt handlers are entered with the return
+// address and status on the stack, plus the registers when entered through
+// the KERNAL.
+func (p *SIDPlayer) pushReturn(address uint16, kernal bool) {
+	p.cpu.SP = 0xff
+	if p.irq {
+		// Unlike RTS, RTI returns to the actual address on the stack
+		p.cpu.push16(playerReturn + 1)
+		p.cpu.push(p.cpu.SR())
+		if kernal {
+			p.cpu.push(p.cpu.A)
+			p.cpu.push(p.cpu.X)
+			p.cpu.push(p.cpu.Y)
+		}
+	} else {
+		p.cpu.push16(playerReturn)
+	}
+	p.cpu.PC = address - 1
+}
@@ -0,0 +1,164 @@
+package mach85
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func testPSID(load, init, play uint16, flags uint16, code []uint8) []uint8 {
+	data := make([]uint8, 0x7c)
+	copy(data, "PSID")
+	binary.BigEndian.PutUint16(data[0x04:], 2)    // version
+	binary.BigEndian.PutUint16(data[0x06:], 0x7c) // data offset
+	binary.BigEndian.PutUint16(data[0x08:], load)
+	binary.BigEndian.PutUint16(data[0x0a:], init)
+	binary.BigEndian.PutUint16(data[0x0c:], play)
+	binary.BigEndian.PutUint16(data[0x0e:], 2) // songs
+	binary.BigEndian.PutUint16(data[0x10:], 2) // start song
+	copy(data[0x16:], "Test Tune")
+	copy(data[0x36:], "Nobody")
+	copy(data[0x56:], "2018")
+	binary.BigEndian.PutUint16(data[0x76:], flags)
+	return append(data, code...)
+}
+
+var testPSIDCode = []uint8{
+	0x8d, 0x01, 0x20, // $1000: sta $2001 ; song number
+	0xa9, 0x0f, //       $1003: lda #$0f
+	0x8d, 0x18, 0xd4, // $1005: sta $d418 ; volume
+	0x60,             // $1008: rts
+	0xee, 0x00, 0x20, // $1009: inc $2000 ; play
+	0x60, //             $100c: rts
+}
+
+func TestParsePSID(t *testing.T) {
+	tune, err := ParsePSID(testPSID(0x1000, 0x1000, 0x1009, psidClockNTSC|psidSID8580, testPSIDCode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PSID{
+		Type:        "PSID",
+		Version:     2,
+		LoadAddress: 0x1000,
+		InitAddress: 0x1000,
+		PlayAddress: 0x1009,
+		Songs:       2,
+		StartSong:   2,
+		Name:        "Test Tune",
+		Author:      "Nobody",
+		Released:    "2018",
+		Flags:       psidClockNTSC | psidSID8580,
+	}
+	have := *tune
+	have.Data = nil
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %+v \n have: %+v \n", want, have)
+	}
+	if tune.PAL() {
+		t.Errorf("expected NTSC")
+	}
+	if tune.Model() != SID8580 {
+		t.Errorf("\n want: %v \n have: %v \n", SID8580, tune.Model())
+	}
+}
+
+func TestParsePSIDLoadAddressInData(t *testing.T) {
+	code := append([]uint8{0x00, 0x10}, testPSIDCode...)
+	tune, err := ParsePSID(testPSID(0, 0, 0x1009, 0, code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tune.LoadAddress != 0x1000 || tune.InitAddress != 0x1000 {
+		t.Errorf("\n want: $1000 $1000 \n have: $%04x $%04x \n", tune.LoadAddress, tune.InitAddress)
+	}
+	if len(tune.Data) != len(testPSIDCode) {
+		t.Errorf("\n want: %v \n have: %v \n", len(testPSIDCode), len(tune.Data))
+	}
+}
+
+func TestParsePSIDInvalid(t *testing.T) {
+	data := testPSID(0x1000, 0x1000, 0x1009, 0, testPSIDCode)
+	copy(data, "XSID")
+	_, err := ParsePSID(data)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	want := "not a PSID or RSID file"
+	if err.Error() != want {
+		t.Errorf("\n want: %v \n have: %v \n", want, err)
+	}
+}
+
+func TestSIDPlayer(t *testing.T) {
+	tune, err := ParsePSID(testPSID(0x1000, 0x1000, 0x1009, 0, testPSIDCode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := NewSIDPlayer(tune, tune.Model())
+	if err := player.Init(2); err != nil {
+		t.Fatal(err)
+	}
+	if song := player.mem.Load(0x2001); song != 1 {
+		t.Errorf("\n want: %v \n have: %v \n", 1, song)
+	}
+	var samples []int16
+	for i := 0; i < 50; i++ {
+		samples, err = player.Frame(samples)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := player.mem.Load(0x2000); calls != 50 {
+		t.Errorf("\n want: %v \n have: %v \n", 50, calls)
+	}
+	// One second on a PAL machine
+	want := 50 * frameCyclesPAL * player.SID.SampleRate / ClockRatePAL
+	if have := len(samples); have < want-1 || have > want+1 {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestSIDPlayerInterrupt(t *testing.T) {
+	code := []uint8{
+		0xa9, 0x0b, //       $1000: lda #$0b
+		0x8d, 0x14, 0x03, // $1002: sta $0314
+		0xa9, 0x10, //       $1005: lda #$10
+		0x8d, 0x15, 0x03, // $1007: sta $0315
+		0x60,             // $100a: rts
+		0xee, 0x00, 0x20, // $100b: inc $2000
+		0x4c, 0x31, 0xea, // $100e: jmp $ea31
+	}
+	tune, err := ParsePSID(testPSID(0x1000, 0x1000, 0, 0, code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := NewSIDPlayer(tune, tune.Model())
+	if err := player.Init(1); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := player.Frame(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := player.mem.Load(0x2000); calls != 3 {
+		t.Errorf("\n want: %v \n have: %v \n", 3, calls)
+	}
+}
+
+func TestSIDPlayerInitBreak(t *testing.T) {
+	tune, err := ParsePSID(testPSID(0x1000, 0x1000, 0x1009, 0, []uint8{0x00, 0x00}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := NewSIDPlayer(tune, tune.Model())
+	err = player.Init(1)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	want := "init: break at $1001"
+	if err.Error() != want {
+		t.Errorf("\n want: %v \n have: %v \n", want, err)
+	}
+}
@@ -0,0 +1,320 @@
+package mach85
+
+import (
+	"errors"
+	"fmt"
+)
+
+// http://codebase64.org/doku.php?id=base:reu_registers
+
+// REU registers
+const (
+	reuStatus = iota
+	reuCommand
+	reuC64Lo
+	reuC64Hi
+	reuREULo
+	reuREUHi
+	reuREUBank
+	reuLengthLo
+	reuLengthHi
+	reuIntMask
+	reuAddrControl
+)
+
+// REU status and interrupt mask bits
+const (
+	reuIntPending  = 0x80
+	reuEndOfBlock  = 0x40
+	reuVerifyError = 0x20
+	reuChips256K   = 0x10
+)
+
+// REU command bits
+const (
+	reuExecute  = 0x80
+	reuAutoload = 0x20
+	reuNoFF00   = 0x10
+)
+
+// REU transfer types
+const (
+	reuStash = iota
+	reuFetch
+	reuSwap
+	reuVerify
+)
+
+// REU address control bits
+const (
+	reuFixC64 = 0x80
+	reuFixREU = 0x40
+)
+
+const reuTrigger = uint16(0xff00)
+
+// REU is a RAM Expansion Unit. The DMA controller copies memory between
+// the computer and the expansion RAM while the CPU is halted, so each
+// byte transferred adds a cycle to the CPU.
+type REU struct {
+	Size int
+	ram  []uint8
+	mem  *Memory
+	cpu  *CPU
+
+	status    uint8
+	command   uint8
+	c64       uint16
+	reu       uint32
+	length    uint16
+	mask      uint8
+	control   uint8
+	c64Load   uint16 // values reloaded by autoload
+	reuLoad   uint32
+	lengthLen uint16
+	armed     bool // waiting for a write to $ff00
+}
+
+// NewREU creates an REU with the size given in kilobytes. The 1700 has
+// 128K, the 1764 has 256K and the 1750 has 512K. Larger sizes up to 16M
+// are also accepted.
+func NewREU(size int, mem *Memory, cpu *CPU) (*REU, error) {
+	if size < 128 || size > 16384 || size&(size-1) != 0 {
+		return nil, fmt.Errorf("invalid REU size: %vK", size)
+	}
+	r := &REU{
+		Size: size,
+		ram:  make([]uint8, size*1024),
+		mem:  mem,
+		cpu:  cpu,
+	}
+	r.Reset()
+	return r, nil
+}
+
+func (r *REU) Reset() {
+	r.status = 0
+	if r.Size > 128 {
+		r.status = reuChips256K
+	}
+	r.command = reuNoFF00
+	r.c64, r.c64Load = 0, 0
+	r.reu, r.reuLoad = 0, 0
+	r.length, r.lengthLen = 0xffff, 0xffff
+	r.mask = 0
+	r.control = 0
+	r.armed = false
+}
+
+func (r *REU) Load(address uint16) uint8 {
+	switch address & 0x1f {
+	case reuStatus:
+		value := r.status
+		r.status &^= reuIntPending | reuEndOfBlock | reuVerifyError
+		return value
+	case reuCommand:
+		return r.command
+	case reuC64Lo:
+		return uint8(r.c64)
+	case reuC64Hi:
+		return uint8(r.c64 >> 8)
+	case reuREULo:
+		return uint8(r.reu)
+	case reuREUHi:
+		return uint8(r.reu >> 8)
+	case reuREUBank:
+		// Unused bits read as set
+		return uint8(r.reu>>16) | 0xf8
+	case reuLengthLo:
+		return uint8(r.length)
+	case reuLengthHi:
+		return uint8(r.length >> 8)
+	case reuIntMask:
+		return r.mask | 0x1f
+	case reuAddrControl:
+		return r.control | 0x3f
+	}
+	return 0xff
+}
+
+// Peek reads a register without clearing the status.
+func (r *REU) Peek(address uint16) uint8 {
+	status := r.status
+	value := r.Load(address)
+	r.status = status
+	return value
+}
+
+func (r *REU) Store(address uint16, value uint8) {
+	switch address & 0x1f {
+	case reuCommand:
+		r.command = value
+		if value&reuExecute != 0 {
+			if value&reuNoFF00 != 0 {
+				r.execute()
+			} else {
+				r.armed = true
+			}
+		}
+	case reuC64Lo:
+		r.c64Load = r.c64Load&0xff00 | uint16(value)
+		r.c64 = r.c64Load
+	case reuC64Hi:
+		r.c64Load = r.c64Load&0x00ff | uint16(value)<<8
+		r.c64 = r.c64Load
+	case reuREULo:
+		r.reuLoad = r.reuLoad&0xffff00 | uint32(value)
+		r.reu = r.reuLoad
+	case reuREUHi:
+		r.reuLoad = r.reuLoad&0xff00ff | uint32(value)<<8
+		r.reu = r.reuLoad
+	case reuREUBank:
+		r.reuLoad = r.reuLoad&0x00ffff | uint32(value)<<16
+		r.reu = r.reuLoad
+	case reuLengthLo:
+		r.lengthLen = r.lengthLen&0xff00 | uint16(value)
+		r.length = r.lengthLen
+	case reuLengthHi:
+		r.lengthLen = r.lengthLen&0x00ff | uint16(value)<<8
+		r.length = r.lengthLen
+	case reuIntMask:
+		r.mask = value & 0xe0
+	case reuAddrControl:
+		r.control = value & 0xc0
+	}
+}
+
+// storeHook starts an armed transfer when $ff00 is written.
+func (r *REU) storeHook(address uint16, value uint8) {
+	if r.armed && address == reuTrigger {
+		r.execute()
+	}
+}
+
+func (r *REU) execute() {
+	r.armed = false
+	r.command = r.command&^reuExecute | reuNoFF00
+	mode := r.command & 0x03
+	n := int(r.length)
+	if n == 0 {
+		n = 0x10000
+	}
+	mask := uint32(len(r.ram) - 1)
+	cycles := 0
+	done := true
+	for i := 0; i < n; i++ {
+		a, b := r.c64, r.reu&mask
+		switch mode {
+		case reuStash:
+			r.ram[b] = r.mem.Load(a)
+		case reuFetch:
+			r.mem.Store(a, r.ram[b])
+		case reuSwap:
+			value := r.mem.Load(a)
+			r.mem.Store(a, r.ram[b])
+			r.ram[b] = value
+			cycles++
+		case reuVerify:
+			if r.mem.Load(a) != r.ram[b] {
+				r.status |= reuVerifyError
+				done = false
+			}
+		}
+		cycles++
+		if r.control&reuFixC64 == 0 {
+			r.c64++
+		}
+		if r.control&reuFixREU == 0 {
+			r.reu = (r.reu + 1) & 0xffffff
+		}
+		if !done {
+			break
+		}
+		if i < n-1 {
+			r.length--
+		}
+	}
+	if done {
+		r.status |= reuEndOfBlock
+	}
+	if r.command&reuAutoload != 0 {
+		r.c64 = r.c64Load
+		r.reu = r.reuLoad
+		r.length = r.lengthLen
+	}
+	r.cpu.Cycles += uint64(cycles)
+	if r.mask&0x80 != 0 && r.mask&r.status&(reuEndOfBlock|reuVerifyError) != 0 {
+		r.status |= reuIntPending
+		r.cpu.IRQ()
+	}
+}
+
+// state saves or restores the registers and RAM. The size comes first so
+// that an REU of the right size can be attached before a restore.
+func (r *REU) state(s *stateCodec) {
+	s.fields(&r.Size, r.ram, &r.status, &r.command, &r.c64, &r.reu)
+	s.fields(&r.length, &r.mask, &r.control, &r.c64Load, &r.reuLoad)
+	s.fields(&r.lengthLen, &r.armed)
+}
+
+func (r *REU) String() string {
+	return fmt.Sprintf("%vK", r.Size)
+}
+
+// AttachREU plugs in an REU with the size given in kilobytes.
+func (m *Mach85) AttachREU(size int) error {
+	reu, err := m.newREU(size)
+	if err != nil {
+		return err
+	}
+	m.attachREU(reu)
+	return nil
+}
+
+// newREU creates an REU that can be plugged into this machine.
+func (m *Mach85) newREU(size int) (*REU, error) {
+	if _, err := m.mem64(); err != nil {
+		return nil, err
+	}
+	if m.cart != nil && m.cart.usesIO2() {
+		return nil, errors.New("cartridge uses the $df00 page")
+	}
+	return NewREU(size, m.Memory, m.cpu)
+}
+
+func (m *Mach85) attachREU(reu *REU) {
+	mem64 := m.Memory.Base.(*Memory64)
+	mem64.StoreHook = reu.storeHook
+	m.reu = reu
+	m.mapIO2(mem64)
+}
+
+func (m *Mach85) DetachREU() error {
+	if m.reu == nil {
+		return errors.New("no REU attached")
+	}
+	mem64 := m.Memory.Base.(*Memory64)
+	mem64.StoreHook = nil
+	m.reu = nil
+	m.mapIO2(mem64)
+	return nil
+}
+
+// mapIO2 gives the $df00 page to the REU when one is attached and to the
+// cartridge otherwise. Only cartridges that leave the page unused can be
+// plugged in along with an REU.
+func (m *Mach85) mapIO2(mem64 *Memory64) {
+	switch {
+	case m.reu != nil:
+		mem64.MapIO(0xdf00, 0xdfff, m.reu)
+	case m.cart != nil:
+		mem64.MapIO(0xdf00, 0xdfff, m.cart)
+	default:
+		mem64.MapIO(0xdf00, 0xdfff, nil)
+	}
+}
+
+// REU returns the REU attached or nil if there is none.
+func (m *Mach85) REU() *REU {
+	return m.reu
+}
@@ -0,0 +1,192 @@
+package mach85
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func newTestREU(t *testing.T) (*Mach85, *REU) {
+	mach := New()
+	if err := mach.AttachREU(512); err != nil {
+		t.Fatal(err)
+	}
+	return mach, mach.REU()
+}
+
+// testREUTransfer sets up the registers and executes the command right
+// away.
+func testREUTransfer(mach *Mach85, command uint8, c64 uint16, reu uint32, length uint16) {
+	mach.Memory.Store16(0xdf02, c64)
+	mach.Memory.Store16(0xdf04, uint16(reu))
+	mach.Memory.Store(0xdf06, uint8(reu>>16))
+	mach.Memory.Store16(0xdf07, length)
+	mach.Memory.Store(0xdf01, reuExecute|reuNoFF00|command)
+}
+
+func TestREUStashFetch(t *testing.T) {
+	mach, reu := newTestREU(t)
+	mach.Memory.StoreN(0xc000, 1, 2, 3)
+	testREUTransfer(mach, reuStash, 0xc000, 0x012345, 3)
+	if reu.ram[0x012347] != 3 {
+		t.Errorf("\n want: %v \n have: %v \n", 3, reu.ram[0x012347])
+	}
+	if status := mach.Memory.Load(0xdf00); status&reuEndOfBlock == 0 {
+		t.Errorf("end of block not set: %02x", status)
+	}
+	testREUTransfer(mach, reuFetch, 0xc100, 0x012345, 3)
+	if have := mach.Memory.Load(0xc102); have != 3 {
+		t.Errorf("\n want: %v \n have: %v \n", 3, have)
+	}
+	if have := mach.Memory.Load16(0xdf02); have != 0xc103 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0xc103, have)
+	}
+	if have := mach.Memory.Load16(0xdf07); have != 1 {
+		t.Errorf("\n want: %v \n have: %v \n", 1, have)
+	}
+}
+
+func TestREUSwap(t *testing.T) {
+	mach, reu := newTestREU(t)
+	reu.ram[0] = 0xaa
+	mach.Memory.Store(0xc000, 0x55)
+	testREUTransfer(mach, reuSwap, 0xc000, 0, 1)
+	if mach.Memory.Load(0xc000) != 0xaa || reu.ram[0] != 0x55 {
+		t.Errorf("not swapped: %02x %02x", mach.Memory.Load(0xc000), reu.ram[0])
+	}
+}
+
+func TestREUVerify(t *testing.T) {
+	mach, reu := newTestREU(t)
+	copy(reu.ram, []uint8{1, 2, 3})
+	mach.Memory.StoreN(0xc000, 1, 9, 3)
+	testREUTransfer(mach, reuVerify, 0xc000, 0, 3)
+	status := mach.Memory.Load(0xdf00)
+	if status&reuVerifyError == 0 || status&reuEndOfBlock != 0 {
+		t.Errorf("unexpected status: %02x", status)
+	}
+	if have := mach.Memory.Load16(0xdf02); have != 0xc002 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0xc002, have)
+	}
+}
+
+func TestREUFixedAddress(t *testing.T) {
+	mach, reu := newTestREU(t)
+	reu.ram[0] = 0x42
+	mach.Memory.Store(0xdf0a, reuFixREU)
+	testREUTransfer(mach, reuFetch, 0xc000, 0, 0x100)
+	if have := mach.Memory.Load(0xc0ff); have != 0x42 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x42, have)
+	}
+}
+
+func TestREUAutoload(t *testing.T) {
+	mach, _ := newTestREU(t)
+	testREUTransfer(mach, reuStash|reuAutoload, 0xc000, 0, 0x10)
+	if have := mach.Memory.Load16(0xdf02); have != 0xc000 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0xc000, have)
+	}
+	if have := mach.Memory.Load16(0xdf07); have != 0x10 {
+		t.Errorf("\n want: %v \n have: %v \n", 0x10, have)
+	}
+}
+
+func TestREUTrigger(t *testing.T) {
+	mach, reu := newTestREU(t)
+	mach.Memory.Store(0xc000, 0x42)
+	mach.Memory.Store16(0xdf02, 0xc000)
+	mach.Memory.Store16(0xdf07, 1)
+	mach.Memory.Store(0xdf01, reuExecute|reuStash)
+	if reu.ram[0] != 0 {
+		t.Fatalf("executed before trigger")
+	}
+	mach.Memory.Store(0xff00, 0)
+	if reu.ram[0] != 0x42 {
+		t.Errorf("not executed after trigger")
+	}
+}
+
+func TestREUCycles(t *testing.T) {
+	mach, _ := newTestREU(t)
+	testREUTransfer(mach, reuStash, 0xc000, 0, 0)
+	if mach.cpu.Cycles != 0x10000 {
+		t.Errorf("\n want: %v \n have: %v \n", 0x10000, mach.cpu.Cycles)
+	}
+}
+
+func TestREUInterrupt(t *testing.T) {
+	mach, _ := newTestREU(t)
+	mach.Memory.Store(0xdf09, 0x80|reuEndOfBlock)
+	testREUTransfer(mach, reuStash, 0xc000, 0, 1)
+	if status := mach.Memory.Load(0xdf00); status&reuIntPending == 0 {
+		t.Errorf("interrupt not pending: %02x", status)
+	}
+	select {
+	case <-mach.cpu.irq:
+	default:
+		t.Errorf("no irq")
+	}
+}
+
+func TestREUInvalidSize(t *testing.T) {
+	mach := New()
+	for _, size := range []int{0, 64, 300, 32768} {
+		if err := mach.AttachREU(size); err == nil {
+			t.Errorf("expected error for %v", size)
+		}
+	}
+}
+
+func TestREUWithCartridge(t *testing.T) {
+	mach := newTestCartridge(t, testCRT(CartOcean, 0, 0,
+		testChip(0, 0x8000, 0x2000), testChip(1, 0x8000, 0x2000)))
+	if err := mach.AttachREU(512); err != nil {
+		t.Fatal(err)
+	}
+	mach.Memory.Store(AddrProcessorPort, 0x37)
+	mach.Memory.Store(0xde00, 0x81)
+	if have := mach.Memory.Load(0x8000); have != 0x11 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x11, have)
+	}
+	mach.Memory.Store16(0xdf02, 0xc000)
+	if err := mach.DetachCartridge(); err != nil {
+		t.Fatal(err)
+	}
+	if have := mach.Memory.Load16(0xdf02); have != 0xc000 {
+		t.Errorf("REU unmapped by cartridge: %04x", have)
+	}
+	if err := mach.DetachREU(); err != nil {
+		t.Fatal(err)
+	}
+	if mach.Memory.Load16(0xdf02) == 0xc000 {
+		t.Errorf("REU still mapped")
+	}
+}
+
+func TestREUWithCartridgeIO2(t *testing.T) {
+	mach := newTestCartridge(t, testCRT(CartActionReplay, 0, 1,
+		testChip(0, 0x8000, 0x2000)))
+	mach.Memory.Store(0xde00, 0x20) // RAM at $8000 and $df00
+	mach.Memory.Store(0xdf05, 0x42)
+	if err := mach.AttachREU(512); err == nil {
+		t.Errorf("expected error")
+	}
+	if have := mach.Memory.Load(0xdf05); have != 0x42 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x42, have)
+	}
+
+	mach, _ = newTestREU(t)
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(testCRT(CartActionReplay, 0, 1, testChip(0, 0x8000, 0x2000)))
+	file.Close()
+	defer os.Remove(file.Name())
+	if err := mach.AttachCartridge(file.Name()); err == nil {
+		t.Errorf("expected error")
+	}
+	if mach.Cartridge() != nil {
+		t.Errorf("cartridge attached")
+	}
+}
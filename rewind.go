@@ -0,0 +1,247 @@
+package mach85
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Frames of history kept when no number is given, about five seconds
+const defaultRewindFrames = 300
+
+// Rewind keeps the recent history of the machine so that it can be run
+// backwards. A snapshot is taken at the start of each frame and the
+// address of every instruction executed is kept in a journal. Going back
+// restores the closest snapshot before the instruction wanted and then
+// runs forward to it again. Anything that happened after that point is
+// forgotten. Disks in true drives are kept along with the snapshots so
+// that writes to them are undone as well.
+type Rewind struct {
+	frames    []rewindFrame
+	journal   []uint16
+	inputs    []InputEvent // given since the oldest frame
+	count     uint64       // number of instructions executed
+	nextFrame uint64       // cycle count when the next snapshot is taken
+}
+
+type rewindFrame struct {
+	count  uint64
+	cycles uint64
+	data   []uint8
+	disks  map[int]*driveDisk
+}
+
+// NewRewind keeps the history for the number of frames given. The journal
+// is large enough to hold every instruction in those frames.
+func NewRewind(frames int) (*Rewind, error) {
+	if frames < 1 {
+		return nil, fmt.Errorf("invalid number of frames: %v", frames)
+	}
+	return &Rewind{
+		frames:  make([]rewindFrame, 0, frames),
+		journal: make([]uint16, frames*frameCyclesNTSC/2),
+	}, nil
+}
+
+// record is called before each instruction is executed.
+func (r *Rewind) record(m *Mach85) error {
+	if m.cpu.Cycles >= r.nextFrame {
+		data, err := m.snapshot()
+		if err != nil {
+			return err
+		}
+		if len(r.frames) == cap(r.frames) {
+			r.frames = append(r.frames[:0], r.frames[1:]...)
+			r.inputs = inputsAfter(r.inputs, r.frames[0].cycles)
+		}
+		disks := map[int]*driveDisk{}
+		for device, d := range m.trueDrives {
+			disks[device] = d.disk()
+		}
+		r.frames = append(r.frames, rewindFrame{
+			count:  r.count,
+			cycles: m.cpu.Cycles,
+			data:   data,
+			disks:  disks,
+		})
+		r.nextFrame = m.cpu.Cycles + frameCyclesNTSC
+	}
+	r.journal[r.count%uint64(len(r.journal))] = m.cpu.PC + 1
+	r.count++
+	return nil
+}
+
+// clear forgets the history, such as when a snapshot is loaded.
+func (r *Rewind) clear(cycles uint64) {
+	r.frames = r.frames[:0]
+	r.inputs = nil
+	r.count = 0
+	r.nextFrame = cycles
+}
+
+// oldest returns the first instruction that can be returned to.
+func (r *Rewind) oldest() uint64 {
+	if len(r.frames) == 0 {
+		return r.count
+	}
+	return r.frames[0].count
+}
+
+// History returns the addresses of up to the last n instructions
+// executed, oldest first.
+func (r *Rewind) History(n int) []uint16 {
+	start := r.count - uint64(n)
+	if n > int(r.count) {
+		start = 0
+	}
+	if limit := r.count - uint64(len(r.journal)); r.count > uint64(len(r.journal)) && start < limit {
+		start = limit
+	}
+	history := []uint16{}
+	for i := start; i < r.count; i++ {
+		history = append(history, r.journal[i%uint64(len(r.journal))])
+	}
+	return history
+}
+
+// Frames returns the number of snapshots available.
+func (r *Rewind) Frames() int {
+	return len(r.frames)
+}
+
+// EnableRewind starts keeping history for the number of frames given.
+func (m *Mach85) EnableRewind(frames int) error {
+	r, err := NewRewind(frames)
+	if err != nil {
+		return err
+	}
+	r.nextFrame = m.cpu.Cycles
+	m.rewind = r
+	return nil
+}
+
+func (m *Mach85) DisableRewind() error {
+	if m.rewind == nil {
+		return errors.New("rewind not enabled")
+	}
+	m.rewind = nil
+	return nil
+}
+
+// Rewind returns the history of the machine or nil if it is not being
+// kept.
+func (m *Mach85) Rewind() *Rewind {
+	return m.rewind
+}
+
+// inputsAfter returns the events that were given after the cycle.
+func inputsAfter(events []InputEvent, cycle uint64) []InputEvent {
+	after := []InputEvent{}
+	for _, e := range events {
+		if e.Cycle > cycle {
+			after = append(after, e)
+		}
+	}
+	return after
+}
+
+// replay returns to the state before the instruction given was executed.
+// Input given since the snapshot is given again at the same cycles. Input
+// from a file stops playing.
+func (m *Mach85) replay(target uint64) error {
+	r := m.rewind
+	if m.inputRec != nil {
+		return errors.New("recording input")
+	}
+	m.inputPlay = nil
+	i := len(r.frames) - 1
+	for i >= 0 && r.frames[i].count > target {
+		i--
+	}
+	if i < 0 {
+		return errors.New("not enough history")
+	}
+	frame := r.frames[i]
+	if err := m.restore(frame.data); err != nil {
+		return err
+	}
+	for device, disk := range frame.disks {
+		if d, ok := m.trueDrives[device]; ok {
+			if err := d.setDisk(disk); err != nil {
+				return err
+			}
+		}
+	}
+	r.frames = r.frames[:i+1]
+	r.count = frame.count
+	r.nextFrame = frame.cycles + frameCyclesNTSC
+	pending := inputsAfter(r.inputs, frame.cycles)
+	r.inputs = r.inputs[:len(r.inputs)-len(pending)]
+	give := func() {
+		for len(pending) > 0 && pending[0].Cycle <= m.cpu.Cycles {
+			m.applyInput(pending[0])
+			pending = pending[1:]
+		}
+	}
+	for r.count < target {
+		// As the run loop does when resuming after a break
+		if m.cpu.B {
+			m.cpu.B = false
+			if !m.StopOnBreak {
+				m.cpu.brk()
+			}
+		}
+		give()
+		m.execute(false)
+		if m.Status == Trap {
+			m.Status = Halt
+			return m.Err
+		}
+	}
+	give()
+	return nil
+}
+
+// StepBack undoes the last n instructions.
+func (m *Mach85) StepBack(n int) error {
+	if m.rewind == nil {
+		return errors.New("rewind not enabled")
+	}
+	if uint64(n) > m.rewind.count-m.rewind.oldest() {
+		return errors.New("not enough history")
+	}
+	return m.replay(m.rewind.count - uint64(n))
+}
+
+// RunBack goes back to the last time a breakpoint was reached. If there is
+// no breakpoint in the history, the machine returns to the oldest state
+// available and false is returned. Breakpoint conditions are not checked
+// as the state they depend on is not kept.
+func (m *Mach85) RunBack() (bool, error) {
+	r := m.rewind
+	if r == nil {
+		return false, errors.New("rewind not enabled")
+	}
+	oldest := r.oldest()
+	if r.count > uint64(len(r.journal)) && oldest < r.count-uint64(len(r.journal)) {
+		oldest = r.count - uint64(len(r.journal))
+	}
+	for i := r.count; i > oldest; i-- {
+		address := r.journal[(i-1)%uint64(len(r.journal))]
+		if b, ok := m.Breakpoints[address]; ok && b.Enabled {
+			return true, m.replay(i - 1)
+		}
+	}
+	return false, m.replay(oldest)
+}
+
+// RewindFrames returns to the start of the nth most recent frame.
+func (m *Mach85) RewindFrames(n int) error {
+	r := m.rewind
+	if r == nil {
+		return errors.New("rewind not enabled")
+	}
+	if n < 1 || n > len(r.frames) {
+		return errors.New("not enough history")
+	}
+	return m.replay(r.frames[len(r.frames)-n].count)
+}
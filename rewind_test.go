@@ -0,0 +1,106 @@
+package mach85
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newTestRewind runs a loop that counts up in X and stores it at $c000.
+func newTestRewind(t *testing.T, frames int, steps int) *Mach85 {
+	mach := New()
+	mach.Memory.StoreN(0x0800,
+		0xe8,             // inx
+		0x8e, 0x00, 0xc0, // stx $c000
+		0x4c, 0x00, 0x08, // jmp $0800
+	)
+	mach.cpu.PC = 0x0800 - 1
+	if err := mach.EnableRewind(frames); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < steps; i++ {
+		if err := mach.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mach
+}
+
+func TestStepBack(t *testing.T) {
+	mach := newTestRewind(t, 2, 30)
+	if err := mach.StepBack(5); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want interface{}
+		have interface{}
+	}{
+		{"pc", uint16(0x0801), mach.cpu.PC + 1},
+		{"x", uint8(9), mach.cpu.X},
+		{"ram", uint8(8), mach.Memory.Load(0xc000)},
+		{"history", []uint16{0x0801, 0x0804, 0x0800}, mach.Rewind().History(3)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.want, test.have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, test.have)
+			}
+		})
+	}
+	if err := mach.StepBack(100); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestRunBack(t *testing.T) {
+	mach := newTestRewind(t, 2, 20000)
+	mach.Breakpoints[0x0801] = NewBreakpointInfo(0x0801)
+	x := mach.cpu.X
+	found, err := mach.RunBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatalf("breakpoint not found")
+	}
+	if mach.cpu.PC+1 != 0x0801 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0x0801, mach.cpu.PC+1)
+	}
+	if mach.cpu.X != x && mach.cpu.X != x-1 {
+		t.Errorf("\n want: %v \n have: %v \n", x, mach.cpu.X)
+	}
+}
+
+func TestRewindFrames(t *testing.T) {
+	mach := newTestRewind(t, 2, 20000)
+	if have := mach.Rewind().Frames(); have != 2 {
+		t.Fatalf("\n want: %v \n have: %v \n", 2, have)
+	}
+	want := mach.Rewind().frames[0].cycles
+	if err := mach.RewindFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	if mach.cpu.Cycles != want {
+		t.Errorf("\n want: %v \n have: %v \n", want, mach.cpu.Cycles)
+	}
+	if err := mach.RewindFrames(2); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestStepBackCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.mach.Memory.StoreN(0x0800, 0xe8, 0xe8)
+	testMonitorParse(mon, "sb \n rw on \n s \n s \n sb \n hist")
+	want := []string{
+		"rewind not enabled",
+		"$0800: e8        inx",
+		"$0801: e8        inx",
+		"$0801: e8        inx",
+		"$0800: e8        inx",
+	}
+	have := testLines(t, out, 5)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
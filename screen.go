@@ -0,0 +1,186 @@
+package mach85
+
+import "image/color"
+
+// Screen is the text display of a machine as drawn by the video output.
+// Characters are numbered from the top left corner.
+type Screen interface {
+	Size() (cols int, rows int)
+	Char(i int) uint8
+	Color(i int) color.RGBA
+	Background() color.RGBA
+	Border() color.RGBA
+	// CharROM contains the shapes of 512 characters, 8 bytes each.
+	CharROM() MemoryChunk
+	// Frame is called at the start of each frame.
+	Frame()
+}
+
+// http://dustlayer.com/index-vic-ii/
+// http://www.zimmers.net/cbmpics/cbm/c64/vic-ii.txt
+
+// c64Screen is the text mode of the VIC-II with the screen at $0400.
+type c64Screen struct {
+	mem *Memory64
+}
+
+func (s c64Screen) Size() (int, int) {
+	return 40, 25
+}
+
+func (s c64Screen) Char(i int) uint8 {
+	return s.mem.Chunks[RAM0].Load(0x0400 + uint16(i))
+}
+
+func (s c64Screen) Color(i int) color.RGBA {
+	return colorMap[s.mem.Chunks[IO].Load(0x0800+uint16(i))&0x0f]
+}
+
+func (s c64Screen) Background() color.RGBA {
+	return colorMap[s.mem.Chunks[IO].Load(AddrBackgroundColor-0xd000)&0x0f]
+}
+
+func (s c64Screen) Border() color.RGBA {
+	return colorMap[s.mem.Chunks[IO].Load(AddrBorderColor-0xd000)&0x0f]
+}
+
+func (s c64Screen) CharROM() MemoryChunk {
+	return s.mem.Chunks[CharROM]
+}
+
+func (s c64Screen) Frame() {
+	s.mem.io.Store(0xd012-0xd000, 0) // HACK: set raster line to zero
+}
+
+// petScreen is the 40 column display of the PET with the screen at $8000.
+// The character ROM only holds 128 characters for each set and the
+// hardware inverts them for codes with bit 7 set.
+type petScreen struct {
+	mem     *Memory
+	charROM MemoryChunk
+}
+
+var petGreen = color.RGBA{0x41, 0xff, 0x00, 0xff}
+
+func (s petScreen) Size() (int, int) {
+	return 40, 25
+}
+
+func (s petScreen) Char(i int) uint8 {
+	return s.mem.Load(0x8000 + uint16(i))
+}
+
+func (s petScreen) Color(i int) color.RGBA {
+	return petGreen
+}
+
+func (s petScreen) Background() color.RGBA {
+	return Black
+}
+
+func (s petScreen) Border() color.RGBA {
+	return Black
+}
+
+func (s petScreen) CharROM() MemoryChunk {
+	return reversedROM{s.charROM}
+}
+
+func (s petScreen) Frame() {}
+
+// reversedROM adds the inverted shapes after each set of 128 characters.
+type reversedROM struct {
+	rom MemoryChunk
+}
+
+func (r reversedROM) Load(address uint16) uint8 {
+	set := address / 0x800 * 0x400
+	if address&0x400 != 0 {
+		return ^r.rom.Load(set + address&0x3ff)
+	}
+	return r.rom.Load(set + address&0x3ff)
+}
+
+func (r reversedROM) Store(address uint16, value uint8) {}
+
+// http://www.zimmers.net/anonftp/pub/cbm/documents/chipdata/6560-6561.txt
+
+var vicColorMap = [...]color.RGBA{
+	Black,
+	White,
+	{0xb6, 0x1f, 0x21, 0xff}, // red
+	{0x4d, 0xf0, 0xff, 0xff}, // cyan
+	{0xb4, 0x3f, 0xff, 0xff}, // purple
+	{0x44, 0xe2, 0x37, 0xff}, // green
+	{0x1a, 0x34, 0xff, 0xff}, // blue
+	{0xdc, 0xd7, 0x1b, 0xff}, // yellow
+	{0xca, 0x54, 0x00, 0xff}, // orange
+	{0xe9, 0xb0, 0x72, 0xff}, // light orange
+	{0xe7, 0x92, 0x93, 0xff}, // pink
+	{0x9a, 0xf7, 0xfd, 0xff}, // light cyan
+	{0xe0, 0x9f, 0xff, 0xff}, // light purple
+	{0x8f, 0xe4, 0x93, 0xff}, // light green
+	{0x82, 0x90, 0xff, 0xff}, // light blue
+	{0xe5, 0xde, 0x85, 0xff}, // light yellow
+}
+
+// vicScreen is the display of the VIC-I in the VIC-20. The size and the
+// location of the screen and character memory are set in its registers.
+type vicScreen struct {
+	mem *Memory
+	vic *VICI
+}
+
+// address converts an address seen by the VIC-I into one seen by the CPU.
+func (s vicScreen) address(vic uint16) uint16 {
+	if vic < 0x2000 {
+		return vic + 0x8000
+	}
+	return vic - 0x2000
+}
+
+func (s vicScreen) Size() (int, int) {
+	return int(s.vic.regs[2] & 0x7f), int(s.vic.regs[3] >> 1 & 0x3f)
+}
+
+func (s vicScreen) Char(i int) uint8 {
+	base := uint16(s.vic.regs[5]&0xf0)<<6 | uint16(s.vic.regs[2]&0x80)<<2
+	return s.mem.Load(s.address(base) + uint16(i))
+}
+
+func (s vicScreen) Color(i int) color.RGBA {
+	base := uint16(0x9400)
+	if s.vic.regs[2]&0x80 != 0 {
+		base = 0x9600
+	}
+	return vicColorMap[s.mem.Load(base+uint16(i))&0x07]
+}
+
+func (s vicScreen) Background() color.RGBA {
+	return vicColorMap[s.vic.regs[15]>>4]
+}
+
+func (s vicScreen) Border() color.RGBA {
+	return vicColorMap[s.vic.regs[15]&0x07]
+}
+
+func (s vicScreen) CharROM() MemoryChunk {
+	base := s.address(uint16(s.vic.regs[5]&0x0f) << 10)
+	return offsetMemory{s.mem, base}
+}
+
+func (s vicScreen) Frame() {}
+
+// offsetMemory is a view of memory starting at the base address.
+type offsetMemory struct {
+	mem  *Memory
+	base uint16
+}
+
+func (o offsetMemory) Load(address uint16) uint8 {
+	return o.mem.Load(o.base + address)
+}
+
+func (o offsetMemory) Store(address uint16, value uint8) {
+	o.mem.Store(o.base+address, value)
+}
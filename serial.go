@@ -0,0 +1,282 @@
+package mach85
+
+import (
+	"strings"
+)
+
+// https://www.pagetable.com/?p=1031
+
+// Commands sent with the secondary address
+const (
+	serialData  = 0x60
+	serialClose = 0xe0
+	serialOpen  = 0xf0
+)
+
+// Bits set in the KERNAL status byte
+const (
+	statusTimeout = 0x02
+	statusVerify  = 0x10
+	statusEOI     = 0x40
+)
+
+const commandChannel = 15
+
+// channel is a file opened on a drive. Files are read in whole when opened
+// and written in whole when closed.
+type channel struct {
+	name  string
+	write bool
+	data  []uint8
+	pos   int
+}
+
+type channelKey struct {
+	device  int
+	channel int
+}
+
+// serialBus replaces the KERNAL serial bus routines for devices that have
+// a drive attached. This allows OPEN, CHKIN, CHKOUT, CHRIN, CHROUT and
+// CLOSE to work with the drive without emulating the bus itself.
+type serialBus struct {
+	device   int // zero when no attached device is addressed
+	channel  int
+	opening  bool
+	name     []uint8
+	channels map[channelKey]*channel
+	status   map[int]string
+}
+
+func newSerialBus() *serialBus {
+	return &serialBus{
+		channels: map[channelKey]*channel{},
+		status:   map[int]string{},
+	}
+}
+
+func driveStatus(err error) string {
+	switch err {
+	case nil:
+		return "00, OK,00,00"
+	case ErrFileNotFound:
+		return "62,FILE NOT FOUND,00,00"
+	case ErrFileExists:
+		return "63,FILE EXISTS,00,00"
+	case ErrDiskFull:
+		return "72,DISK FULL,00,00"
+	case ErrDirFull:
+		return "72,DISK FULL,00,00"
+	}
+	return "74,DRIVE NOT READY,00,00"
+}
+
+func (b *serialBus) open(drive Drive, name string) {
+	key := channelKey{device: b.device, channel: b.channel}
+	if b.channel == commandChannel {
+		b.command(drive, name)
+		return
+	}
+	ch := &channel{name: name}
+	options := strings.Split(name, ",")
+	ch.write = b.channel == 1
+	for _, opt := range options[1:] {
+		switch opt {
+		case "W":
+			ch.write = true
+		case "R":
+			ch.write = false
+		}
+	}
+	b.status[b.device] = driveStatus(nil)
+	if !ch.write {
+		data, err := drive.Load(name)
+		if err != nil {
+			b.status[b.device] = driveStatus(err)
+			return
+		}
+		ch.data = data
+	}
+	b.channels[key] = ch
+}
+
+// command runs a DOS command sent to the command channel. Only scratch
+// is supported.
+func (b *serialBus) command(drive Drive, cmd string) {
+	b.status[b.device] = driveStatus(nil)
+	if !strings.HasPrefix(cmd, "S") {
+		return
+	}
+	i := strings.IndexByte(cmd, ':')
+	if i < 0 {
+		return
+	}
+	if err := drive.Scratch(cmd[i+1:]); err != nil {
+		b.status[b.device] = driveStatus(err)
+	}
+}
+
+func (b *serialBus) close(drive Drive) {
+	key := channelKey{device: b.device, channel: b.channel}
+	ch, ok := b.channels[key]
+	if !ok {
+		return
+	}
+	delete(b.channels, key)
+	if ch.write {
+		b.status[b.device] = driveStatus(drive.Save(ch.name, ch.data))
+	}
+}
+
+func (b *serialBus) write(value uint8) {
+	if b.opening {
+		b.name = append(b.name, value)
+		return
+	}
+	key := channelKey{device: b.device, channel: b.channel}
+	if ch, ok := b.channels[key]; ok && ch.write {
+		ch.data = append(ch.data, value)
+	}
+}
+
+// read returns the next byte from the channel along with the status bits
+// to set.
+func (b *serialBus) read() (uint8, uint8) {
+	key := channelKey{device: b.device, channel: b.channel}
+	if b.channel == commandChannel {
+		status, ok := b.status[b.device]
+		if !ok {
+			status = driveStatus(nil)
+		}
+		ch := &channel{data: []uint8(status + "\r")}
+		if existing, ok := b.channels[key]; ok {
+			ch = existing
+		}
+		b.channels[key] = ch
+		value := ch.data[ch.pos]
+		ch.pos++
+		if ch.pos >= len(ch.data) {
+			delete(b.channels, key)
+			b.status[b.device] = driveStatus(nil)
+			return value, statusEOI
+		}
+		return value, 0
+	}
+	ch, ok := b.channels[key]
+	if !ok || ch.write || ch.pos >= len(ch.data) {
+		return '\r', statusTimeout
+	}
+	value := ch.data[ch.pos]
+	ch.pos++
+	if ch.pos >= len(ch.data) {
+		return value, statusEOI
+	}
+	return value, 0
+}
+
+func (m *Mach85) addressed() (Drive, bool) {
+	if m.bus.device == 0 {
+		return nil, false
+	}
+	drive, ok := m.drives[m.bus.device]
+	return drive, ok
+}
+
+func (m *Mach85) setStatus(bits uint8) {
+	m.Memory.Store(AddrStatus, m.Memory.Load(AddrStatus)|bits)
+}
+
+// trapListen and trapTalk are called with the device number in the
+// accumulator.
+func (m *Mach85) trapListen() bool {
+	return m.trapAddress()
+}
+
+func (m *Mach85) trapTalk() bool {
+	return m.trapAddress()
+}
+
+func (m *Mach85) trapAddress() bool {
+	device := int(m.cpu.A & 0x1f)
+	if _, ok := m.drives[device]; !ok {
+		m.bus.device = 0
+		return false
+	}
+	m.bus.device = device
+	m.bus.opening = false
+	m.kernalReturn(0)
+	return true
+}
+
+// trapSecond is the secondary address sent after LISTEN and trapTalkSA is
+// the one sent after TALK. The command is in the upper bits.
+func (m *Mach85) trapSecond() bool {
+	drive, ok := m.addressed()
+	if !ok {
+		return false
+	}
+	m.bus.channel = int(m.cpu.A & 0x0f)
+	switch m.cpu.A & 0xf0 {
+	case serialOpen:
+		m.bus.opening = true
+		m.bus.name = m.bus.name[:0]
+	case serialClose:
+		m.bus.close(drive)
+	}
+	m.kernalReturn(0)
+	return true
+}
+
+func (m *Mach85) trapTalkSA() bool {
+	if _, ok := m.addressed(); !ok {
+		return false
+	}
+	m.bus.channel = int(m.cpu.A & 0x0f)
+	m.kernalReturn(0)
+	return true
+}
+
+// trapCIOUT sends the byte in the accumulator to the device.
+func (m *Mach85) trapCIOUT() bool {
+	if _, ok := m.addressed(); !ok {
+		return false
+	}
+	m.bus.write(m.cpu.A)
+	m.kernalReturn(0)
+	return true
+}
+
+// trapACPTR reads a byte from the device into the accumulator.
+func (m *Mach85) trapACPTR() bool {
+	if _, ok := m.addressed(); !ok {
+		return false
+	}
+	value, status := m.bus.read()
+	m.setStatus(status)
+	m.cpu.A = value
+	m.kernalReturn(0)
+	return true
+}
+
+func (m *Mach85) trapUnlisten() bool {
+	drive, ok := m.addressed()
+	if !ok {
+		return false
+	}
+	if m.bus.opening {
+		m.bus.opening = false
+		m.bus.open(drive, string(m.bus.name))
+	}
+	m.bus.device = 0
+	m.kernalReturn(0)
+	return true
+}
+
+func (m *Mach85) trapUntalk() bool {
+	if _, ok := m.addressed(); !ok {
+		return false
+	}
+	m.bus.device = 0
+	m.kernalReturn(0)
+	return true
+}
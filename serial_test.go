@@ -0,0 +1,124 @@
+package mach85
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testSerialCalls runs a program that calls each of the KERNAL serial
+// routines given with the accumulator set. Bytes read with ACPTR are
+// stored starting at $c000.
+func testSerialCalls(mach *Mach85, calls ...[2]uint16) {
+	var prog []uint8
+	out := uint16(0xc000)
+	for _, call := range calls {
+		routine, a := call[0], call[1]
+		prog = append(prog,
+			0xa9, uint8(a), // lda #a
+			0x20, uint8(routine), uint8(routine>>8), // jsr routine
+		)
+		if routine == AddrKernalACPTR {
+			prog = append(prog, 0x8d, uint8(out), uint8(out>>8)) // sta out
+			out++
+		}
+	}
+	prog = append(prog, 0x00) // brk
+	mach.Memory.Import(0x0800, prog)
+	mach.cpu.PC = 0x0800 - 1
+	mach.Start()
+	mach.Run()
+}
+
+func testSerialOpen(device uint16, channel uint16, name string) [][2]uint16 {
+	calls := [][2]uint16{
+		{AddrKernalListen, device},
+		{AddrKernalSecond, serialOpen | channel},
+	}
+	for _, ch := range []uint8(name) {
+		calls = append(calls, [2]uint16{AddrKernalCIOUT, uint16(ch)})
+	}
+	return append(calls, [2]uint16{AddrKernalUnlisten, 0})
+}
+
+func testSerialClose(device uint16, channel uint16) [][2]uint16 {
+	return [][2]uint16{
+		{AddrKernalListen, device},
+		{AddrKernalSecond, serialClose | channel},
+		{AddrKernalUnlisten, 0},
+	}
+}
+
+func testSerialRead(device uint16, channel uint16, n int) [][2]uint16 {
+	calls := [][2]uint16{
+		{AddrKernalTalk, device},
+		{AddrKernalTalkSA, serialData | channel},
+	}
+	for i := 0; i < n; i++ {
+		calls = append(calls, [2]uint16{AddrKernalACPTR, 0})
+	}
+	return append(calls, [2]uint16{AddrKernalUntalk, 0})
+}
+
+func TestSerialReadSEQ(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	disk.WriteFile("NOTES", FileSEQ, []uint8("HI"))
+	var calls [][2]uint16
+	calls = append(calls, testSerialOpen(8, 2, "NOTES,S,R")...)
+	calls = append(calls, testSerialRead(8, 2, 2)...)
+	calls = append(calls, testSerialClose(8, 2)...)
+	testSerialCalls(mach, calls...)
+	have := []uint8{mach.Memory.Load(0xc000), mach.Memory.Load(0xc001)}
+	if !bytes.Equal([]uint8("HI"), have) {
+		t.Errorf("\n want: %q \n have: %q \n", "HI", have)
+	}
+	if mach.Memory.Load(AddrStatus) != statusEOI {
+		t.Errorf("\n want: %02x \n have: %02x \n", statusEOI, mach.Memory.Load(AddrStatus))
+	}
+}
+
+func TestSerialWriteSEQ(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	var calls [][2]uint16
+	calls = append(calls, testSerialOpen(8, 2, "NOTES,S,W")...)
+	calls = append(calls,
+		[2]uint16{AddrKernalListen, 8},
+		[2]uint16{AddrKernalSecond, serialData | 2},
+		[2]uint16{AddrKernalCIOUT, 'H'},
+		[2]uint16{AddrKernalCIOUT, 'I'},
+		[2]uint16{AddrKernalUnlisten, 0},
+	)
+	calls = append(calls, testSerialClose(8, 2)...)
+	testSerialCalls(mach, calls...)
+	e, err := disk.Find("NOTES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != FileSEQ {
+		t.Errorf("\n want: %v \n have: %v \n", FileSEQ, e.Type)
+	}
+	data, _ := disk.ReadFile("NOTES")
+	if !bytes.Equal([]uint8("HI"), data) {
+		t.Errorf("\n want: %q \n have: %q \n", "HI", data)
+	}
+}
+
+func TestSerialFileNotFound(t *testing.T) {
+	mach, _ := newTestDriveMach(t)
+	var calls [][2]uint16
+	calls = append(calls, testSerialOpen(8, 2, "NOPE")...)
+	calls = append(calls, testSerialRead(8, 15, 2)...)
+	testSerialCalls(mach, calls...)
+	have := []uint8{mach.Memory.Load(0xc000), mach.Memory.Load(0xc001)}
+	if !bytes.Equal([]uint8("62"), have) {
+		t.Errorf("\n want: %q \n have: %q \n", "62", have)
+	}
+}
+
+func TestSerialScratch(t *testing.T) {
+	mach, disk := newTestDriveMach(t)
+	disk.WriteFile("OLD", FilePRG, []uint8{0x00, 0xc0})
+	testSerialCalls(mach, testSerialOpen(8, 15, "S0:OLD")...)
+	if _, err := disk.Find("OLD"); err != ErrFileNotFound {
+		t.Errorf("\n want: %v \n have: %v \n", ErrFileNotFound, err)
+	}
+}
@@ -0,0 +1,505 @@
+package mach85
+
+// https://www.c64-wiki.com/wiki/SID
+// http://www.waitingforfriday.com/?p=661
+// https://github.com/libsidplayfp/resid
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+var sidModel string
+
+func init() {
+	flag.StringVar(&sidModel, "sid-model", "6581", "SID chip model, 6581 or 8580")
+}
+
+type SIDModel int
+
+const (
+	SID6581 SIDModel = iota
+	SID8580
+)
+
+func (m SIDModel) String() string {
+	switch m {
+	case SID6581:
+		return "6581"
+	case SID8580:
+		return "8580"
+	}
+	return "???"
+}
+
+func ParseSIDModel(str string) (SIDModel, error) {
+	switch str {
+	case "6581":
+		return SID6581, nil
+	case "8580":
+		return SID8580, nil
+	}
+	return 0, fmt.Errorf("invalid SID model: %v", str)
+}
+
+const (
+	ClockRateNTSC = 1022727
+	ClockRatePAL  = 985248
+)
+
+// Registers, relative to the base address of $d400
+const (
+	sidFilterCutoffLo = 0x15
+	sidFilterCutoffHi = 0x16
+	sidFilterControl  = 0x17
+	sidModeVolume     = 0x18
+	sidPotX           = 0x19
+	sidPotY           = 0x1a
+	sidOsc3           = 0x1b
+	sidEnv3           = 0x1c
+)
+
+// Voice control register bits
+const (
+	ctrlGate     = uint8(1 << 0)
+	ctrlSync     = uint8(1 << 1)
+	ctrlRing     = uint8(1 << 2)
+	ctrlTest     = uint8(1 << 3)
+	ctrlTriangle = uint8(1 << 4)
+	ctrlSawtooth = uint8(1 << 5)
+	ctrlPulse    = uint8(1 << 6)
+	ctrlNoise    = uint8(1 << 7)
+)
+
+// Mode and volume register bits
+const (
+	modeLowPass  = uint8(1 << 4)
+	modeBandPass = uint8(1 << 5)
+	modeHighPass = uint8(1 << 6)
+	mode3Off     = uint8(1 << 7)
+)
+
+type envState int
+
+const (
+	envAttack envState = iota
+	envDecaySustain
+	envRelease
+)
+
+// Number of cycles between each step of the envelope counter for each of
+// the rate settings.
+var envRates = [16]uint16{
+	9, 32, 63, 95, 149, 220, 267, 313, 392, 977, 1954, 3126, 3907, 11720, 19532, 31251,
+}
+
+type envelope struct {
+	state      envState
+	counter    uint8
+	rate       uint16
+	exp        uint8
+	expPeriod  uint8
+	attack     uint8
+	decay      uint8
+	sustain    uint8
+	release    uint8
+	gateActive bool
+}
+
+func (e *envelope) gate(on bool) {
+	if on && !e.gateActive {
+		e.state = envAttack
+	} else if !on && e.gateActive {
+		e.state = envRelease
+	}
+	e.gateActive = on
+}
+
+func (e *envelope) clock() {
+	var period uint16
+	switch e.state {
+	case envAttack:
+		period = envRates[e.attack]
+	case envDecaySustain:
+		period = envRates[e.decay]
+	case envRelease:
+		period = envRates[e.release]
+	}
+	e.rate++
+	if e.rate < period {
+		return
+	}
+	e.rate = 0
+
+	if e.state == envAttack {
+		if e.counter < 0xff {
+			e.counter++
+		}
+		if e.counter == 0xff {
+			e.state = envDecaySustain
+		}
+		e.updateExpPeriod()
+		return
+	}
+
+	// Decay and release are exponential by slowing down the steps as the
+	// counter gets lower.
+	e.exp++
+	if e.exp < e.expPeriod {
+		return
+	}
+	e.exp = 0
+	switch e.state {
+	case envDecaySustain:
+		if e.counter > e.sustain*0x11 {
+			e.counter--
+		}
+	case envRelease:
+		if e.counter > 0 {
+			e.counter--
+		}
+	}
+	e.updateExpPeriod()
+}
+
+func (e *envelope) updateExpPeriod() {
+	switch {
+	case e.counter > 0x5d:
+		e.expPeriod = 1
+	case e.counter > 0x36:
+		e.expPeriod = 2
+	case e.counter > 0x1a:
+		e.expPeriod = 4
+	case e.counter > 0x0e:
+		e.expPeriod = 8
+	case e.counter > 0x06:
+		e.expPeriod = 16
+	default:
+		e.expPeriod = 30
+	}
+}
+
+type voice struct {
+	freq     uint16
+	pw       uint16
+	control  uint8
+	acc      uint32 // 24-bit phase accumulator
+	noise    uint32 // 23-bit noise shift register
+	msbRose  bool
+	envelope envelope
+}
+
+func (v *voice) clock() {
+	if v.control&ctrlTest != 0 {
+		v.msbRose = false
+		return
+	}
+	prev := v.acc
+	v.acc = (v.acc + uint32(v.freq)) & 0xffffff
+	v.msbRose = prev&0x800000 == 0 && v.acc&0x800000 != 0
+	// Noise is clocked when bit 19 of the accumulator goes high
+	if prev&0x080000 == 0 && v.acc&0x080000 != 0 {
+		bit := (v.noise>>22 ^ v.noise>>17) & 1
+		v.noise = (v.noise<<1 | bit) & 0x7fffff
+	}
+}
+
+func (v *voice) noiseOutput() uint16 {
+	n := v.noise
+	return uint16(n>>9&0x800 |
+		n>>8&0x400 |
+		n>>5&0x200 |
+		n>>3&0x100 |
+		n>>2&0x080 |
+		n<<1&0x040 |
+		n<<3&0x020 |
+		n<<4&0x010)
+}
+
+// waveform returns the 12-bit output of the oscillator. When more than one
+// waveform is selected, the outputs are combined with a logical and.
+func (v *voice) waveform(source *voice) uint16 {
+	if v.control&0xf0 == 0 {
+		return 0
+	}
+	out := uint16(0xfff)
+	if v.control&ctrlTriangle != 0 {
+		msb := v.acc & 0x800000
+		if v.control&ctrlRing != 0 {
+			msb ^= source.acc & 0x800000
+		}
+		tri := v.acc << 1 & 0xffffff
+		if msb != 0 {
+			tri ^= 0xffffff
+		}
+		out &= uint16(tri >> 12)
+	}
+	if v.control&ctrlSawtooth != 0 {
+		out &= uint16(v.acc >> 12)
+	}
+	if v.control&ctrlPulse != 0 {
+		if v.control&ctrlTest == 0 && uint16(v.acc>>12) < v.pw {
+			out = 0
+		}
+	}
+	if v.control&ctrlNoise != 0 {
+		out &= v.noiseOutput()
+	}
+	return out
+}
+
+// output is the signed waveform scaled by the envelope.
+func (v *voice) output(source *voice) int32 {
+	return (int32(v.waveform(source)) - 0x800) * int32(v.envelope.counter)
+}
+
+type sidFilter struct {
+	lp float64
+	bp float64
+	hp float64
+}
+
+// SID is the MOS Technology 6581/8580 Sound Interface Device. The SID is
+// mapped into the I/O area at $d400 and is mirrored every 32 bytes through
+// $d7ff.
+type SID struct {
+	Model      SIDModel
+	ClockRate  int
+	SampleRate int
+	voices     [3]voice
+	cutoff     uint16
+	resonance  uint8
+	routing    uint8
+	mode       uint8
+	volume     uint8
+	filter     sidFilter
+	phase      int
+	sums       [3]int64
+	sumCycles  int
+}
+
+func NewSID(model SIDModel) *SID {
+	s := &SID{
+		Model:      model,
+		ClockRate:  ClockRateNTSC,
+		SampleRate: 44100,
+	}
+	s.Reset()
+	return s
+}
+
+func (s *SID) Reset() {
+	for i := range s.voices {
+		s.voices[i] = voice{noise: 0x7ffff8}
+		s.voices[i].envelope.updateExpPeriod()
+	}
+	s.cutoff = 0
+	s.resonance = 0
+	s.routing = 0
+	s.mode = 0
+	s.volume = 0
+	s.filter = sidFilter{}
+}
+
+func (s *SID) state(c *stateCodec) {
+	for i := range s.voices {
+		v := &s.voices[i]
+		e := &v.envelope
+		state := int(e.state)
+		c.fields(&v.freq, &v.pw, &v.control, &v.acc, &v.noise, &v.msbRose)
+		c.fields(&state, &e.counter, &e.rate, &e.exp, &e.expPeriod)
+		c.fields(&e.attack, &e.decay, &e.sustain, &e.release, &e.gateActive)
+		e.state = envState(state)
+	}
+	c.fields(&s.cutoff, &s.resonance, &s.routing, &s.mode, &s.volume)
+	c.fields(&s.filter.lp, &s.filter.bp, &s.filter.hp)
+	c.fields(&s.phase, &s.sums, &s.sumCycles)
+}
+
+func (s *SID) Load(address uint16) uint8 {
+	switch address & 0x1f {
+	case sidPotX, sidPotY:
+		return 0xff // no paddles connected
+	case sidOsc3:
+		return uint8(s.voices[2].waveform(&s.voices[1]) >> 4)
+	case sidEnv3:
+		return s.voices[2].envelope.counter
+	}
+	return 0
+}
+
+func (s *SID) Store(address uint16, value uint8) {
+	reg := address & 0x1f
+	if reg < sidFilterCutoffLo {
+		s.storeVoice(&s.voices[reg/7], reg%7, value)
+		return
+	}
+	switch reg {
+	case sidFilterCutoffLo:
+		s.cutoff = s.cutoff&0x7f8 | uint16(value&0x07)
+	case sidFilterCutoffHi:
+		s.cutoff = uint16(value)<<3 | s.cutoff&0x07
+	case sidFilterControl:
+		s.resonance = value >> 4
+		s.routing = value & 0x0f
+	case sidModeVolume:
+		s.mode = value & 0xf0
+		s.volume = value & 0x0f
+	}
+}
+
+func (s *SID) storeVoice(v *voice, reg uint16, value uint8) {
+	switch reg {
+	case 0:
+		v.freq = v.freq&0xff00 | uint16(value)
+	case 1:
+		v.freq = uint16(value)<<8 | v.freq&0x00ff
+	case 2:
+		v.pw = v.pw&0xf00 | uint16(value)
+	case 3:
+		v.pw = uint16(value&0x0f)<<8 | v.pw&0x0ff
+	case 4:
+		if value&ctrlTest != 0 {
+			v.acc = 0
+			v.noise = 0x7ffff8
+		}
+		v.control = value
+		v.envelope.gate(value&ctrlGate != 0)
+	case 5:
+		v.envelope.attack = value >> 4
+		v.envelope.decay = value & 0x0f
+	case 6:
+		v.envelope.sustain = value >> 4
+		v.envelope.release = value & 0x0f
+	}
+}
+
+// Clock advances the chip by one cycle.
+func (s *SID) Clock() {
+	for i := range s.voices {
+		s.voices[i].clock()
+		s.voices[i].envelope.clock()
+	}
+	// Hard sync resets the accumulator when the accumulator of the
+	// previous voice crosses over.
+	for i := range s.voices {
+		v := &s.voices[i]
+		if v.control&ctrlSync != 0 && s.voices[(i+2)%3].msbRose {
+			v.acc = 0
+		}
+	}
+}
+
+// Render clocks the chip for the amount of time covered by the samples and
+// fills them in with the mixed output.
+func (s *SID) Render(samples []int16) {
+	for i := range samples {
+		for {
+			if sample, ok := s.tick(); ok {
+				samples[i] = sample
+				break
+			}
+		}
+	}
+}
+
+// Step clocks the chip for the number of cycles given and appends the
+// samples that were completed to out.
+func (s *SID) Step(cycles int, out []int16) []int16 {
+	for i := 0; i < cycles; i++ {
+		if sample, ok := s.tick(); ok {
+			out = append(out, sample)
+		}
+	}
+	return out
+}
+
+// tick clocks the chip for one cycle and returns a sample when enough
+// cycles have passed for one at the sample rate. The voice outputs are
+// averaged over all the cycles in the sample.
+func (s *SID) tick() (int16, bool) {
+	s.Clock()
+	for i := range s.voices {
+		s.sums[i] += int64(s.voices[i].output(&s.voices[(i+2)%3]))
+	}
+	s.sumCycles++
+	s.phase += s.SampleRate
+	if s.phase < s.ClockRate {
+		return 0, false
+	}
+	s.phase -= s.ClockRate
+	var outputs [3]float64
+	for i := range outputs {
+		outputs[i] = float64(s.sums[i]) / float64(s.sumCycles)
+		s.sums[i] = 0
+	}
+	s.sumCycles = 0
+	return s.mix(outputs), true
+}
+
+func (s *SID) mix(outputs [3]float64) int16 {
+	direct, filtered := 0.0, 0.0
+	for i, out := range outputs {
+		switch {
+		case s.routing&(1<<uint(i)) != 0:
+			filtered += out
+		case i == 2 && s.mode&mode3Off != 0:
+		default:
+			direct += out
+		}
+	}
+	f := &s.filter
+	fc := 2 * math.Sin(math.Pi*s.cutoffFreq()/float64(s.SampleRate))
+	if fc > 1 {
+		fc = 1
+	}
+	f.hp = filtered - f.lp - s.damping()*f.bp
+	f.bp += fc * f.hp
+	f.lp += fc * f.bp
+
+	out := direct
+	if s.mode&modeLowPass != 0 {
+		out += f.lp
+	}
+	if s.mode&modeBandPass != 0 {
+		out += f.bp
+	}
+	if s.mode&modeHighPass != 0 {
+		out += f.hp
+	}
+	// The 6581 has a DC offset in the mixer that makes changes to the
+	// volume audible. This is how samples are played on the older chip.
+	if s.Model == SID6581 {
+		out += 0x300 * 0xff
+	}
+	out = out * float64(s.volume) / 15
+	// Three voices at full scale are 3 * 0x800 * 0xff
+	out = out / (3 * 0x800 * 0xff) * 32767
+	switch {
+	case out > 32767:
+		out = 32767
+	case out < -32768:
+		out = -32768
+	}
+	return int16(out)
+}
+
+// cutoffFreq approximates the filter cutoff in Hz. The 8580 is close to
+// linear while the 6581 has a curve that stays low for most of the lower
+// register values.
+func (s *SID) cutoffFreq() float64 {
+	fc := float64(s.cutoff) / 0x7ff
+	if s.Model == SID8580 {
+		return 30 + fc*12000
+	}
+	return 220 + fc*fc*fc*17800
+}
+
+func (s *SID) damping() float64 {
+	max := 1.0
+	if s.Model == SID8580 {
+		max = 1.2
+	}
+	return 1.41 - float64(s.resonance)/15*max
+}
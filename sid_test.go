@@ -0,0 +1,132 @@
+package mach85
+
+import (
+	"testing"
+)
+
+func TestSIDEnvelopeAttack(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd40c, 0x00)                  // voice 3 attack 2ms, decay 6ms
+	sid.Store(0xd40d, 0xf0)                  // voice 3 sustain max
+	sid.Store(0xd412, ctrlGate|ctrlSawtooth) // voice 3 gate on
+	for i := 0; i < 9*0xff; i++ {
+		sid.Clock()
+	}
+	want := uint8(0xff)
+	have := sid.Load(0xd41c)
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x \n", want, have)
+	}
+}
+
+func TestSIDEnvelopeRelease(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd412, ctrlGate|ctrlSawtooth)
+	for i := 0; i < 9*0xff; i++ {
+		sid.Clock()
+	}
+	sid.Store(0xd412, ctrlSawtooth) // gate off, release 6ms
+	for i := 0; i < 20000; i++ {
+		sid.Clock()
+	}
+	want := uint8(0x00)
+	have := sid.Load(0xd41c)
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x \n", want, have)
+	}
+}
+
+func TestSIDEnvelopeSustain(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd414, 0x80) // voice 3 sustain at level 8
+	sid.Store(0xd412, ctrlGate|ctrlSawtooth)
+	for i := 0; i < 100000; i++ {
+		sid.Clock()
+	}
+	want := uint8(0x88)
+	have := sid.Load(0xd41c)
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x \n", want, have)
+	}
+}
+
+func TestSIDOscillator3(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd40e, 0x00)
+	sid.Store(0xd40f, 0x10) // frequency $1000
+	sid.Store(0xd412, ctrlSawtooth)
+	for i := 0; i < 0x80; i++ {
+		sid.Clock()
+	}
+	// $1000 * $80 = $080000
+	want := uint8(0x08)
+	have := sid.Load(0xd41b)
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x \n", want, have)
+	}
+}
+
+func TestSIDTestBit(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd40f, 0x10)
+	sid.Store(0xd412, ctrlSawtooth)
+	for i := 0; i < 0x80; i++ {
+		sid.Clock()
+	}
+	sid.Store(0xd412, ctrlSawtooth|ctrlTest)
+	sid.Clock()
+	want := uint8(0x00)
+	have := sid.Load(0xd41b)
+	if want != have {
+		t.Errorf("\n want: %02x \n have: %02x \n", want, have)
+	}
+}
+
+func TestSIDMirrored(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd7f2, ctrlGate) // mirror of $d412
+	sid.Clock()
+	if !sid.voices[2].envelope.gateActive {
+		t.Errorf("gate not set through mirror")
+	}
+}
+
+func TestSIDRender(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd418, 0x0f) // volume max
+	sid.Store(0xd400, 0x00)
+	sid.Store(0xd401, 0x1c) // about 440 Hz
+	sid.Store(0xd402, 0x00)
+	sid.Store(0xd403, 0x08) // 50% duty cycle
+	sid.Store(0xd406, 0xf0) // sustain max
+	sid.Store(0xd404, ctrlGate|ctrlPulse)
+
+	samples := make([]int16, sid.SampleRate/10)
+	sid.Render(samples)
+	min, max := int16(0), int16(0)
+	for _, s := range samples {
+		if s < min {
+			min = s
+		}
+		if s > max {
+			max = s
+		}
+	}
+	if min > -8000 || max < 8000 {
+		t.Errorf("expected square wave, have range %v to %v", min, max)
+	}
+}
+
+func TestSIDRenderSilent(t *testing.T) {
+	sid := NewSID(SID8580)
+	sid.Store(0xd418, 0x00)
+	sid.Store(0xd401, 0x1c)
+	sid.Store(0xd404, ctrlGate|ctrlSawtooth)
+	samples := make([]int16, 1000)
+	sid.Render(samples)
+	for i, s := range samples {
+		if s != 0 {
+			t.Fatalf("sample %v: want 0, have %v", i, s)
+		}
+	}
+}
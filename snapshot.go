@@ -0,0 +1,292 @@
+package mach85
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	snapshotMagic   = "MACH85SNAP"
+	snapshotVersion = 1
+	chunkNameLen    = 8
+)
+
+// stateCodec saves or restores the fields of a component. Components
+// list their fields once, in the same order, for both.
+type stateCodec struct {
+	buf     *bytes.Buffer
+	restore bool
+	err     error
+}
+
+// fields encodes or decodes the values pointed to. Values must be fixed
+// size or an int, which is stored as 64 bits. Slices must already have
+// the length being restored.
+func (s *stateCodec) fields(ptrs ...interface{}) {
+	for _, p := range ptrs {
+		if s.err != nil {
+			return
+		}
+		if v, ok := p.(*int); ok {
+			x := int64(*v)
+			s.field(&x)
+			*v = int(x)
+			continue
+		}
+		s.field(p)
+	}
+}
+
+func (s *stateCodec) field(p interface{}) {
+	if s.restore {
+		s.err = binary.Read(s.buf, binary.LittleEndian, p)
+	} else {
+		s.err = binary.Write(s.buf, binary.LittleEndian, p)
+	}
+}
+
+// snapshotChunk is the state of a component stored under a name.
+type snapshotChunk struct {
+	name  string
+	state func(*stateCodec)
+}
+
+// profileState saves the name of the machine, which is checked by
+// restore before anything else.
+func (m *Mach85) profileState(s *stateCodec) {
+	if !s.restore {
+		s.fields([]uint8(m.profile.Name))
+	}
+}
+
+// snapshotChunks returns the components of the machine as it is
+// currently configured.
+func (m *Mach85) snapshotChunks() []snapshotChunk {
+	chunks := []snapshotChunk{
+		{"MACHINE", m.profileState},
+		{"CPU", m.cpu.state},
+	}
+	switch mem := m.Memory.Base.(type) {
+	case *Memory64:
+		chunks = append(chunks, snapshotChunk{"MEMORY", mem.state})
+	case *MappedMemory:
+		chunks = append(chunks, snapshotChunk{"MEMORY", mem.state})
+	}
+	if m.SID != nil {
+		chunks = append(chunks, snapshotChunk{"SID", m.SID.state})
+	}
+	if m.clock != nil {
+		chunks = append(chunks, snapshotChunk{"CLOCK", m.clock.state})
+	}
+	if m.video != nil {
+		chunks = append(chunks, snapshotChunk{"VIDEO", m.video.state})
+	}
+	if m.audio != nil {
+		chunks = append(chunks, snapshotChunk{"AUDIO", m.audio.state})
+	}
+	if m.cia1 != nil {
+		chunks = append(chunks,
+			snapshotChunk{"CIA1", m.cia1.state},
+			snapshotChunk{"CIA2", m.cia2.state},
+		)
+	}
+	if m.cart != nil {
+		chunks = append(chunks, snapshotChunk{"CART", m.cart.state})
+	}
+	if m.reu != nil {
+		chunks = append(chunks, snapshotChunk{"REU", m.reu.state})
+	}
+	if m.tape != nil {
+		chunks = append(chunks, snapshotChunk{"TAPE", m.tape.state})
+	}
+	var devices []int
+	for device := range m.trueDrives {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+	for _, device := range devices {
+		name := fmt.Sprintf("DRIVE%v", device)
+		chunks = append(chunks, snapshotChunk{name, m.trueDrives[device].state})
+	}
+	return chunks
+}
+
+// snapshot returns the state of the CPU, memory and devices.
+func (m *Mach85) snapshot() ([]uint8, error) {
+	var out bytes.Buffer
+	out.WriteString(snapshotMagic)
+	binary.Write(&out, binary.LittleEndian, uint16(snapshotVersion))
+	for _, chunk := range m.snapshotChunks() {
+		s := &stateCodec{buf: &bytes.Buffer{}}
+		chunk.state(s)
+		if s.err != nil {
+			return nil, fmt.Errorf("%v: %v", chunk.name, s.err)
+		}
+		name := make([]uint8, chunkNameLen)
+		copy(name, chunk.name)
+		out.Write(name)
+		binary.Write(&out, binary.LittleEndian, uint32(s.buf.Len()))
+		out.Write(s.buf.Bytes())
+	}
+	return out.Bytes(), nil
+}
+
+// SaveSnapshot writes the state of the CPU, memory and devices to a file.
+// Media such as disk images and cartridge ROMs are not included and must
+// be attached again before the snapshot is loaded.
+func (m *Mach85) SaveSnapshot(filename string) error {
+	for _, d := range m.trueDrives {
+		if err := d.Flush(); err != nil {
+			return err
+		}
+	}
+	data, err := m.snapshot()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+func parseSnapshot(data []uint8) (map[string][]uint8, error) {
+	in := bytes.NewReader(data)
+	magic := make([]uint8, len(snapshotMagic))
+	var version uint16
+	if _, err := io.ReadFull(in, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, errors.New("not a snapshot file")
+	}
+	if err := binary.Read(in, binary.LittleEndian, &version); err != nil {
+		return nil, errors.New("truncated snapshot")
+	}
+	if version > snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %v", version)
+	}
+	chunks := map[string][]uint8{}
+	for {
+		name := make([]uint8, chunkNameLen)
+		if _, err := io.ReadFull(in, name); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.New("truncated snapshot")
+		}
+		var n uint32
+		if err := binary.Read(in, binary.LittleEndian, &n); err != nil {
+			return nil, errors.New("truncated snapshot")
+		}
+		data := make([]uint8, n)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return nil, errors.New("truncated snapshot")
+		}
+		chunks[strings.TrimRight(string(name), "\x00")] = data
+	}
+	return chunks, nil
+}
+
+// LoadSnapshot restores the state saved in a file. Devices in the
+// snapshot that hold media must already be attached. An REU and the CIAs
+// are added if needed while other devices that are missing are skipped.
+func (m *Mach85) LoadSnapshot(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := m.restore(data); err != nil {
+		return err
+	}
+	if m.rewind != nil {
+		m.rewind.clear(m.cpu.Cycles)
+	}
+	return nil
+}
+
+// restore returns the machine to the state returned by snapshot.
+func (m *Mach85) restore(data []uint8) error {
+	chunks, err := parseSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if name, ok := chunks["MACHINE"]; ok && string(name) != m.profile.Name {
+		return fmt.Errorf("snapshot is for the %s", name)
+	}
+	present := map[string]bool{}
+	for _, chunk := range m.snapshotChunks() {
+		present[chunk.name] = true
+	}
+	for name := range chunks {
+		// Video and audio output may be missing when running headless
+		media := name == "CART" || name == "TAPE" || strings.HasPrefix(name, "DRIVE")
+		if media && !present[name] {
+			return fmt.Errorf("snapshot needs a device that is not attached: %v", strings.ToLower(name))
+		}
+	}
+	// Chunks are checked against the size of the current state before any
+	// is applied so that a bad snapshot leaves the machine as it was. An
+	// REU of the size saved and the CIAs are checked before they are added.
+	reu := m.reu
+	if data, ok := chunks["REU"]; ok {
+		if len(data) < 8 {
+			return errors.New("REU: invalid length")
+		}
+		size := int(binary.LittleEndian.Uint64(data))
+		if reu == nil || reu.Size != size {
+			if reu, err = m.newREU(size); err != nil {
+				return err
+			}
+		}
+	}
+	states := map[string]func(*stateCodec){}
+	for _, chunk := range m.snapshotChunks() {
+		states[chunk.name] = chunk.state
+	}
+	if reu != nil {
+		states["REU"] = reu.state
+	}
+	if m.cia1 == nil {
+		states["CIA1"] = NewCIA(m.cpu).state
+		states["CIA2"] = NewCIA(m.cpu).state
+	}
+	for name, data := range chunks {
+		state, ok := states[name]
+		if !ok {
+			continue
+		}
+		s := &stateCodec{buf: &bytes.Buffer{}}
+		state(s)
+		if s.err == nil && s.buf.Len() != len(data) {
+			return fmt.Errorf("%v: invalid length", name)
+		}
+	}
+	if reu != m.reu {
+		m.attachREU(reu)
+	}
+	if _, ok := chunks["CIA1"]; ok {
+		m.initCIAs()
+	}
+	for _, chunk := range m.snapshotChunks() {
+		data, ok := chunks[chunk.name]
+		if !ok {
+			continue
+		}
+		s := &stateCodec{buf: bytes.NewBuffer(data), restore: true}
+		chunk.state(s)
+		if s.err != nil {
+			return fmt.Errorf("%v: %v", chunk.name, s.err)
+		}
+	}
+	// A snapshot taken before the CIAs were connected to the IRQ line
+	// uses the jiffy clock
+	if _, ok := chunks["CIA1"]; ok && m.cia1.Interrupts {
+		m.RemoveDevice(m.clock)
+	} else {
+		m.useJiffyClock()
+	}
+	if m.recorder != nil {
+		m.recorder.restart()
+	}
+	return nil
+}
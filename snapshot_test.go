@@ -0,0 +1,203 @@
+package mach85
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func tempSnapshot(t *testing.T) string {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return file.Name()
+}
+
+func TestSnapshot(t *testing.T) {
+	name := tempSnapshot(t)
+	defer os.Remove(name)
+	mach := New()
+	mach.InitSID(SID6581)
+	mach.initCIAs()
+	if err := mach.AttachREU(256); err != nil {
+		t.Fatal(err)
+	}
+	mach.cpu.PC, mach.cpu.A, mach.cpu.SP, mach.cpu.C = 0xc000, 0x12, 0xf0, true
+	mach.Memory.StoreN(0xc000, 1, 2, 3)
+	mach.Memory.Store(0xd020, 0x06)
+	mach.Memory.Store(0xd418, 0x0f)
+	mach.Memory.Store16(0xdc04, 0x1234)
+	mach.reu.ram[0x3ffff] = 0xaa
+	mem64 := mach.Memory.Base.(*Memory64)
+	mem64.SetMode(30)
+	if err := mach.SaveSnapshot(name); err != nil {
+		t.Fatal(err)
+	}
+
+	other := New()
+	other.InitSID(SID6581)
+	if err := other.LoadSnapshot(name); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want interface{}
+		have interface{}
+	}{
+		{"pc", mach.cpu.PC, other.cpu.PC},
+		{"a", mach.cpu.A, other.cpu.A},
+		{"sp", mach.cpu.SP, other.cpu.SP},
+		{"c", mach.cpu.C, other.cpu.C},
+		{"ram", uint8(3), other.Memory.Load(0xc002)},
+		{"mode", uint8(30), other.Memory.Base.(*Memory64).Mode()},
+		{"vic", uint8(0x06), other.Memory.Load(0xd020)},
+		{"sid", uint8(0x0f), other.SID.volume},
+		{"cia", uint16(0x1234), other.cia1.taLatch},
+		{"reu size", 256, other.reu.Size},
+		{"reu ram", uint8(0xaa), other.reu.ram[0x3ffff]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !reflect.DeepEqual(test.want, test.have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, test.have)
+			}
+		})
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	name := tempSnapshot(t)
+	defer os.Remove(name)
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"magic", "MACH84SNAP\x01\x00", "not a snapshot file"},
+		{"version", snapshotMagic + "\x02\x00", "unsupported snapshot version: 2"},
+		{"truncated", snapshotMagic + "\x01\x00CPU\x00\x00\x00\x00\x00\x10\x00\x00\x00", "truncated snapshot"},
+		{"device", snapshotMagic + "\x01\x00TAPE\x00\x00\x00\x00\x00\x00\x00\x00", "snapshot needs a device that is not attached: tape"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ioutil.WriteFile(name, []uint8(test.data), 0644)
+			err := New().LoadSnapshot(name)
+			if err == nil || err.Error() != test.want {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, err)
+			}
+		})
+	}
+}
+
+func TestSnapshotCmd(t *testing.T) {
+	name := tempSnapshot(t)
+	defer os.Remove(name)
+	mon, out := newTestMonitor()
+	mon.mach.Memory.Store(0xc000, 0x42)
+	testMonitorParse(mon, "snap save "+name+" \n p c000 0 \n snap load "+name+" \n p c000 \n snap foo bar")
+	want := []string{"$42 +66", "invalid snapshot command: foo"}
+	have := testLines(t, out, 2)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+// testSnapshotData puts the chunks named back together into a snapshot.
+func testSnapshotData(chunks map[string][]uint8, names ...string) []uint8 {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	binary.Write(&buf, binary.LittleEndian, uint16(snapshotVersion))
+	for _, name := range names {
+		data := chunks[name]
+		chunkName := make([]uint8, chunkNameLen)
+		copy(chunkName, name)
+		buf.Write(chunkName)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+func TestSnapshotInvalidLength(t *testing.T) {
+	mach := New()
+	mach.cpu.A = 0x12
+	data, err := mach.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := parseSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks["MEMORY"] = chunks["MEMORY"][:0x10]
+	other := New()
+	err = other.restore(testSnapshotData(chunks, "CPU", "MEMORY"))
+	if err == nil || err.Error() != "MEMORY: invalid length" {
+		t.Errorf("\n want: %v \n have: %v \n", "MEMORY: invalid length", err)
+	}
+	if other.cpu.A != 0 {
+		t.Errorf("cpu restored from an invalid snapshot")
+	}
+}
+
+func TestSnapshotInvalidREU(t *testing.T) {
+	mach := New()
+	mach.initCIAs()
+	if err := mach.AttachREU(256); err != nil {
+		t.Fatal(err)
+	}
+	data, err := mach.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := parseSnapshot(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks["REU"] = chunks["REU"][:0x10]
+	other := New()
+	if err := other.AttachREU(128); err != nil {
+		t.Fatal(err)
+	}
+	reu := other.REU()
+	reu.ram[0] = 0xaa
+	err = other.restore(testSnapshotData(chunks, "CPU", "CIA1", "CIA2", "REU"))
+	if err == nil || err.Error() != "REU: invalid length" {
+		t.Errorf("\n want: %v \n have: %v \n", "REU: invalid length", err)
+	}
+	if other.REU() != reu || reu.ram[0] != 0xaa {
+		t.Errorf("REU replaced by an invalid snapshot")
+	}
+	if other.cia1 != nil {
+		t.Errorf("CIAs added by an invalid snapshot")
+	}
+}
+
+func TestSnapshotJiffyClock(t *testing.T) {
+	mach := New()
+	mach.clock = NewJiffyClock(mach.cpu)
+	mach.AddDevice(mach.clock)
+	data, err := mach.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As when a TAP is attached
+	mach.useCIAInterrupts()
+	if err := mach.restore(data); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, d := range mach.devices {
+		if d == mach.clock {
+			found = true
+		}
+	}
+	if !found || mach.cia1.Interrupts {
+		t.Errorf("jiffy clock not used after restore")
+	}
+}
@@ -0,0 +1,101 @@
+package mach85
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var subroutines = []struct {
+	address uint16
+	code    []uint8
+}{
+	{0x0800, []uint8{
+		0x20, 0x10, 0x08, // $0800: jsr $0810
+		0xe8,             // $0803: inx
+		0x4c, 0x04, 0x08, // $0804: jmp $0804
+	}},
+	{0x0810, []uint8{
+		0x20, 0x20, 0x08, // $0810: jsr $0820
+		0xc8, // $0813: iny
+		0x60, // $0814: rts
+	}},
+	{0x0820, []uint8{
+		0xa9, 0x01, // $0820: lda #$01
+		0x60, // $0822: rts
+	}},
+}
+
+func TestStepCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmds   string
+		status Status
+		pc     uint16
+		y      uint8
+		out    []string
+	}{
+		{"step", "s", Breakpoint, 0x0804, 1, []string{
+			"$0800: 20 10 08  jsr $0810",
+		}},
+		{"step count", "s 3", Breakpoint, 0x0804, 1, []string{
+			"$0800: 20 10 08  jsr $0810",
+			"$0810: 20 20 08  jsr $0820",
+			"$0820: a9 01     lda #$01",
+		}},
+		{"step over", "so", Halt, 0x0803, 1, []string{
+			"$0800: 20 10 08  jsr $0810",
+		}},
+		{"step over nested", "s \n so", Halt, 0x0813, 0, []string{
+			"$0800: 20 10 08  jsr $0810",
+			"$0810: 20 20 08  jsr $0820",
+		}},
+		{"step over other", "s 2 \n so", Breakpoint, 0x0804, 1, []string{
+			"$0800: 20 10 08  jsr $0810",
+			"$0810: 20 20 08  jsr $0820",
+			"$0820: a9 01     lda #$01",
+		}},
+		{"out", "s \n out", Halt, 0x0803, 1, []string{
+			"$0800: 20 10 08  jsr $0810",
+			"$0810: 20 20 08  jsr $0820",
+		}},
+		{"out nested", "s 2 \n out", Halt, 0x0813, 0, []string{
+			"$0800: 20 10 08  jsr $0810",
+			"$0810: 20 20 08  jsr $0820",
+			"$0820: a9 01     lda #$01",
+		}},
+		{"until", "until 0813", Halt, 0x0813, 0, []string{
+			"$0800: 20 10 08  jsr $0810",
+		}},
+		{"invalid count", "s 0", Breakpoint, 0x0804, 1, []string{
+			"invalid count: 0",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mon, out := newTestMonitor()
+			for _, s := range subroutines {
+				mon.mach.Memory.StoreN(s.address, s.code...)
+			}
+			// Where the test machine stops when only stepping as it is
+			// always started after the commands
+			mon.mach.Breakpoints[0x0804] = NewBreakpointInfo(0x0804)
+			testMonitorParse(mon, test.cmds)
+			mon.mach.Start()
+			mon.mach.Run()
+			have := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if !reflect.DeepEqual(test.out, have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.out, have)
+			}
+			if mon.mach.Status != test.status {
+				t.Errorf("\n want: %v \n have: %v \n", test.status, mon.mach.Status)
+			}
+			if mon.cpu.PC+1 != test.pc {
+				t.Errorf("\n want: %04x \n have: %04x \n", test.pc, mon.cpu.PC+1)
+			}
+			if mon.cpu.Y != test.y {
+				t.Errorf("\n want: %v \n have: %v \n", test.y, mon.cpu.Y)
+			}
+		})
+	}
+}
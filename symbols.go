@@ -0,0 +1,120 @@
+package mach85
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Lines in the symbol files that are understood:
+//
+//	al C:ffd2 .CHROUT            VICE label file
+//	sym id=0,name="CHROUT",...   ca65/ld65 debug file
+//	.label CHROUT=$ffd2          KickAssembler symbol file
+//	CHROUT = $ffd2               ACME symbol list and asm85
+var (
+	viceSymbol     = regexp.MustCompile(`^al\s+(?:C:)?([0-9A-Fa-f]+)\s+\.?(\S+)$`)
+	kickSymbol     = regexp.MustCompile(`^\.(?:label|const|var)\s+(\S+?)\s*=\s*(\S+)$`)
+	assignedSymbol = regexp.MustCompile(`^([A-Za-z_.@][\w.@]*)\s*=\s*(\S+)`)
+)
+
+// LoadSymbols reads a file of symbols in any of the formats above. Other
+// lines in a ca65 debug file are ignored.
+func LoadSymbols(filename string) (*Source, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	source, err := ParseSymbols(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return source, nil
+}
+
+func ParseSymbols(r io.Reader) (*Source, error) {
+	source := NewSource()
+	scanner := bufio.NewScanner(r)
+	debugFile := false
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 1 && strings.HasPrefix(line, "version") {
+			debugFile = true
+		}
+		if debugFile {
+			if err := parseDebugSymbol(source, line); err != nil {
+				return nil, fmt.Errorf("line %v: %v", n, err)
+			}
+			continue
+		}
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		var name, value string
+		if m := viceSymbol.FindStringSubmatch(line); m != nil {
+			name, value = m[2], "$"+m[1]
+		} else if m := kickSymbol.FindStringSubmatch(line); m != nil {
+			name, value = m[1], m[2]
+		} else if m := assignedSymbol.FindStringSubmatch(line); m != nil {
+			name, value = m[1], m[2]
+		} else {
+			return nil, fmt.Errorf("line %v: invalid symbol: %v", n, line)
+		}
+		address, err := parseSymbolValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", n, err)
+		}
+		source.Symbols[name] = address
+	}
+	return source, scanner.Err()
+}
+
+// parseDebugSymbol adds the value of a sym line from a ca65 debug file.
+// Imports have no value and are skipped.
+func parseDebugSymbol(source *Source, line string) error {
+	if !strings.HasPrefix(line, "sym") {
+		return nil
+	}
+	attrs := map[string]string{}
+	for _, attr := range strings.Split(strings.TrimSpace(line[3:]), ",") {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) == 2 {
+			attrs[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	if attrs["name"] == "" || attrs["val"] == "" {
+		return nil
+	}
+	address, err := parseSymbolValue(attrs["val"])
+	if err != nil {
+		return err
+	}
+	source.Symbols[attrs["name"]] = address
+	return nil
+}
+
+// parseSymbolValue reads a value that is hex with a $ or 0x prefix or
+// decimal otherwise.
+func parseSymbolValue(str string) (uint16, error) {
+	base := 10
+	digits := str
+	switch {
+	case strings.HasPrefix(str, "$"):
+		digits, base = str[1:], 16
+	case strings.HasPrefix(str, "0x"), strings.HasPrefix(str, "0X"):
+		digits, base = str[2:], 16
+	}
+	value, err := strconv.ParseUint(digits, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address: %v", str)
+	}
+	return uint16(value), nil
+}
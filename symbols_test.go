@@ -0,0 +1,182 @@
+package mach85
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSymbols(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want map[string]uint16
+	}{
+		{"vice", "al C:ffd2 .CHROUT\nal C:0801 .start\n", map[string]uint16{
+			"CHROUT": 0xffd2,
+			"start":  0x0801,
+		}},
+		{"ca65", "version\tmajor=2,minor=0\n" +
+			"file\tid=0,name=\"hello.s\",size=100,mtime=0x5c8b2f2a,mod=0\n" +
+			"sym\tid=0,name=\"CHROUT\",addrsize=absolute,scope=0,def=1,val=0xFFD2,type=equ\n" +
+			"sym\tid=1,name=\"start\",addrsize=absolute,size=1,scope=0,def=2,val=0x801,seg=0,type=lab\n" +
+			"sym\tid=2,name=\"other\",addrsize=absolute,scope=0,def=3,type=imp\n",
+			map[string]uint16{
+				"CHROUT": 0xffd2,
+				"start":  0x0801,
+			}},
+		{"kickass", ".label CHROUT=$ffd2\n.const COUNT=10\n", map[string]uint16{
+			"CHROUT": 0xffd2,
+			"COUNT":  10,
+		}},
+		{"acme", "; symbols\n\tCHROUT\t= $ffd2\n\tcount\t= 10 ; decimal\n", map[string]uint16{
+			"CHROUT": 0xffd2,
+			"count":  10,
+		}},
+		{"asm85", "CHROUT           = $ffd2\nstart            = $0801\n", map[string]uint16{
+			"CHROUT": 0xffd2,
+			"start":  0x0801,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := ParseSymbols(strings.NewReader(test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			have := source.Symbols
+			if !reflect.DeepEqual(test.want, have) {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestParseSymbolsError(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"CHROUT = $ffd2\nfoo bar\n", "line 2: invalid symbol: foo bar"},
+		{"CHROUT = $10000\n", "line 1: invalid address: $10000"},
+		{"al C:xyz .CHROUT\n", "line 1: invalid symbol: al C:xyz .CHROUT"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			_, err := ParseSymbols(strings.NewReader(test.file))
+			have := ""
+			if err != nil {
+				have = err.Error()
+			}
+			if test.want != have {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestDisassemblerSymbols(t *testing.T) {
+	tests := []struct {
+		bytes []uint8
+		want  string
+	}{
+		{[]uint8{0x20, 0xd2, 0xff}, "$1234: 20 d2 ff  jsr CHROUT"},
+		{[]uint8{0xbd, 0x00, 0xc0}, "$1234: bd 00 c0  lda table,x"},
+		{[]uint8{0x6c, 0x01, 0xc0}, "$1234: 6c 01 c0  jmp (table+1)"},
+		{[]uint8{0xb1, 0xfb}, "$1234: b1 fb     lda (ptr),y"},
+		{[]uint8{0xd0, 0x0a}, "$1234: d0 0a     bne loop"},
+		{[]uint8{0xa9, 0xfb}, "$1234: a9 fb     lda #$fb"},
+		{[]uint8{0x8d, 0x00, 0xd0}, "$1234: 8d 00 d0  sta $d000"},
+	}
+	symbols := map[string]uint16{
+		"CHROUT": 0xffd2,
+		"table":  0xc000,
+		"ptr":    0xfb,
+		"loop":   0x1240,
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			mem := NewMemory(NewRAM(0x10000))
+			mem.StoreN(0x1234, test.bytes...)
+			d := NewDisassembler(mem)
+			d.LoadSource(&Source{Symbols: symbols})
+			d.PC = 0x1233
+			have := d.Next().String()
+			if test.want != have {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestSymbolDuplicates(t *testing.T) {
+	d := NewDisassembler(NewMemory(NewRAM(0x10000)))
+	d.LoadSource(&Source{Symbols: map[string]uint16{"b": 0xffd2, "a": 0xffd2, "c": 0xffd2}})
+	want := "a"
+	have := d.Name(0xffd2)
+	if want != have {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+func TestSymbolCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.Disassembler.LoadSource(&Source{Symbols: map[string]uint16{
+		"start": 0x0800,
+		"loop":  0x0801,
+	}})
+	mon.mach.Memory.StoreN(0x0800, 0xea, 0xea, 0xea) // nop
+	testMonitorParse(mon, "sym loop \n sym 0801 \n sym foo \n b loop on")
+	mon.mach.Start()
+	mon.mach.Run()
+	want := []string{
+		"$0801",
+		"loop",
+		"unknown symbol: foo",
+	}
+	have := testLines(t, out, 3)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+	if mon.cpu.PC != 0x0800 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0x0800, mon.cpu.PC)
+	}
+}
+
+func TestC64Symbols(t *testing.T) {
+	tests := []struct {
+		bytes []uint8
+		want  string
+	}{
+		{[]uint8{0x20, 0xd2, 0xff}, "$1234: 20 d2 ff  jsr CHROUT"},
+		{[]uint8{0x20, 0x9f, 0xff}, "$1234: 20 9f ff  jsr SCNKEY"},
+		{[]uint8{0xad, 0x12, 0xd0}, "$1234: ad 12 d0  lda VIC_RASTER"},
+		{[]uint8{0xa5, 0xc6}, "$1234: a5 c6     lda NDX"},
+		{[]uint8{0x6c, 0x15, 0x03}, "$1234: 6c 15 03  jmp (CINV+1)"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			mem := NewMemory(NewRAM(0x10000))
+			mem.StoreN(0x1234, test.bytes...)
+			d := NewDisassembler(mem)
+			d.LoadSource(&Source{Symbols: C64Symbols})
+			d.PC = 0x1233
+			have := d.Next().String()
+			if test.want != have {
+				t.Errorf("\n want: %v \n have: %v \n", test.want, have)
+			}
+		})
+	}
+}
+
+func TestMemorySymbols(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.Disassembler.LoadSource(&Source{Symbols: C64Symbols})
+	testMonitorParse(mon, "m d010 d02f")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := "VIC_MSIGX VIC_SCROLY VIC_RASTER"
+	have := lines[0]
+	if !strings.Contains(have, want) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
@@ -0,0 +1,145 @@
+package mach85
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// http://unusedino.de/ec64/technical/formats/t64.html
+// http://unusedino.de/ec64/technical/formats/tap.html
+
+const (
+	t64HeaderLen = 0x40
+	t64EntryLen  = 0x20
+	tapHeaderLen = 0x14
+	tapSignature = "C64-TAPE-RAW"
+)
+
+// T64Entry is a file in a T64 container.
+type T64Entry struct {
+	Name  string
+	Type  FileType
+	Start uint16
+	End   uint16
+	Data  []uint8
+}
+
+// Program returns the data with the load address at the beginning.
+func (e T64Entry) Program() []uint8 {
+	return append([]uint8{uint8(e.Start), uint8(e.Start >> 8)}, e.Data...)
+}
+
+// T64 is a container of files that were stored on tape.
+type T64 struct {
+	Name    string
+	Entries []T64Entry
+}
+
+type t64Entry struct {
+	EntryType uint8
+	FileType  uint8
+	Start     uint16
+	End       uint16
+	_         uint16
+	Offset    uint32
+	_         uint32
+	Name      [16]uint8
+}
+
+func ParseT64(data []uint8) (*T64, error) {
+	if len(data) < t64HeaderLen || !bytes.HasPrefix(data, []uint8("C64")) {
+		return nil, errors.New("not a T64 file")
+	}
+	t := &T64{Name: strings.TrimRight(string(data[0x28:0x40]), " \x00\xa0")}
+	used := int(binary.LittleEndian.Uint16(data[0x24:]))
+	if max := int(binary.LittleEndian.Uint16(data[0x22:])); used == 0 || used > max {
+		used = max
+	}
+	var raw []t64Entry
+	for i := 0; i < used; i++ {
+		offset := t64HeaderLen + i*t64EntryLen
+		if offset+t64EntryLen > len(data) {
+			return nil, errors.New("truncated T64 file")
+		}
+		var e t64Entry
+		binary.Read(bytes.NewReader(data[offset:]), binary.LittleEndian, &e)
+		if e.EntryType == 0 {
+			continue
+		}
+		raw = append(raw, e)
+	}
+	for _, e := range raw {
+		// The end address is often wrong in files created by older tools
+		// so the length is limited by the offset of the next file.
+		length := int(e.End) - int(e.Start)
+		start := int(e.Offset)
+		end := len(data)
+		for _, next := range raw {
+			if int(next.Offset) > start && int(next.Offset) < end {
+				end = int(next.Offset)
+			}
+		}
+		if start > len(data) || length <= 0 {
+			return nil, fmt.Errorf("invalid T64 entry: %v", unpad(e.Name[:]))
+		}
+		if start+length < end {
+			end = start + length
+		}
+		t.Entries = append(t.Entries, T64Entry{
+			Name:  strings.TrimRight(unpad(e.Name[:]), " "),
+			Type:  FileType(e.FileType & 0x07),
+			Start: e.Start,
+			End:   e.Start + uint16(end-start),
+			Data:  data[start:end],
+		})
+	}
+	return t, nil
+}
+
+// Find returns the index of the first entry at or after the position given
+// that matches the pattern. An empty pattern matches the next file.
+func (t *T64) Find(pattern string, pos int) (int, error) {
+	for i := pos; i < len(t.Entries); i++ {
+		if pattern == "" || matchName(pattern, t.Entries[i].Name) {
+			return i, nil
+		}
+	}
+	return 0, ErrFileNotFound
+}
+
+// TAP is a tape image recorded as the length of each pulse read from the
+// tape, in cycles.
+type TAP struct {
+	Version uint8
+	Pulses  []int
+}
+
+func ParseTAP(data []uint8) (*TAP, error) {
+	if len(data) < tapHeaderLen || !bytes.HasPrefix(data, []uint8(tapSignature)) {
+		return nil, errors.New("not a TAP file")
+	}
+	t := &TAP{Version: data[12]}
+	size := int(binary.LittleEndian.Uint32(data[16:]))
+	data = data[tapHeaderLen:]
+	if size < len(data) {
+		data = data[:size]
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] != 0 {
+			t.Pulses = append(t.Pulses, int(data[i])*8)
+			continue
+		}
+		// Version 0 uses zero for any pause longer than a byte can hold.
+		// Version 1 follows with the length in cycles.
+		if t.Version == 0 || i+3 >= len(data) {
+			t.Pulses = append(t.Pulses, 256*8)
+			continue
+		}
+		t.Pulses = append(t.Pulses, int(data[i+1])|int(data[i+2])<<8|int(data[i+3])<<16)
+		i += 3
+	}
+	return t, nil
+}
@@ -0,0 +1,102 @@
+package mach85
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testT64 builds a container with a program for each entry. The end
+// address of the last entry is wrong as it is in many files.
+func testT64(programs ...[]uint8) []uint8 {
+	data := make([]uint8, t64HeaderLen+len(programs)*t64EntryLen)
+	copy(data, "C64S tape image file")
+	copy(data[0x28:], "TEST TAPE")
+	data[0x22] = uint8(len(programs))
+	data[0x24] = uint8(len(programs))
+	for i, prog := range programs {
+		e := data[t64HeaderLen+i*t64EntryLen:]
+		start := uint16(0xc000 + i*0x100)
+		end := start + uint16(len(prog))
+		if i == len(programs)-1 {
+			end = 0xc3ff
+		}
+		e[0] = 1
+		e[1] = 0x82
+		e[2], e[3] = uint8(start), uint8(start>>8)
+		e[4], e[5] = uint8(end), uint8(end>>8)
+		offset := len(data)
+		e[8], e[9] = uint8(offset), uint8(offset>>8)
+		copy(e[0x10:0x20], padded(string(rune('A'+i))+"PROG", 16, ' '))
+		data = append(data, prog...)
+	}
+	return data
+}
+
+func TestParseT64(t *testing.T) {
+	t64, err := ParseT64(testT64([]uint8{1, 2}, []uint8{3, 4, 5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t64.Name != "TEST TAPE" {
+		t.Errorf("\n want: %v \n have: %v \n", "TEST TAPE", t64.Name)
+	}
+	if len(t64.Entries) != 2 {
+		t.Fatalf("\n want: %v \n have: %v \n", 2, len(t64.Entries))
+	}
+	e := t64.Entries[1]
+	if e.Name != "BPROG" || e.Type != FilePRG || e.End != 0xc103 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+	want := []uint8{0x00, 0xc1, 3, 4, 5}
+	if !reflect.DeepEqual(want, e.Program()) {
+		t.Errorf("\n want: %v \n have: %v \n", want, e.Program())
+	}
+}
+
+func TestParseT64Invalid(t *testing.T) {
+	if _, err := ParseT64([]uint8("C64-TAPE-RAW")); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestT64Find(t *testing.T) {
+	t64, _ := ParseT64(testT64([]uint8{1}, []uint8{2}, []uint8{3}))
+	tests := []struct {
+		pattern string
+		pos     int
+		want    int
+		err     error
+	}{
+		{"", 0, 0, nil},
+		{"", 2, 2, nil},
+		{"B*", 0, 1, nil},
+		{"APROG", 1, 0, ErrFileNotFound},
+	}
+	for _, test := range tests {
+		have, err := t64.Find(test.pattern, test.pos)
+		if have != test.want || err != test.err {
+			t.Errorf("\n want: %v %v \n have: %v %v \n", test.want, test.err, have, err)
+		}
+	}
+}
+
+func TestParseTAP(t *testing.T) {
+	tests := []struct {
+		version uint8
+		want    []int
+	}{
+		{0, []int{0x30 * 8, 256 * 8, 0x10 * 8, 0x20 * 8, 0x30 * 8, 0x42 * 8}},
+		{1, []int{0x30 * 8, 0x302010, 0x42 * 8}},
+	}
+	for _, test := range tests {
+		data := append([]uint8(tapSignature), test.version, 0, 0, 0, 6, 0, 0, 0)
+		data = append(data, 0x30, 0, 0x10, 0x20, 0x30, 0x42)
+		tap, err := ParseTAP(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.want, tap.Pulses) {
+			t.Errorf("\n want: %v \n have: %v \n", test.want, tap.Pulses)
+		}
+	}
+}
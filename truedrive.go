@@ -0,0 +1,414 @@
+package mach85
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/blackchip-org/mach85/rom"
+)
+
+// http://mocagh.org/cbm/c1541II-manual.pdf
+
+const (
+	driveROMFile   = "1541.rom"
+	driveROMLen    = 0x4000
+	driveRAMLen    = 0x0800
+	driveMinHalf   = 2  // track 1
+	driveMaxHalf   = 84 // track 42
+	driveStartHalf = 36 // track 18
+)
+
+// LoadDriveROM reads the 1541 DOS ROM from the ROM path.
+func LoadDriveROM() ([]uint8, error) {
+	data, err := ioutil.ReadFile(filepath.Join(rom.Path, driveROMFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != driveROMLen {
+		return nil, fmt.Errorf("%v: invalid size", driveROMFile)
+	}
+	return data, nil
+}
+
+// TrueDrive emulates the hardware of a 1541 disk drive. The drive has its
+// own 6502 running the DOS ROM, 2K of RAM and two VIAs. The first VIA is
+// connected to the serial bus and the second to the read/write head and
+// the stepper motor. The drive runs in step with the CPU of the computer
+// and the disk is read and written as GCR.
+type TrueDrive struct {
+	Image  *DiskImage
+	Device int
+
+	cpu  *CPU
+	via1 *VIA
+	via2 *VIA
+	ram  *RAM
+	rom  *ROM
+	host *CPU
+	bus  *IECBus
+
+	dataOut bool
+	clkOut  bool
+	atna    bool
+
+	halfTrack int
+	phase     uint8
+	motor     bool
+	tracks    map[int][]uint8
+	dirty     map[int]bool
+	writes    uint64     // bytes written to the disk
+	saved     *driveDisk // last copy of the disk returned
+	pos       int
+	wait      int
+	sync      bool
+	latch     uint8
+}
+
+// NewTrueDrive creates a drive with the disk inserted. The device number
+// is set by the jumpers on the board and must be between 8 and 11.
+func NewTrueDrive(device int, image *DiskImage, romData []uint8) (*TrueDrive, error) {
+	if device < 8 || device > 11 {
+		return nil, fmt.Errorf("invalid device: %v", device)
+	}
+	if image.Format != FormatD64 {
+		return nil, errors.New("only D64 images can be used in a true drive")
+	}
+	d := &TrueDrive{
+		Image:     image,
+		Device:    device,
+		via1:      NewVIA(),
+		via2:      NewVIA(),
+		ram:       NewRAM(driveRAMLen),
+		rom:       NewROM(romData),
+		halfTrack: driveStartHalf,
+		phase:     0x03, // port pins are high until configured
+		tracks:    map[int][]uint8{},
+		dirty:     map[int]bool{},
+	}
+	d.cpu = New6510(NewMemory(d))
+	d.via1.ReadB = d.readSerial
+	d.via1.WriteB = d.writeSerial
+	d.via2.ReadA = func() uint8 { return d.latch }
+	d.via2.ReadB = d.readHead
+	d.via2.WriteB = d.writeHead
+	d.via2.SetCA1(true)
+	d.Reset()
+	return d, nil
+}
+
+func (d *TrueDrive) Reset() {
+	d.via1.Reset()
+	d.via2.Reset()
+	d.cpu.SP = 0xff
+	d.cpu.I = true
+	d.cpu.PC = d.cpu.mem.Load16(AddrResetVector) - 1
+}
+
+func (d *TrueDrive) Load(address uint16) uint8 {
+	switch {
+	case address < 0x1800:
+		return d.ram.Load(address % driveRAMLen)
+	case address < 0x1c00:
+		return d.via1.Load(address)
+	case address < 0x2000:
+		return d.via2.Load(address)
+	case address >= 0xc000:
+		return d.rom.Load(address - 0xc000)
+	}
+	return uint8(address >> 8)
+}
+
+func (d *TrueDrive) Store(address uint16, value uint8) {
+	switch {
+	case address < 0x1800:
+		d.ram.Store(address%driveRAMLen, value)
+	case address < 0x1c00:
+		d.via1.Store(address, value)
+	case address < 0x2000:
+		d.via2.Store(address, value)
+	}
+}
+
+// Service runs the drive until it has caught up with the computer.
+func (d *TrueDrive) Service() error {
+	for d.cpu.Cycles < d.host.Cycles {
+		if err := d.step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *TrueDrive) step() error {
+	if (d.via1.IRQ() || d.via2.IRQ()) && d.cpu.acceptsIRQ() {
+		d.cpu.IRQ()
+	}
+	before := d.cpu.Cycles
+	if err := d.cpu.Next(); err != nil {
+		return fmt.Errorf("drive %v: %v", d.Device, err)
+	}
+	if d.cpu.B {
+		d.cpu.brk()
+	}
+	n := int(d.cpu.Cycles - before)
+	d.via1.Clock(n)
+	d.via2.Clock(n)
+	d.rotate(n)
+	return nil
+}
+
+// readSerial is connected to port B of the first VIA. Inputs are inverted
+// so that a bit is set when the line is low.
+func (d *TrueDrive) readSerial() uint8 {
+	value := uint8(d.Device-8) << 5
+	if d.bus == nil {
+		return value
+	}
+	if d.bus.DATA() {
+		value |= 0x01
+	}
+	if d.bus.CLK() {
+		value |= 0x04
+	}
+	if d.bus.ATN() {
+		value |= 0x80
+	}
+	return value
+}
+
+func (d *TrueDrive) writeSerial(value uint8) {
+	d.dataOut = value&0x02 != 0
+	d.clkOut = value&0x08 != 0
+	d.atna = value&0x10 != 0
+}
+
+// atnChanged is called by the bus when the computer changes ATN. The line
+// is inverted before reaching CA1.
+func (d *TrueDrive) atnChanged() {
+	d.via1.SetCA1(d.bus.ATN())
+}
+
+// readHead is connected to port B of the second VIA. Bit 7 is clear when
+// a sync mark is under the head and bit 4 is set when the disk is not
+// write protected.
+func (d *TrueDrive) readHead() uint8 {
+	value := uint8(0x10)
+	if !d.sync {
+		value |= 0x80
+	}
+	return value
+}
+
+// writeHead is connected to port B of the second VIA. Bits 0 and 1 are the
+// phase of the stepper motor and bit 2 turns the spindle motor on.
+func (d *TrueDrive) writeHead(value uint8) {
+	phase := value & 0x03
+	switch phase {
+	case (d.phase + 1) & 0x03:
+		d.seek(d.halfTrack + 1)
+	case (d.phase - 1) & 0x03:
+		d.seek(d.halfTrack - 1)
+	}
+	d.phase = phase
+	motor := value&0x04 != 0
+	if d.motor && !motor {
+		d.Flush()
+	}
+	d.motor = motor
+}
+
+func (d *TrueDrive) seek(halfTrack int) {
+	if halfTrack < driveMinHalf || halfTrack > driveMaxHalf {
+		return
+	}
+	d.Flush()
+	d.halfTrack = halfTrack
+	if track := d.track(); len(track) > 0 {
+		d.pos %= len(track)
+	}
+}
+
+// Track returns the track the head is on.
+func (d *TrueDrive) Track() int {
+	return d.halfTrack / 2
+}
+
+// track returns the GCR data under the head. Nothing can be read when the
+// head is between tracks.
+func (d *TrueDrive) track() []uint8 {
+	if d.halfTrack%2 != 0 {
+		return nil
+	}
+	t := d.Track()
+	if t > d.Image.Format.Tracks {
+		return nil
+	}
+	if _, ok := d.tracks[t]; !ok {
+		d.tracks[t] = d.Image.EncodeTrack(t)
+	}
+	return d.tracks[t]
+}
+
+// byteCycles is the number of cycles for each byte to pass under the head
+// for the density selected by bits 5 and 6 of port B.
+func (d *TrueDrive) byteCycles() int {
+	density := int(d.via2.PortB() >> 5 & 0x03)
+	return 32 - density*2
+}
+
+func (d *TrueDrive) rotate(cycles int) {
+	if !d.motor {
+		return
+	}
+	d.wait -= cycles
+	for d.wait <= 0 {
+		d.wait += d.byteCycles()
+		d.nextByte()
+	}
+}
+
+// nextByte moves the next byte under the head. CB2 is low when writing.
+// Byte ready pulses CA1 low and sets the overflow flag in the CPU if
+// enabled with CA2. No bytes are ready while reading a sync mark.
+func (d *TrueDrive) nextByte() {
+	track := d.track()
+	if len(track) == 0 {
+		d.sync = false
+		return
+	}
+	d.pos = (d.pos + 1) % len(track)
+	if !d.via2.CB2() {
+		track[d.pos] = d.via2.PortA()
+		d.dirty[d.Track()] = true
+		d.writes++
+		d.sync = false
+	} else {
+		prev := track[(d.pos+len(track)-1)%len(track)]
+		d.sync = track[d.pos] == gcrSync && prev == gcrSync
+		if d.sync {
+			return
+		}
+		d.latch = track[d.pos]
+	}
+	d.via2.SetCA1(false)
+	d.via2.SetCA1(true)
+	if d.via2.CA2() {
+		d.cpu.V = true
+	}
+}
+
+// Flush decodes tracks that have been written and saves the image.
+func (d *TrueDrive) Flush() error {
+	if len(d.dirty) == 0 {
+		return nil
+	}
+	for t := range d.dirty {
+		d.Image.DecodeTrack(t, d.tracks[t])
+		delete(d.dirty, t)
+	}
+	return d.Image.Save()
+}
+
+// driveDisk is a copy of the disk in a true drive, kept in memory for
+// rewind. Tracks written since the last flush are included.
+type driveDisk struct {
+	writes uint64
+	data   []uint8
+	tracks map[int][]uint8
+}
+
+// disk returns a copy of the disk. The copy is only made again after the
+// disk has been written to.
+func (d *TrueDrive) disk() *driveDisk {
+	if d.saved != nil && d.saved.writes == d.writes {
+		return d.saved
+	}
+	c := &driveDisk{
+		writes: d.writes,
+		data:   append([]uint8(nil), d.Image.data...),
+		tracks: map[int][]uint8{},
+	}
+	for t := range d.dirty {
+		c.tracks[t] = append([]uint8(nil), d.tracks[t]...)
+	}
+	d.saved = c
+	return c
+}
+
+// setDisk puts back a copy returned by disk and saves the image if the
+// disk was written to after the copy was made.
+func (d *TrueDrive) setDisk(c *driveDisk) error {
+	if c.writes == d.writes {
+		return nil
+	}
+	copy(d.Image.data, c.data)
+	d.tracks = map[int][]uint8{}
+	d.dirty = map[int]bool{}
+	for t, track := range c.tracks {
+		d.tracks[t] = append([]uint8(nil), track...)
+		d.dirty[t] = true
+	}
+	// Count on from the latest writes so that each count stays unique to
+	// one state of the disk
+	d.writes++
+	d.saved = nil
+	return d.Image.Save()
+}
+
+// state saves or restores the drive. The contents of the disk are not
+// included and tracks are encoded again from the image after a restore.
+func (d *TrueDrive) state(s *stateCodec) {
+	if s.restore {
+		d.Flush()
+		d.tracks = map[int][]uint8{}
+	}
+	d.cpu.state(s)
+	s.fields(d.ram.bytes)
+	d.via1.state(s)
+	d.via2.state(s)
+	s.fields(&d.dataOut, &d.clkOut, &d.atna)
+	s.fields(&d.halfTrack, &d.phase, &d.motor, &d.pos, &d.wait, &d.sync, &d.latch)
+}
+
+func (d *TrueDrive) String() string {
+	return d.Image.Filename + " (true drive)"
+}
+
+// initIEC connects the second CIA to the serial bus.
+func (m *Mach85) initIEC() {
+	if m.iec != nil {
+		return
+	}
+	m.iec = NewIECBus()
+	m.initCIAs()
+	m.cia2.ReadA = m.iec.readCIA
+	m.cia2.WriteA = m.iec.writeCIA
+	m.iec.writeCIA(m.cia2.PortA())
+}
+
+func (m *Mach85) attachTrueDrive(device int, image *DiskImage) error {
+	romData, err := LoadDriveROM()
+	if err != nil {
+		return err
+	}
+	d, err := NewTrueDrive(device, image, romData)
+	if err != nil {
+		return err
+	}
+	m.detach(device)
+	m.initIEC()
+	d.host = m.cpu
+	d.cpu.Cycles = m.cpu.Cycles
+	m.iec.add(d)
+	m.trueDrives[device] = d
+	m.AddDevice(d)
+	return nil
+}
+
+// TrueDrive returns the emulated drive attached as the device or nil if
+// there is none.
+func (m *Mach85) TrueDrive(device int) *TrueDrive {
+	return m.trueDrives[device]
+}
@@ -0,0 +1,151 @@
+package mach85
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// newTestTrueDrive creates a drive with a ROM that runs the program given
+// on reset instead of DOS.
+func newTestTrueDrive(t *testing.T, prog ...uint8) *TrueDrive {
+	romData := make([]uint8, driveROMLen)
+	copy(romData, prog)
+	romData[AddrResetVector-0xc000] = 0x00
+	romData[AddrResetVector-0xc000+1] = 0xc0
+	disk := NewDiskImage(FormatD64, "TEST", "01")
+	d, err := NewTrueDrive(8, disk, romData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.host = New6510(NewMemory(NewRAM(0x10000)))
+	return d
+}
+
+func TestTrueDriveRead(t *testing.T) {
+	d := newTestTrueDrive(t,
+		0xa9, 0x67, // lda #$67
+		0x8d, 0x00, 0x1c, // sta $1c00  ; motor on, keep stepper phase
+		0xa9, 0x6f, // lda #$6f
+		0x8d, 0x02, 0x1c, // sta $1c02
+		0xa9, 0xee, // lda #$ee
+		0x8d, 0x0c, 0x1c, // sta $1c0c  ; read mode, byte ready sets V
+		0x2c, 0x00, 0x1c, // bit $1c00  ; wait for sync
+		0x30, 0xfb, // bmi *-3
+		0xb8,       // clv
+		0x50, 0xfe, // bvc *        ; wait for byte ready
+		0xad, 0x01, 0x1c, // lda $1c01
+		0x8d, 0x00, 0x03, // sta $0300
+		0x4c, 0x1f, 0xc0, // jmp *
+	)
+	d.host.Cycles = 5000
+	if err := d.Service(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Track() != 18 {
+		t.Errorf("\n want: %v \n have: %v \n", 18, d.Track())
+	}
+	// First byte of a header block
+	if have := d.Load(0x0300); have != 0x52 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x52, have)
+	}
+}
+
+func TestTrueDriveStep(t *testing.T) {
+	d := newTestTrueDrive(t, 0x4c, 0x00, 0xc0) // jmp *
+	d.Store(0x1c00, 0x03)
+	d.Store(0x1c02, 0x03)
+	for _, phase := range []uint8{0, 1, 2} {
+		d.Store(0x1c00, phase)
+	}
+	if d.Track() != 19 {
+		t.Errorf("\n want: %v \n have: %v \n", 19, d.Track())
+	}
+	for _, phase := range []uint8{1, 0, 3, 2} {
+		d.Store(0x1c00, phase)
+	}
+	if d.Track() != 17 {
+		t.Errorf("\n want: %v \n have: %v \n", 17, d.Track())
+	}
+}
+
+func TestIECBus(t *testing.T) {
+	bus := NewIECBus()
+	d := newTestTrueDrive(t, 0x4c, 0x00, 0xc0) // jmp *
+	d.Store(0x1802, 0x1a)                      // data, clock and ATN acknowledge out
+	d.Store(0x1800, 0x00)
+	d.Store(0x180c, 0x01) // ATN on positive edge
+	bus.add(d)
+	if bus.readCIA()&0xc0 != 0xc0 {
+		t.Fatalf("lines not released: %02x", bus.readCIA())
+	}
+
+	bus.writeCIA(0x08) // assert ATN
+	if bus.readCIA()&0x80 != 0 {
+		t.Errorf("DATA not pulled low on ATN")
+	}
+	if d.Load(0x180d)&viaIntCA1 == 0 {
+		t.Errorf("ATN did not set CA1")
+	}
+	if d.Load(0x1800)&0x80 == 0 {
+		t.Errorf("ATN not seen by drive")
+	}
+
+	d.Store(0x1800, 0x10) // acknowledge
+	if bus.readCIA()&0x80 == 0 {
+		t.Errorf("DATA not released after acknowledge")
+	}
+
+	d.Store(0x1800, 0x18) // pull CLK
+	if bus.readCIA()&0x40 != 0 {
+		t.Errorf("CLK not pulled low by drive")
+	}
+	bus.writeCIA(0x28) // computer pulls DATA
+	if d.Load(0x1800)&0x01 == 0 {
+		t.Errorf("DATA not seen by drive")
+	}
+}
+
+func TestTrueDriveDiskCopy(t *testing.T) {
+	d := newTestTrueDrive(t, 0x4c, 0x00, 0xc0) // jmp *
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	d.Image.Filename = file.Name()
+	want := append([]uint8(nil), d.Image.data...)
+
+	before := d.disk()
+	if d.disk() != before {
+		t.Errorf("copied again without a write")
+	}
+	// As if the drive wrote a new header
+	d.tracks[18] = NewDiskImage(FormatD64, "OTHER", "02").EncodeTrack(18)
+	d.dirty[18] = true
+	d.writes++
+	if d.disk() == before {
+		t.Errorf("not copied after a write")
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Image.Name() != "OTHER" {
+		t.Fatalf("disk not written: %v", d.Image.Name())
+	}
+	if err := d.setDisk(before); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, d.Image.data) {
+		t.Errorf("disk not restored")
+	}
+	have, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, have) {
+		t.Errorf("image not saved")
+	}
+}
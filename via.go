@@ -0,0 +1,292 @@
+package mach85
+
+// http://archive.6502.org/datasheets/mos_6522_preliminary_nov_1977.pdf
+
+// VIA registers
+const (
+	viaORB = iota
+	viaORA
+	viaDDRB
+	viaDDRA
+	viaT1CL
+	viaT1CH
+	viaT1LL
+	viaT1LH
+	viaT2CL
+	viaT2CH
+	viaSR
+	viaACR
+	viaPCR
+	viaIFR
+	viaIER
+	viaORANoHandshake
+)
+
+// VIA interrupt flags
+const (
+	viaIntCA2 = 1 << iota
+	viaIntCA1
+	viaIntSR
+	viaIntCB2
+	viaIntCB1
+	viaIntT2
+	viaIntT1
+)
+
+// VIA is the MOS Technology 6522 Versatile Interface Adapter. Devices
+// connected to the ports provide the input pins through ReadA and ReadB
+// and are notified of changes to the output pins through WriteA and
+// WriteB. Pins not configured as outputs are pulled high.
+type VIA struct {
+	ReadA  func() uint8
+	ReadB  func() uint8
+	WriteA func(uint8)
+	WriteB func(uint8)
+
+	ora     uint8
+	orb     uint8
+	ddra    uint8
+	ddrb    uint8
+	t1      int
+	t1Latch uint16
+	t1Armed bool
+	t2      int
+	t2Latch uint8
+	t2Armed bool
+	sr      uint8
+	acr     uint8
+	pcr     uint8
+	ifr     uint8
+	ier     uint8
+	ca1     bool
+}
+
+func NewVIA() *VIA {
+	return &VIA{}
+}
+
+func (v *VIA) Reset() {
+	*v = VIA{ReadA: v.ReadA, ReadB: v.ReadB, WriteA: v.WriteA, WriteB: v.WriteB}
+	v.writeA()
+	v.writeB()
+}
+
+// PortA returns the state of the output pins on port A.
+func (v *VIA) PortA() uint8 {
+	return v.ora&v.ddra | ^v.ddra
+}
+
+// PortB returns the state of the output pins on port B.
+func (v *VIA) PortB() uint8 {
+	return v.orb&v.ddrb | ^v.ddrb
+}
+
+func (v *VIA) readA() uint8 {
+	in := uint8(0xff)
+	if v.ReadA != nil {
+		in = v.ReadA()
+	}
+	return v.ora&v.ddra | in&^v.ddra
+}
+
+func (v *VIA) readB() uint8 {
+	in := uint8(0xff)
+	if v.ReadB != nil {
+		in = v.ReadB()
+	}
+	return v.orb&v.ddrb | in&^v.ddrb
+}
+
+func (v *VIA) writeA() {
+	if v.WriteA != nil {
+		v.WriteA(v.PortA())
+	}
+}
+
+func (v *VIA) writeB() {
+	if v.WriteB != nil {
+		v.WriteB(v.PortB())
+	}
+}
+
+func (v *VIA) Load(address uint16) uint8 {
+	switch address & 0xf {
+	case viaORB:
+		v.ifr &^= viaIntCB1 | viaIntCB2
+		return v.readB()
+	case viaORA:
+		v.ifr &^= viaIntCA1 | viaIntCA2
+		return v.readA()
+	case viaDDRB:
+		return v.ddrb
+	case viaDDRA:
+		return v.ddra
+	case viaT1CL:
+		v.ifr &^= viaIntT1
+		return uint8(v.t1)
+	case viaT1CH:
+		return uint8(v.t1 >> 8)
+	case viaT1LL:
+		return uint8(v.t1Latch)
+	case viaT1LH:
+		return uint8(v.t1Latch >> 8)
+	case viaT2CL:
+		v.ifr &^= viaIntT2
+		return uint8(v.t2)
+	case viaT2CH:
+		return uint8(v.t2 >> 8)
+	case viaSR:
+		return v.sr
+	case viaACR:
+		return v.acr
+	case viaPCR:
+		return v.pcr
+	case viaIFR:
+		if v.IRQ() {
+			return v.ifr | 0x80
+		}
+		return v.ifr
+	case viaIER:
+		return v.ier | 0x80
+	}
+	return v.readA() // viaORANoHandshake
+}
+
+// Peek reads a register without clearing the interrupt flags.
+func (v *VIA) Peek(address uint16) uint8 {
+	ifr := v.ifr
+	value := v.Load(address)
+	v.ifr = ifr
+	return value
+}
+
+func (v *VIA) Store(address uint16, value uint8) {
+	switch address & 0xf {
+	case viaORB:
+		v.ifr &^= viaIntCB1 | viaIntCB2
+		v.orb = value
+		v.writeB()
+	case viaORA:
+		v.ifr &^= viaIntCA1 | viaIntCA2
+		v.ora = value
+		v.writeA()
+	case viaDDRB:
+		v.ddrb = value
+		v.writeB()
+	case viaDDRA:
+		v.ddra = value
+		v.writeA()
+	case viaT1CL, viaT1LL:
+		v.t1Latch = v.t1Latch&0xff00 | uint16(value)
+	case viaT1CH:
+		v.t1Latch = v.t1Latch&0x00ff | uint16(value)<<8
+		v.t1 = int(v.t1Latch)
+		v.t1Armed = true
+		v.ifr &^= viaIntT1
+	case viaT1LH:
+		v.t1Latch = v.t1Latch&0x00ff | uint16(value)<<8
+		v.ifr &^= viaIntT1
+	case viaT2CL:
+		v.t2Latch = value
+	case viaT2CH:
+		v.t2 = int(value)<<8 | int(v.t2Latch)
+		v.t2Armed = true
+		v.ifr &^= viaIntT2
+	case viaSR:
+		v.sr = value
+	case viaACR:
+		v.acr = value
+	case viaPCR:
+		v.pcr = value
+	case viaIFR:
+		v.ifr &^= value & 0x7f
+	case viaIER:
+		if value&0x80 != 0 {
+			v.ier |= value & 0x7f
+		} else {
+			v.ier &^= value & 0x7f
+		}
+	case viaORANoHandshake:
+		v.ora = value
+		v.writeA()
+	}
+}
+
+// Clock advances the timers by the number of cycles given.
+func (v *VIA) Clock(cycles int) {
+	v.t1 -= cycles
+	if v.t1 < 0 {
+		if v.t1Armed {
+			v.ifr |= viaIntT1
+		}
+		if v.acr&0x40 != 0 { // free running
+			period := int(v.t1Latch) + 2
+			for v.t1 < 0 {
+				v.t1 += period
+			}
+		} else {
+			v.t1Armed = false
+			v.t1 &= 0xffff
+		}
+	}
+	// Timer 2 counts pulses on PB6 instead when ACR bit 5 is set
+	if v.acr&0x20 == 0 {
+		v.t2 -= cycles
+		if v.t2 < 0 {
+			if v.t2Armed {
+				v.ifr |= viaIntT2
+			}
+			v.t2Armed = false
+			v.t2 &= 0xffff
+		}
+	}
+}
+
+// SetCA1 sets the level of the CA1 input. The interrupt flag is set on the
+// edge selected in the PCR.
+func (v *VIA) SetCA1(level bool) {
+	positive := v.pcr&0x01 != 0
+	if level != v.ca1 && level == positive {
+		v.ifr |= viaIntCA1
+	}
+	v.ca1 = level
+}
+
+// CA2 returns the level of the CA2 output when in manual output mode.
+func (v *VIA) CA2() bool {
+	switch v.pcr >> 1 & 0x7 {
+	case 6:
+		return false
+	case 7:
+		return true
+	}
+	return true
+}
+
+// CB2 returns the level of the CB2 output when in manual output mode.
+func (v *VIA) CB2() bool {
+	switch v.pcr >> 5 & 0x7 {
+	case 6:
+		return false
+	case 7:
+		return true
+	}
+	return true
+}
+
+// IRQ returns true if an enabled interrupt is pending.
+func (v *VIA) IRQ() bool {
+	return v.ifr&v.ier&0x7f != 0
+}
+
+// state saves or restores the registers. The port outputs are written
+// again after a restore.
+func (v *VIA) state(s *stateCodec) {
+	s.fields(&v.ora, &v.orb, &v.ddra, &v.ddrb)
+	s.fields(&v.t1, &v.t1Latch, &v.t1Armed, &v.t2, &v.t2Latch, &v.t2Armed)
+	s.fields(&v.sr, &v.acr, &v.pcr, &v.ifr, &v.ier, &v.ca1)
+	if s.restore {
+		v.writeA()
+		v.writeB()
+	}
+}
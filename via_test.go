@@ -0,0 +1,70 @@
+package mach85
+
+import "testing"
+
+func TestVIAPorts(t *testing.T) {
+	v := NewVIA()
+	var out uint8
+	v.ReadB = func() uint8 { return 0x81 }
+	v.WriteB = func(value uint8) { out = value }
+	v.Store(viaDDRB, 0x0f)
+	v.Store(viaORB, 0x0a)
+	if out != 0xfa {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0xfa, out)
+	}
+	if have := v.Load(viaORB); have != 0x8a {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x8a, have)
+	}
+}
+
+func TestVIATimer1OneShot(t *testing.T) {
+	v := NewVIA()
+	v.Store(viaIER, 0x80|viaIntT1)
+	v.Store(viaT1CL, 0x10)
+	v.Store(viaT1CH, 0x00)
+	v.Clock(0x10)
+	if v.IRQ() {
+		t.Fatalf("irq before underflow")
+	}
+	v.Clock(1)
+	if !v.IRQ() {
+		t.Fatalf("no irq after underflow")
+	}
+	if have := v.Load(viaIFR); have != 0x80|viaIntT1 {
+		t.Errorf("\n want: %02x \n have: %02x \n", 0x80|viaIntT1, have)
+	}
+	v.Load(viaT1CL)
+	v.Clock(0x20000)
+	if v.IRQ() {
+		t.Errorf("one shot timer fired twice")
+	}
+}
+
+func TestVIATimer1FreeRunning(t *testing.T) {
+	v := NewVIA()
+	v.Store(viaACR, 0x40)
+	v.Store(viaT1CL, 0x10)
+	v.Store(viaT1CH, 0x00)
+	v.Clock(0x11)
+	v.Store(viaIFR, viaIntT1)
+	v.Clock(0x12)
+	if v.Load(viaIFR)&viaIntT1 == 0 {
+		t.Errorf("free running timer did not fire twice")
+	}
+}
+
+func TestVIACA1(t *testing.T) {
+	v := NewVIA()
+	v.SetCA1(true)
+	if v.Load(viaIFR)&viaIntCA1 != 0 {
+		t.Fatalf("positive edge flagged with negative edge selected")
+	}
+	v.SetCA1(false)
+	if v.Load(viaIFR)&viaIntCA1 == 0 {
+		t.Fatalf("negative edge not flagged")
+	}
+	v.Load(viaORA)
+	if v.Load(viaIFR)&viaIntCA1 != 0 {
+		t.Errorf("flag not cleared on read of port A")
+	}
+}
@@ -0,0 +1,49 @@
+package mach85
+
+// http://www.zimmers.net/anonftp/pub/cbm/documents/chipdata/6560-6561.txt
+
+// NTSC timing of the 6560
+const (
+	viciCyclesPerLine = 65
+	viciLines         = 261
+)
+
+// VICI is the MOS Technology 6560 Video Interface Chip in the VIC-20.
+// The registers hold the layout of the screen for the video output and
+// the raster counter follows the cycles executed by the CPU. Sound and
+// the light pen are not emulated.
+type VICI struct {
+	regs [16]uint8
+	cpu  *CPU
+}
+
+func NewVICI(cpu *CPU) *VICI {
+	return &VICI{cpu: cpu}
+}
+
+func (v *VICI) Reset() {
+	v.regs = [16]uint8{}
+}
+
+func (v *VICI) raster() uint16 {
+	return uint16(v.cpu.Cycles / viciCyclesPerLine % viciLines)
+}
+
+func (v *VICI) Load(address uint16) uint8 {
+	reg := address & 0xf
+	switch reg {
+	case 3:
+		return v.regs[3]&0x7f | uint8(v.raster()&1)<<7
+	case 4:
+		return uint8(v.raster() >> 1)
+	}
+	return v.regs[reg]
+}
+
+func (v *VICI) Store(address uint16, value uint8) {
+	v.regs[address&0xf] = value
+}
+
+func (v *VICI) state(s *stateCodec) {
+	s.fields(&v.regs)
+}
@@ -0,0 +1,25 @@
+package mach85
+
+import "testing"
+
+func TestVICIRaster(t *testing.T) {
+	tests := []struct {
+		cycles uint64
+		reg3   uint8
+		reg4   uint8
+	}{
+		{0, 0x00, 0x00},
+		{viciCyclesPerLine, 0x80, 0x00},
+		{viciCyclesPerLine * 101, 0x80, 0x32},
+		{viciCyclesPerLine * viciLines, 0x00, 0x00},
+	}
+	for _, test := range tests {
+		v := NewVICI(&CPU{Cycles: test.cycles})
+		if have := v.Load(0x9003); have != test.reg3 {
+			t.Errorf("\n want: %02x \n have: %02x \n", test.reg3, have)
+		}
+		if have := v.Load(0x9004); have != test.reg4 {
+			t.Errorf("\n want: %02x \n have: %02x \n", test.reg4, have)
+		}
+	}
+}
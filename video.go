@@ -1,8 +1,5 @@
 package mach85
 
-// http://dustlayer.com/index-vic-ii/
-// http://www.zimmers.net/cbmpics/cbm/c64/vic-ii.txt
-
 import (
 	"flag"
 	"image/color"
@@ -18,12 +15,8 @@ func init() {
 }
 
 const (
-	width      = 320
-	height     = 200
-	screenW    = 404 // actually 403?
-	screenH    = 284
-	borderW    = (screenW - width) / 2
-	borderH    = (screenH - height) / 2
+	borderW    = 42
+	borderH    = 42
 	charSheetW = 32
 	charSheetH = 16
 )
@@ -67,14 +60,21 @@ var colorMap = [...]color.RGBA{
 }
 
 type Video struct {
-	mem        *Memory
+	screen     Screen
+	cpu        *CPU
+	frame      uint64 // cycle count at the start of the frame
+	width      int
+	height     int
 	window     *sdl.Window
 	renderer   *sdl.Renderer
 	lastUpdate time.Time
 	charSheet  *sdl.Texture
 }
 
-func NewVideo(mem *Memory) (*Video, error) {
+func NewVideo(screen Screen, cpu *CPU) (*Video, error) {
+	cols, rows := screen.Size()
+	width, height := cols*8, rows*8
+	screenW, screenH := width+borderW*2, height+borderH*2
 	window, err := sdl.CreateWindow(
 		"mach85",
 		sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
@@ -90,21 +90,38 @@ func NewVideo(mem *Memory) (*Video, error) {
 	}
 	renderer.SetScale(float32(scale), float32(scale))
 	v := &Video{
-		mem:      mem,
+		screen:   screen,
+		cpu:      cpu,
+		frame:    cpu.Cycles,
+		width:    width,
+		height:   height,
 		window:   window,
 		renderer: renderer,
 	}
-	v.Service()
+	v.draw()
 	return v, nil
 }
 
+// Service starts a new frame after the cycles of the last one have been
+// executed. The screen is redrawn at most 60 times per second.
 func (v *Video) Service() error {
-	now := time.Now()
-	if now.Sub(v.lastUpdate) < time.Millisecond*16 {
+	if v.cpu.Cycles-v.frame < frameCyclesNTSC {
+		return nil
+	}
+	v.frame = v.cpu.Cycles
+	v.screen.Frame()
+	if time.Since(v.lastUpdate) < time.Millisecond*16 {
 		return nil
 	}
-	v.lastUpdate = now
-	v.mem.Store(0xd012, 00) // HACK: set raster line to zero
+	return v.draw()
+}
+
+func (v *Video) state(s *stateCodec) {
+	s.fields(&v.frame)
+}
+
+func (v *Video) draw() error {
+	v.lastUpdate = time.Now()
 	if v.charSheet == nil {
 		if err := v.genCharSheet(); err != nil {
 			return err
@@ -118,9 +135,10 @@ func (v *Video) Service() error {
 }
 
 func (v *Video) drawBorder() {
-	index := v.mem.Load(AddrBorderColor) & 0xf
-	c := colorMap[index]
+	c := v.screen.Border()
 	v.renderer.SetDrawColor(c.R, c.G, c.B, c.A)
+	screenW := int32(v.width + borderW*2)
+	width, height := int32(v.width), int32(v.height)
 	topBorder := sdl.Rect{
 		X: 0,
 		Y: 0,
@@ -152,56 +170,38 @@ func (v *Video) drawBorder() {
 }
 
 func (v *Video) drawBackground() {
-	index := v.mem.Load(AddrBackgroundColor) & 0xf
-	c := colorMap[index]
+	c := v.screen.Background()
 	v.renderer.SetDrawColor(c.R, c.G, c.B, c.A)
 	background := sdl.Rect{
 		X: borderW,
 		Y: borderH,
-		W: width,
-		H: height,
+		W: int32(v.width),
+		H: int32(v.height),
 	}
 	v.renderer.FillRect(&background)
 }
 
 func (v *Video) drawCharacters() {
-	mem64 := v.mem.Base.(*Memory64)
-	prev := mem64.SetMode(0)
-	defer mem64.SetMode(prev)
-
-	io := mem64.Chunks[IO]
-	addrScreenMem := uint16(0x0400)
-	addrColorMem := uint16(0x0800)
-	baseX := 0
-	baseY := 0
-	for baseY < height {
-		ch := mem64.Load(addrScreenMem)
-		color := colorMap[io.Load(addrColorMem)&0x0f]
+	cols, rows := v.screen.Size()
+	for i := 0; i < cols*rows; i++ {
+		ch := v.screen.Char(i)
+		color := v.screen.Color(i)
 		v.charSheet.SetColorMod(color.R, color.G, color.B)
 		chx := int32(ch) % charSheetW * 8
 		chy := int32(ch) / charSheetW * 8
 		src := sdl.Rect{X: chx, Y: chy, W: 8, H: 8}
 		dest := sdl.Rect{
-			X: int32(baseX + borderW),
-			Y: int32(baseY + borderH),
+			X: int32(i%cols*8 + borderW),
+			Y: int32(i/cols*8 + borderH),
 			W: 8,
 			H: 8,
 		}
 		v.renderer.Copy(v.charSheet, &src, &dest)
-		addrScreenMem++
-		addrColorMem++
-		baseX += 8
-		if baseX >= width {
-			baseX = 0
-			baseY += 8
-		}
 	}
 }
 
 func (v *Video) genCharSheet() error {
-	mem64 := v.mem.Base.(*Memory64)
-	chargen := mem64.Chunks[CharROM]
-	charSheet, err := CharGen(v.renderer, chargen)
+	charSheet, err := CharGen(v.renderer, v.screen.CharROM())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,155 @@
+package mach85
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type WatchType int
+
+const (
+	WatchRead   WatchType = 1 << iota
+	WatchWrite            // any store
+	WatchChange           // a store of a different value
+)
+
+func (t WatchType) String() string {
+	var names []string
+	for _, w := range []struct {
+		t    WatchType
+		name string
+	}{{WatchRead, "read"}, {WatchWrite, "write"}, {WatchChange, "change"}} {
+		if t&w.t != 0 {
+			names = append(names, w.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// WatchpointInfo describes a watchpoint, which stops the machine when
+// memory in the range from Start to End is accessed.
+type WatchpointInfo struct {
+	Start uint16
+	End   uint16
+	Type  WatchType
+	Hits  int
+}
+
+func (w *WatchpointInfo) String() string {
+	return fmt.Sprintf("$%04x-$%04x %-6v hits %v", w.Start, w.End, w.Type, w.Hits)
+}
+
+// WatchHit describes an access that matched a watchpoint. The PC is the
+// address of the instruction that made the access. The old value of a
+// store is only known when the address is watched for a change and is
+// otherwise the same as the new value.
+type WatchHit struct {
+	Type    WatchType
+	PC      uint16
+	Address uint16
+	Old     uint8
+	New     uint8
+}
+
+func (h WatchHit) String() string {
+	if h.Type == WatchRead {
+		return fmt.Sprintf("read $%04x at $%04x: $%02x", h.Address, h.PC, h.New)
+	}
+	if h.Old == h.New {
+		return fmt.Sprintf("write $%04x at $%04x: $%02x", h.Address, h.PC, h.New)
+	}
+	return fmt.Sprintf("write $%04x at $%04x: $%02x -> $%02x", h.Address, h.PC, h.Old, h.New)
+}
+
+// Watches are the watchpoints on a machine. Only memory accesses made
+// while the machine is running are checked so that the monitor can look
+// at memory without setting them off.
+type Watches struct {
+	points map[uint16]*WatchpointInfo
+	types  [0x10000]WatchType
+	active bool
+	pc     uint16
+	hits   []WatchHit
+}
+
+func NewWatches() *Watches {
+	return &Watches{points: map[uint16]*WatchpointInfo{}}
+}
+
+// Add watches the range from start to end. A watchpoint already at start
+// is replaced.
+func (w *Watches) Add(start uint16, end uint16, t WatchType) *WatchpointInfo {
+	p := &WatchpointInfo{Start: start, End: end, Type: t}
+	w.points[start] = p
+	w.update()
+	return p
+}
+
+// Remove removes the watchpoint that starts at the address.
+func (w *Watches) Remove(start uint16) bool {
+	if _, ok := w.points[start]; !ok {
+		return false
+	}
+	delete(w.points, start)
+	w.update()
+	return true
+}
+
+// List returns the watchpoints in order of address.
+func (w *Watches) List() []*WatchpointInfo {
+	list := make([]*WatchpointInfo, 0, len(w.points))
+	for _, p := range w.points {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Start < list[j].Start })
+	return list
+}
+
+// Hits returns the accesses since the machine was last started.
+func (w *Watches) Hits() []WatchHit {
+	return w.hits
+}
+
+func (w *Watches) update() {
+	w.types = [0x10000]WatchType{}
+	for _, p := range w.points {
+		for a := int(p.Start); a <= int(p.End); a++ {
+			w.types[a] |= p.Type
+		}
+	}
+}
+
+// begin starts checking the accesses made by the instruction at pc.
+func (w *Watches) begin(pc uint16) {
+	w.active = true
+	w.pc = pc
+}
+
+func (w *Watches) end() {
+	w.active = false
+}
+
+func (w *Watches) load(address uint16, value uint8) {
+	w.hit(WatchRead, address, value, value)
+}
+
+func (w *Watches) store(address uint16, old uint8, value uint8) {
+	w.hit(WatchWrite, address, old, value)
+}
+
+func (w *Watches) hit(access WatchType, address uint16, old uint8, value uint8) {
+	matched := false
+	for _, p := range w.points {
+		if address < p.Start || address > p.End {
+			continue
+		}
+		if p.Type&access != 0 || access == WatchWrite && p.Type&WatchChange != 0 && old != value {
+			p.Hits++
+			matched = true
+		}
+	}
+	if matched {
+		w.hits = append(w.hits, WatchHit{Type: access, PC: w.pc, Address: address, Old: old, New: value})
+	}
+}
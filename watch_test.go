@@ -0,0 +1,145 @@
+package mach85
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var watchProgram = []uint8{
+	0xad, 0x00, 0xc0, // $0800: lda $c000
+	0x8d, 0x01, 0xc0, // $0803: sta $c001
+	0xa9, 0x05, // $0806: lda #$05
+	0x8d, 0x01, 0xc0, // $0808: sta $c001
+	0x4c, 0x0b, 0x08, // $080b: jmp $080b
+}
+
+func TestWatch(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+		pc   uint16
+		hits []string
+	}{
+		{"read", "w c000 read", 0x0803, []string{"read $c000 at $0800: $00"}},
+		{"write", "w c001 write", 0x0806, []string{"write $c001 at $0803: $00"}},
+		{"change", "w c001 change", 0x080b, []string{"write $c001 at $0808: $00 -> $05"}},
+		{"range", "w bfff c001 read,write", 0x0803, []string{"read $c000 at $0800: $00"}},
+		{"outside", "w c002 c010 read,write", 0x080b, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mon, _ := newTestMonitor()
+			mon.mach.Memory.StoreN(0x0800, watchProgram...)
+			testMonitorParse(mon, test.cmd+"\n b 080b on \n g")
+			mon.mach.Start()
+			mon.mach.Run()
+			var hits []string
+			for _, hit := range mon.mach.Watches.Hits() {
+				hits = append(hits, hit.String())
+			}
+			if !reflect.DeepEqual(test.hits, hits) {
+				t.Errorf("\n want: %v \n have: %v \n", test.hits, hits)
+			}
+			if mon.cpu.PC+1 != test.pc {
+				t.Errorf("\n want: %04x \n have: %04x \n", test.pc, mon.cpu.PC+1)
+			}
+		})
+	}
+}
+
+func TestWatchMonitorAccess(t *testing.T) {
+	mon, _ := newTestMonitor()
+	mon.mach.Memory.StoreN(0x0800, 0xea, 0xea) // nop
+	testMonitorParse(mon, "w c000 read,write \n m c000 \n p c000 01 \n b 0801 on \n g")
+	mon.mach.Start()
+	mon.mach.Run()
+	if hits := mon.mach.Watches.Hits(); len(hits) != 0 {
+		t.Errorf("unexpected hits: %v", hits)
+	}
+	if mon.mach.Status != Breakpoint {
+		t.Errorf("\n want: %v \n have: %v \n", Breakpoint, mon.mach.Status)
+	}
+}
+
+func TestWatchCmd(t *testing.T) {
+	mon, out := newTestMonitor()
+	testMonitorParse(mon, "w \n w d020 write \n w 0400 07e7 change \n w 0400 off \n "+
+		"w c000 c001 read,write \n w c000 foo \n w c000 bfff read \n w 1000 off \n w")
+	want := []string{
+		"no watchpoints",
+		"invalid: foo",
+		"invalid range: c000 bfff",
+		"no watchpoint at $1000",
+		"$c000-$c001 read,write hits 0",
+		"$d020-$d020 write  hits 0",
+	}
+	have := testLines(t, out, 6)
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+}
+
+// Stores to memory as a device would when serviced
+type testStoreDevice struct {
+	mem *Memory
+}
+
+func (d testStoreDevice) Service() error {
+	d.mem.Store(0xc000, d.mem.Load(0xc000)+1)
+	return nil
+}
+
+func TestWatchDeviceAccess(t *testing.T) {
+	mon, _ := newTestMonitor()
+	mon.mach.Memory.StoreN(0x0800, 0xea, 0xea) // nop
+	mon.mach.AddDevice(testStoreDevice{mon.mach.Memory})
+	testMonitorParse(mon, "w c000 read,write \n b 0801 on")
+	mon.mach.Start()
+	mon.mach.Run()
+	if hits := mon.mach.Watches.Hits(); len(hits) != 0 {
+		t.Errorf("unexpected hits: %v", hits)
+	}
+	if mon.mach.Status != Breakpoint {
+		t.Errorf("\n want: %v \n have: %v \n", Breakpoint, mon.mach.Status)
+	}
+}
+
+func TestWatchStep(t *testing.T) {
+	mon, out := newTestMonitor()
+	mon.mach.Memory.StoreN(0x0800, watchProgram...)
+	testMonitorParse(mon, "w c001 write \n s 3")
+	want := []string{
+		"$0800: ad 00 c0  lda $c000",
+		"$0803: 8d 01 c0  sta $c001",
+		"write $c001 at $0803: $00",
+	}
+	have := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\n want: %v \n have: %v \n", want, have)
+	}
+	if mon.cpu.PC+1 != 0x0806 {
+		t.Errorf("\n want: %04x \n have: %04x \n", 0x0806, mon.cpu.PC+1)
+	}
+}
+
+func TestWatchIORegister(t *testing.T) {
+	for _, watch := range []string{"write", "change"} {
+		t.Run(watch, func(t *testing.T) {
+			mon, _ := newTestMonitor()
+			mon.mach.initCIAs()
+			mon.mach.Memory.StoreN(0x0800,
+				0xa9, 0x7f, // lda #$7f
+				0x8d, 0x0d, 0xdc, // sta $dc0d
+			)
+			mon.mach.cia1.icr = ciaIntTA
+			testMonitorParse(mon, "w dc0d "+watch+" \n s 2")
+			if len(mon.mach.Watches.Hits()) != 1 {
+				t.Errorf("watchpoint not hit")
+			}
+			if mon.mach.cia1.icr != ciaIntTA {
+				t.Errorf("interrupt flags cleared by the watchpoint")
+			}
+		})
+	}
+}
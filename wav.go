@@ -0,0 +1,103 @@
+package mach85
+
+// http://soundfile.sapp.org/doc/WaveFormat/
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+type wavHeader struct {
+	ChunkID       [4]byte
+	ChunkSize     uint32
+	Format        [4]byte
+	Subchunk1ID   [4]byte
+	Subchunk1Size uint32
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	Subchunk2ID   [4]byte
+	Subchunk2Size uint32
+}
+
+const wavHeaderLen = 44
+
+func newWAVHeader(sampleRate int, dataLen int) wavHeader {
+	return wavHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(36 + dataLen),
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1, // PCM
+		NumChannels:   1,
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * 2),
+		BlockAlign:    2,
+		BitsPerSample: 16,
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: uint32(dataLen),
+	}
+}
+
+// WAVWriter writes 16-bit mono samples to a WAV file. The header is updated
+// after each write so the file is valid even if it is never closed.
+type WAVWriter struct {
+	w          io.WriteSeeker
+	sampleRate int
+	dataLen    int
+}
+
+func NewWAVWriter(w io.WriteSeeker, sampleRate int) (*WAVWriter, error) {
+	wav := &WAVWriter{w: w, sampleRate: sampleRate}
+	if err := wav.writeHeader(); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+func (w *WAVWriter) Write(samples []int16) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if _, err := w.w.Seek(int64(wavHeaderLen+w.dataLen), io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, samples); err != nil {
+		return err
+	}
+	w.dataLen += len(samples) * 2
+	return w.writeHeader()
+}
+
+func (w *WAVWriter) writeHeader() error {
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := newWAVHeader(w.sampleRate, w.dataLen)
+	return binary.Write(w.w, binary.LittleEndian, header)
+}
+
+// ReadWAV reads back a file created by a WAVWriter.
+func ReadWAV(r io.Reader) (int, []int16, error) {
+	var header wavHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return 0, nil, err
+	}
+	if header.ChunkID != [4]byte{'R', 'I', 'F', 'F'} ||
+		header.Format != [4]byte{'W', 'A', 'V', 'E'} {
+		return 0, nil, errors.New("not a WAV file")
+	}
+	if header.AudioFormat != 1 || header.NumChannels != 1 || header.BitsPerSample != 16 {
+		return 0, nil, errors.New("unsupported WAV format")
+	}
+	samples := make([]int16, header.Subchunk2Size/2)
+	if err := binary.Read(r, binary.LittleEndian, samples); err != nil {
+		return 0, nil, err
+	}
+	return int(header.SampleRate), samples, nil
+}
@@ -0,0 +1,37 @@
+package mach85
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestWAV(t *testing.T) {
+	file, err := ioutil.TempFile("", "mach85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	wav, err := NewWAVWriter(file, 22050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav.Write([]int16{1, 2, 3})
+	wav.Write([]int16{-1, -2})
+
+	file.Seek(0, 0)
+	rate, samples, err := ReadWAV(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 22050 {
+		t.Errorf("\n want: %v \n have: %v \n", 22050, rate)
+	}
+	want := []int16{1, 2, 3, -1, -2}
+	if !reflect.DeepEqual(want, samples) {
+		t.Errorf("\n want: %v \n have: %v \n", want, samples)
+	}
+}